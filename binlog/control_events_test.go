@@ -0,0 +1,107 @@
+package binlog
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sryanyuan/binp/mconn"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+func TestParseControlEvents(t *testing.T) {
+	w := serialize.NewBinWriter(nil)
+	w.WriteUint64(1)
+	w.WriteBytes([]byte{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62})
+	w.WriteUint64(1)
+	w.WriteInt64(1)
+	w.WriteInt64(6)
+	previousGTIDs := w.Bytes()
+
+	w = serialize.NewBinWriter(nil)
+	w.WriteUint32(1)
+	w.WriteBytes([]byte("v"))
+	w.WriteUint8(0)
+	w.WriteUint8(UserVarIntResult)
+	w.WriteUint32(33)
+	w.WriteUint32(8)
+	w.WriteUint64(42)
+	w.WriteUint8(UserVarFlagUnsigned)
+	userVar := w.Bytes()
+
+	w = serialize.NewBinWriter(nil)
+	w.WriteUint8(0)
+	w.WriteInt32(1)
+	w.WriteInt32(2)
+	w.WriteInt32(1)
+	w.WriteBytes([]byte("abc"))
+	xaPrepare := w.Bytes()
+
+	w = serialize.NewBinWriter(nil)
+	w.WriteUint32(2 | 1<<28)
+	for _, v := range []uint32{0, 1} {
+		w.WriteUint32(v)
+		w.WriteUint32(v + 1)
+		w.WriteUint64(uint64(v) + 101)
+	}
+	gtidList := w.Bytes()
+
+	cases := []struct {
+		tp   uint8
+		data []byte
+		want func(*EventSet) interface{}
+		v    interface{}
+	}{
+		{PreviousGtidsEventType, previousGTIDs,
+			func(s *EventSet) interface{} { return s.PreviousGTIDs.GTIDSet.String() },
+			"3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"},
+		{IntvarEventType, []byte{IntvarTypeInsertID, 7, 0, 0, 0, 0, 0, 0, 0},
+			func(s *EventSet) interface{} { return *s.Intvar },
+			IntvarEvent{Type: IntvarTypeInsertID, Value: 7}},
+		{RandEventType, append(make([]byte, 7), 1, 2, 0, 0, 0, 0, 0, 0, 0),
+			func(s *EventSet) interface{} { return *s.Rand },
+			RandEvent{Seed1: 1 << 56, Seed2: 2}},
+		{UserVarEventType, userVar,
+			func(s *EventSet) interface{} { return *s.UserVar },
+			UserVarEvent{Name: "v", Type: UserVarIntResult, Charset: 33,
+				Value: []byte{42, 0, 0, 0, 0, 0, 0, 0}, Flags: UserVarFlagUnsigned}},
+		{UserVarEventType, []byte{1, 0, 0, 0, 'v', 1},
+			func(s *EventSet) interface{} { return *s.UserVar },
+			UserVarEvent{Name: "v", IsNull: true}},
+		{IncidentEventType, []byte{IncidentLostEvents, 0, 4, 'l', 'o', 's', 't'},
+			func(s *EventSet) interface{} { return *s.Incident },
+			IncidentEvent{Type: IncidentLostEvents, Message: "lost"}},
+		{StopEventType, nil,
+			func(s *EventSet) interface{} { return nil != s.Stop },
+			true},
+		{XAPrepareLogEventType, xaPrepare,
+			func(s *EventSet) interface{} { return *s.XAPrepare },
+			XAPrepareEvent{FormatID: 1, Gtrid: []byte("ab"), Bqual: []byte("c")}},
+		{MariadbGTIDListEventType, gtidList,
+			func(s *EventSet) interface{} { return *s.MariadbGTIDList },
+			MariadbGTIDListEvent{Flags: 1, GTIDs: []mconn.MariadbGTID{
+				{DomainID: 0, ServerID: 1, SequenceNumber: 101},
+				{DomainID: 1, ServerID: 2, SequenceNumber: 102},
+			}}},
+		{MariadbBinlogCheckpointEventType, []byte{10, 0, 0, 0, 'b', 'i', 'n', 'l', 'o', 'g', '.', '0', '0', '1'},
+			func(s *EventSet) interface{} { return s.MariadbBinlogCheckpoint.Filename },
+			"binlog.001"},
+		{MariadbAnnotateRowsEventType, []byte("INSERT INTO t VALUES (1)"),
+			func(s *EventSet) interface{} { return s.MariadbAnnotateRows.Query },
+			"INSERT INTO t VALUES (1)"},
+	}
+	p := &Parser{}
+	for _, c := range cases {
+		event := &Event{Header: EventHeader{EventType: c.tp}}
+		if err := p.parsePayload(event, c.data); nil != err {
+			t.Errorf("parse event %d: %v", c.tp, err)
+			continue
+		}
+		if !event.Payload.Parsed {
+			t.Errorf("event %d is not parsed", c.tp)
+			continue
+		}
+		if v := c.want(&event.Payload); !reflect.DeepEqual(c.v, v) {
+			t.Errorf("unexpected payload %+v of event %d, want %+v", v, c.tp, c.v)
+		}
+	}
+}
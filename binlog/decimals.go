@@ -4,10 +4,9 @@ package binlog
 // github.com/siddontang/go-mysql/replication/row_event.go
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/juju/errors"
 	"github.com/sryanyuan/binp/serialize"
@@ -15,6 +14,8 @@ import (
 
 const (
 	digPerDec1 = 9
+	// Max value of the 9 digits group
+	decimalGroupBase = 1000000000
 )
 
 var (
@@ -30,68 +31,78 @@ func decimalBinSize(precision int, scale int) int {
 	return intg0*4 + dig2bytes[intg0x] + frac0*4 + dig2bytes[frac0x]
 }
 
-func decodeDecimal(r *serialize.BinReader, precision int, scale int) (float64, error) {
+// decodeDecimal decodes the binary decimal as the exact decimal string, see bin2decimal.
+// The integer part has no leading zeros and the fraction part has exact scale digits
+func decodeDecimal(r *serialize.BinReader, precision int, scale int) (string, error) {
+	if precision <= 0 || scale < 0 || scale > precision {
+		return "", errors.Errorf("invalid decimal precision %d and scale %d", precision, scale)
+	}
 	intg := precision - scale
 	intg0 := intg / digPerDec1
 	frac0 := scale / digPerDec1
 	intg0x := intg - intg0*digPerDec1
 	frac0x := scale - frac0*digPerDec1
-	dsz := intg0*4 + dig2bytes[intg0x] + frac0*4 + dig2bytes[frac0x]
-	buf := make([]byte, dsz)
-	// Read decimal data from reader
-	decimalData, err := r.ReadBytes(dsz)
+	decimalData, err := r.ReadBytes(decimalBinSize(precision, scale))
 	if nil != err {
-		return 0, errors.Trace(err)
+		return "", errors.Trace(err)
 	}
+	buf := make([]byte, len(decimalData))
 	copy(buf, decimalData)
 
-	var fbuf bytes.Buffer
-	value := uint32(buf[0])
-	var mask uint32
-	if value&0x80 == 0 {
-		// Nagetive
-		mask = uint32((1 << 32) - 1)
-		fbuf.WriteString("-")
-	}
-
-	// Reset the sign flag
+	// The sign bit is set for positive values, all bits of negative values are inverted
+	negative := 0 == buf[0]&0x80
 	buf[0] ^= 0x80
-
-	pos, value := decodeDecimalDecompressValue(intg0x, buf, uint8(mask))
-	fbuf.WriteString(strconv.FormatUint(uint64(value), 10))
-
-	for i := 0; i < intg0; i++ {
-		value = binary.BigEndian.Uint32(buf[pos:]) ^ mask
-		pos += 4
-		fbuf.WriteString(fmt.Sprintf("%09d", value))
+	if negative {
+		for i := range buf {
+			buf[i] ^= 0xff
+		}
 	}
 
-	fbuf.WriteString(".")
-
-	for i := 0; i < frac0; i++ {
-		value = binary.BigEndian.Uint32(buf[pos:]) ^ mask
-		pos += 4
-		fbuf.WriteString(fmt.Sprintf("%09d", value))
-	}
-
-	if size, value := decodeDecimalDecompressValue(frac0x, buf[pos:], uint8(mask)); size > 0 {
-		fbuf.WriteString(fmt.Sprintf("%0*d", frac0x, value))
+	var ib, fb strings.Builder
+	pos := 0
+	readGroup := func(digits int) uint32 {
+		size := dig2bytes[digits]
 		pos += size
+		return uint32(serialize.NumberFromBytesBigEndian(buf[pos-size : pos]))
 	}
-
-	f, err := strconv.ParseFloat(fbuf.String(), 64)
-	if nil != err {
-		return 0, errors.Trace(err)
+	if intg0x > 0 {
+		value := readGroup(intg0x)
+		ib.WriteString(strconv.FormatUint(uint64(value), 10))
+	}
+	for i := 0; i < intg0+frac0; i++ {
+		value := readGroup(digPerDec1)
+		if value >= decimalGroupBase {
+			return "", errors.Errorf("invalid decimal digits group %d", value)
+		}
+		if i < intg0 {
+			fmt.Fprintf(&ib, "%09d", value)
+		} else {
+			fmt.Fprintf(&fb, "%09d", value)
+		}
+	}
+	if frac0x > 0 {
+		value := readGroup(frac0x)
+		fmt.Fprintf(&fb, "%0*d", frac0x, value)
+	}
+	if fb.Len() != scale {
+		return "", errors.Errorf("invalid decimal fraction digits %s of scale %d", fb.String(), scale)
 	}
-	return f, nil
-}
 
-func decodeDecimalDecompressValue(compIndx int, data []byte, mask uint8) (size int, value uint32) {
-	size = dig2bytes[compIndx]
-	databuff := make([]byte, size)
-	for i := 0; i < size; i++ {
-		databuff[i] = data[i] ^ mask
+	intPart := strings.TrimLeft(ib.String(), "0")
+	if len(intPart) > intg {
+		return "", errors.Errorf("invalid decimal integer digits %s of precision %d", intPart, precision)
+	}
+	if "" == intPart {
+		intPart = "0"
+	}
+	var s strings.Builder
+	if negative && ("0" != intPart || strings.Trim(fb.String(), "0") != "") {
+		s.WriteByte('-')
+	}
+	s.WriteString(intPart)
+	if scale > 0 {
+		s.WriteByte('.')
+		s.WriteString(fb.String())
 	}
-	value = uint32(serialize.NumberFromBytesBigEndian(databuff))
-	return
+	return s.String(), nil
 }
@@ -0,0 +1,117 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sryanyuan/binp/mconn"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+// encodeDecimal encodes the decimal string like decimal2bin
+func encodeDecimal(t *testing.T, s string, precision int, scale int) []byte {
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	intg := precision - scale
+	intPart = strings.TrimLeft(intPart, "0")
+	intPart = strings.Repeat("0", intg-len(intPart)) + intPart
+	fracPart += strings.Repeat("0", scale-len(fracPart))
+
+	var buf []byte
+	writeGroup := func(digits string) {
+		v, err := strconv.ParseUint(digits, 10, 32)
+		if nil != err {
+			t.Fatal(err)
+		}
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(v))
+		buf = append(buf, b[4-dig2bytes[len(digits)]:]...)
+	}
+	if x := intg % digPerDec1; x > 0 {
+		writeGroup(intPart[:x])
+		intPart = intPart[x:]
+	}
+	for ; "" != intPart; intPart = intPart[digPerDec1:] {
+		writeGroup(intPart[:digPerDec1])
+	}
+	for ; len(fracPart) >= digPerDec1; fracPart = fracPart[digPerDec1:] {
+		writeGroup(fracPart[:digPerDec1])
+	}
+	if "" != fracPart {
+		writeGroup(fracPart)
+	}
+	if negative {
+		for i := range buf {
+			buf[i] ^= 0xff
+		}
+	}
+	buf[0] ^= 0x80
+	return buf
+}
+
+func TestDecodeDecimal(t *testing.T) {
+	// The example of decimal2bin in strings/decimal.cc
+	data := []byte{0x81, 0x0d, 0xfb, 0x38, 0xd2, 0x04, 0xd2}
+	if v, err := decodeDecimal(serialize.NewBinReader(data), 14, 4); nil != err || "1234567890.1234" != v {
+		t.Errorf("unexpected decimal %v, err %v", v, err)
+	}
+	data = []byte{0x7e, 0xf2, 0x04, 0xc7, 0x2d, 0xfb, 0x2d}
+	if v, err := decodeDecimal(serialize.NewBinReader(data), 14, 4); nil != err || "-1234567890.1234" != v {
+		t.Errorf("unexpected decimal %v, err %v", v, err)
+	}
+
+	max65 := strings.Repeat("9", 35) + "." + strings.Repeat("9", 30)
+	cases := []struct {
+		precision int
+		scale     int
+		value     string
+	}{
+		{65, 30, max65},
+		{65, 30, "-" + max65},
+		{65, 30, "12345678901234567890123456789012345.123456789012345678901234567890"},
+		{65, 30, "0.000000000000000000000000000001"},
+		{65, 30, "0.000000000000000000000000000000"},
+		{65, 0, strings.Repeat("9", 65)},
+		{65, 0, "-" + strings.Repeat("9", 65)},
+		{65, 0, "0"},
+		{30, 10, "1000000000.0000000001"},
+		{30, 10, "-0.5000000000"},
+		{20, 2, "123456789012345678.90"},
+		{10, 10, "0.0123456789"},
+		{1, 0, "-1"},
+		{4, 2, "-0.01"},
+	}
+	for _, c := range cases {
+		data := encodeDecimal(t, c.value, c.precision, c.scale)
+		if decimalBinSize(c.precision, c.scale) != len(data) {
+			t.Errorf("unexpected size %d of decimal(%d,%d)", len(data), c.precision, c.scale)
+		}
+		// Decode the column like the rows event
+		r := serialize.NewBinReader(data)
+		v, err := readValue(r, mconn.FieldTypeNewDecimal, uint16(c.precision<<8|c.scale))
+		if nil != err {
+			t.Errorf("decode %s: %v", c.value, err)
+			continue
+		}
+		if c.value != v {
+			t.Errorf("unexpected decimal %v of decimal(%d,%d), want %s", v, c.precision, c.scale, c.value)
+		}
+		if !r.Empty() {
+			t.Errorf("decimal %s is not fully read", c.value)
+		}
+		if !bytes.Equal(data, encodeDecimal(t, v.(string), c.precision, c.scale)) {
+			t.Errorf("decimal %s doesn't round trip", c.value)
+		}
+	}
+
+	if _, err := decodeDecimal(serialize.NewBinReader(make([]byte, 8)), 2, 3); nil == err {
+		t.Error("scale larger than precision is decoded")
+	}
+}
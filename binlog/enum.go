@@ -22,7 +22,7 @@ func decodeEnum(r *serialize.BinReader, meta uint16) (interface{}, error) {
 			if nil != err {
 				return nil, errors.Trace(err)
 			}
-			return int32(serialize.NumberFromBytesBigEndian(bv)), nil
+			return int32(serialize.NumberFromBytesLittleEndian(bv)), nil
 		}
 	default:
 		{
@@ -0,0 +1,32 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/sryanyuan/binp/mconn"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+func TestReadEnumAndSet(t *testing.T) {
+	cases := []struct {
+		meta uint16
+		data []byte
+		want interface{}
+	}{
+		// Enums and sets are logged as strings with the real type and the pack length
+		{uint16(mconn.FieldTypeEnum)<<8 | 1, []byte{0x02}, int32(2)},
+		{uint16(mconn.FieldTypeEnum)<<8 | 2, []byte{0x2c, 0x01}, int32(300)},
+		{uint16(mconn.FieldTypeSet)<<8 | 1, []byte{0x05}, uint64(5)},
+		{uint16(mconn.FieldTypeSet)<<8 | 2, []byte{0x01, 0x01}, uint64(257)},
+	}
+	for _, c := range cases {
+		r := serialize.NewBinReader(c.data)
+		v, err := readValue(r, mconn.FieldTypeString, c.meta)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if c.want != v || !r.Empty() {
+			t.Errorf("unexpected value %v of meta %x, want %v", v, c.meta, c.want)
+		}
+	}
+}
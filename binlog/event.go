@@ -1,5 +1,10 @@
 package binlog
 
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
 // Event type of binlog event
 // https://dev.mysql.com/doc/internals/en/binlog-event-type.html
 const (
@@ -42,6 +47,19 @@ const (
 	GTIDEventType
 	AnonymousGtidEventType
 	PreviousGtidsEventType
+	TransactionContextEventType
+	ViewChangeEventType
+	XAPrepareLogEventType
+	PartialUpdateRowsEventType
+	TransactionPayloadEventType
+	HeartbeatLogV2EventType
+)
+
+// Semi-sync header of the binlog event
+// https://dev.mysql.com/doc/internals/en/semi-sync-binlog-event.html
+const (
+	SemiSyncIndicator   = 0xef
+	SemiSyncFlagNeedAck = 0x01
 )
 
 // MariaDB binlog events
@@ -93,6 +111,27 @@ type EventHeader struct {
 	Flags uint16
 }
 
+// Encode encodes the event with the header, the event size is filled and the
+// crc32 checksum is appended if the checksum algorithm is ChecksumAlgCRC32
+func (h *EventHeader) Encode(body []byte, checksum uint8) []byte {
+	size := fixedEventHeaderLength + len(body)
+	if ChecksumAlgCRC32 == checksum {
+		size += 4
+	}
+	data := make([]byte, size)
+	binary.LittleEndian.PutUint32(data[0:], h.Timestamp)
+	data[4] = h.EventType
+	binary.LittleEndian.PutUint32(data[5:], h.ServerID)
+	binary.LittleEndian.PutUint32(data[9:], uint32(size))
+	binary.LittleEndian.PutUint32(data[13:], h.LogPos)
+	binary.LittleEndian.PutUint16(data[17:], h.Flags)
+	copy(data[fixedEventHeaderLength:], body)
+	if ChecksumAlgCRC32 == checksum {
+		binary.LittleEndian.PutUint32(data[size-4:], crc32.ChecksumIEEE(data[:size-4]))
+	}
+	return data
+}
+
 // EventSet has all event type
 type EventSet struct {
 	// Parsed is true when the event is parsed
@@ -111,12 +150,34 @@ type EventSet struct {
 	Rows *RowsEvent
 	// Rows query event
 	RowsQuery *RowsQueryEvent
-	// Gtid event
+	// Gtid event, anonymous gtid event without the gtid is parsed as the gtid event
 	GTID *GTIDEvent
 	// Mariadb gtid event
 	MariadbGTID *MariadbGTIDEvent
 	// Heartbeat event
 	Heartbeat *HeartbeatEvent
+	// Transaction payload event
+	TransactionPayload *TransactionPayloadEvent
+	// Previous gtids event
+	PreviousGTIDs *PreviousGTIDsEvent
+	// Intvar event
+	Intvar *IntvarEvent
+	// Rand event
+	Rand *RandEvent
+	// User var event
+	UserVar *UserVarEvent
+	// Incident event
+	Incident *IncidentEvent
+	// Stop event
+	Stop *StopEvent
+	// XA prepare event
+	XAPrepare *XAPrepareEvent
+	// Mariadb gtid list event
+	MariadbGTIDList *MariadbGTIDListEvent
+	// Mariadb binlog checkpoint event
+	MariadbBinlogCheckpoint *MariadbBinlogCheckpointEvent
+	// Mariadb annotate rows event
+	MariadbAnnotateRows *MariadbAnnotateRowsEvent
 }
 
 // Decode decodes binary data to a binlog event
@@ -130,6 +191,21 @@ type Event struct {
 	Data    []byte
 	Header  EventHeader
 	Payload EventSet
+	// NeedAck is true if the semi-sync master waits for the ack of the event
+	NeedAck bool
+}
+
+// Flatten returns the inner events of the transaction payload event, or the event
+// itself for other events. The last inner event needs the ack of the payload event
+func (e *Event) Flatten() []*Event {
+	if nil == e.Payload.TransactionPayload {
+		return []*Event{e}
+	}
+	events := e.Payload.TransactionPayload.Events
+	if len(events) > 0 {
+		events[len(events)-1].NeedAck = e.NeedAck
+	}
+	return events
 }
 
 // IPayload defines a binlog payload
@@ -0,0 +1,177 @@
+package binlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/juju/errors"
+)
+
+// FileMagic is the header of binlog files and relay log files
+var FileMagic = []byte{0xfe, 'b', 'i', 'n'}
+
+// FileReader reads binlog events from binlog files or relay log files
+type FileReader struct {
+	name   string
+	f      *os.File
+	r      *bufio.Reader
+	parser *Parser
+	// offset is the file offset of the next event
+	offset int64
+	// eventOffset is the file offset of the last event
+	eventOffset int64
+}
+
+// NewFileReader opens the binlog file and validates the magic header, events
+// are parsed by the parser, a new parser is created if it is nil
+func NewFileReader(name string, parser *Parser) (*FileReader, error) {
+	f, err := os.Open(name)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	magic := make([]byte, len(FileMagic))
+	if _, err = io.ReadFull(f, magic); nil != err {
+		f.Close()
+		return nil, errors.Annotatef(err, "read magic header of %s", name)
+	}
+	if !bytes.Equal(magic, FileMagic) {
+		f.Close()
+		return nil, errors.Errorf("%s is not a binlog file, magic header %x", name, magic)
+	}
+
+	if nil == parser {
+		parser = NewParser()
+	}
+	parser.Reset()
+	return &FileReader{
+		name:        name,
+		f:           f,
+		r:           bufio.NewReader(f),
+		parser:      parser,
+		offset:      int64(len(FileMagic)),
+		eventOffset: int64(len(FileMagic)),
+	}, nil
+}
+
+// Name returns the file name
+func (r *FileReader) Name() string {
+	return r.name
+}
+
+// Offset returns the file offset of the last event
+func (r *FileReader) Offset() int64 {
+	return r.eventOffset
+}
+
+// NextOffset returns the file offset of the next event
+func (r *FileReader) NextOffset() int64 {
+	return r.offset
+}
+
+// SeekEvent moves to the event starts at the offset, the format description event
+// is parsed first if no event has been read
+func (r *FileReader) SeekEvent(offset int64) error {
+	if offset < int64(len(FileMagic)) {
+		return errors.Errorf("invalid offset %d", offset)
+	}
+	if nil == r.parser.format && offset > int64(len(FileMagic)) {
+		if err := r.seek(int64(len(FileMagic))); nil != err {
+			return errors.Trace(err)
+		}
+		event, err := r.Next()
+		if nil != err {
+			return errors.Annotate(err, "read format description event")
+		}
+		if FormatDescriptionEventType != event.Header.EventType {
+			return errors.Errorf("first event of %s is %d, not format description event",
+				r.name, event.Header.EventType)
+		}
+	}
+	return errors.Trace(r.seek(offset))
+}
+
+func (r *FileReader) seek(offset int64) error {
+	if _, err := r.f.Seek(offset, io.SeekStart); nil != err {
+		return errors.Trace(err)
+	}
+	r.r.Reset(r.f)
+	r.offset = offset
+	return nil
+}
+
+// Next reads the next event, io.EOF is returned at the end of the file. If the
+// last event is incomplete, io.ErrUnexpectedEOF is returned and the reader stays
+// at the event, so the event can be read again after the file is appended
+func (r *FileReader) Next() (*Event, error) {
+	data, err := r.read()
+	if nil != err {
+		return nil, err
+	}
+
+	// Each format description event describes the checksum of the following events,
+	// a relay log has format description events of both the slave and the master
+	if FormatDescriptionEventType == data[4] {
+		r.parser.SetChecksum(FormatDescriptionChecksum(data))
+	}
+	event, err := r.parser.ParseEvent(data)
+	if nil != err {
+		return nil, errors.Annotatef(err, "parse event at %s:%d", r.name, r.offset)
+	}
+	r.advance(data)
+	return event, nil
+}
+
+// NextData reads the data of the next event without parsing, errors are the same as Next
+func (r *FileReader) NextData() ([]byte, error) {
+	data, err := r.read()
+	if nil != err {
+		return nil, err
+	}
+	r.advance(data)
+	return data, nil
+}
+
+func (r *FileReader) read() ([]byte, error) {
+	header := make([]byte, fixedEventHeaderLength)
+	n, err := io.ReadFull(r.r, header)
+	if nil != err {
+		if io.EOF == err && 0 == n {
+			return nil, io.EOF
+		}
+		return nil, r.rewind(err)
+	}
+	size := binary.LittleEndian.Uint32(header[9:])
+	if size < fixedEventHeaderLength {
+		return nil, errors.Errorf("invalid event size %d at %s:%d", size, r.name, r.offset)
+	}
+	data := make([]byte, size)
+	copy(data, header)
+	if _, err = io.ReadFull(r.r, data[fixedEventHeaderLength:]); nil != err {
+		return nil, r.rewind(err)
+	}
+	return data, nil
+}
+
+func (r *FileReader) advance(data []byte) {
+	r.eventOffset = r.offset
+	r.offset += int64(len(data))
+}
+
+// rewind moves back to the start of the incomplete event
+func (r *FileReader) rewind(err error) error {
+	if io.EOF != err && io.ErrUnexpectedEOF != err {
+		return errors.Trace(err)
+	}
+	if serr := r.seek(r.offset); nil != serr {
+		return errors.Trace(serr)
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// Close closes the file
+func (r *FileReader) Close() error {
+	return errors.Trace(r.f.Close())
+}
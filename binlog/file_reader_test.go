@@ -0,0 +1,158 @@
+package binlog_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sryanyuan/binp/binlog"
+	"github.com/sryanyuan/binp/fakemaster"
+	"github.com/sryanyuan/binp/mconn"
+)
+
+// writeTestBinlog writes a binlog file with a transaction inserts a row, returns the file path
+func writeTestBinlog(t *testing.T, dir string, checksum bool) string {
+	m, err := fakemaster.NewMaster(&fakemaster.Config{Checksum: checksum})
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	table := &fakemaster.Table{
+		ID:      1,
+		Schema:  "test",
+		Name:    "t",
+		Columns: []fakemaster.Column{{Type: mconn.FieldTypeLong}},
+	}
+	rows, err := table.NewWriteRowsEvent([]interface{}{int32(7)})
+	if nil != err {
+		t.Fatal(err)
+	}
+	m.AppendEvents(fakemaster.NewQueryEvent("test", "BEGIN"),
+		table.NewTableMapEvent(), rows, fakemaster.NewXidEvent(1))
+	if err = m.SaveBinlogFiles(dir); nil != err {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, m.Point().Filename)
+}
+
+func TestFileReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlog")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, checksum := range []bool{false, true} {
+		name := writeTestBinlog(t, dir, checksum)
+		r, err := binlog.NewFileReader(name, nil)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		var types []uint8
+		var tableMapOffset int64
+		for {
+			event, err := r.Next()
+			if io.EOF == err {
+				break
+			}
+			if nil != err {
+				t.Fatalf("checksum %v: %v", checksum, err)
+			}
+			if int64(event.Header.LogPos) != r.NextOffset() ||
+				r.Offset()+int64(event.Header.EventSize) != r.NextOffset() {
+				t.Errorf("checksum %v: unexpected offset %d, log pos %d", checksum, r.Offset(), event.Header.LogPos)
+			}
+			types = append(types, event.Header.EventType)
+			if nil != event.Payload.TableMap {
+				tableMapOffset = r.Offset()
+			}
+			if nil != event.Payload.Rows {
+				if v := event.Payload.Rows.Rows[0].ColumnDatas[0]; int32(7) != v {
+					t.Errorf("checksum %v: unexpected value %v", checksum, v)
+				}
+			}
+		}
+		want := []uint8{binlog.FormatDescriptionEventType, binlog.QueryEventType,
+			binlog.TableMapEventType, binlog.WriteRowsEventV2Type, binlog.XidEventType}
+		if len(types) != len(want) {
+			t.Fatalf("checksum %v: unexpected events %v", checksum, types)
+		}
+		for i := range want {
+			if want[i] != types[i] {
+				t.Fatalf("checksum %v: unexpected events %v", checksum, types)
+			}
+		}
+
+		// The format description event is parsed before seeking
+		r.Close()
+		if r, err = binlog.NewFileReader(name, nil); nil != err {
+			t.Fatal(err)
+		}
+		if err = r.SeekEvent(tableMapOffset); nil != err {
+			t.Fatal(err)
+		}
+		for _, tp := range []uint8{binlog.TableMapEventType, binlog.WriteRowsEventV2Type} {
+			event, err := r.Next()
+			if nil != err {
+				t.Fatalf("checksum %v: %v", checksum, err)
+			}
+			if tp != event.Header.EventType {
+				t.Errorf("checksum %v: unexpected event %d after seeking", checksum, event.Header.EventType)
+			}
+		}
+		r.Close()
+	}
+}
+
+func TestFileReaderTruncated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlog")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := writeTestBinlog(t, dir, true)
+	data, err := ioutil.ReadFile(name)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(name, data[:len(data)-3], 0644); nil != err {
+		t.Fatal(err)
+	}
+	r, err := binlog.NewFileReader(name, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for {
+		if _, err = r.Next(); nil != err {
+			break
+		}
+	}
+	if io.ErrUnexpectedEOF != err {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// The incomplete event is read after the file is completed
+	if err = ioutil.WriteFile(name, data, 0644); nil != err {
+		t.Fatal(err)
+	}
+	event, err := r.Next()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if binlog.XidEventType != event.Header.EventType || int64(len(data)) != r.NextOffset() {
+		t.Errorf("unexpected event %d at %d", event.Header.EventType, r.Offset())
+	}
+
+	if err = ioutil.WriteFile(name, []byte("not a binlog"), 0644); nil != err {
+		t.Fatal(err)
+	}
+	if _, err = binlog.NewFileReader(name, nil); nil == err {
+		t.Error("open file without magic header should fail")
+	}
+}
@@ -1,6 +1,10 @@
 package binlog
 
 import (
+	"bytes"
+	"strconv"
+	"strings"
+
 	"github.com/juju/errors"
 	"github.com/sryanyuan/binp/serialize"
 )
@@ -49,3 +53,39 @@ func (e *FormatDescriptionEvent) Decode(data []byte) error {
 
 	return nil
 }
+
+// FormatDescriptionChecksum returns the checksum algorithm of the format description
+// event with the event header. The algorithm byte and the checksum are appended since
+// mysql 5.6.1 and mariadb 5.3
+func FormatDescriptionChecksum(data []byte) uint8 {
+	// header, binlog version and the server version
+	if len(data) < fixedEventHeaderLength+2+50+5 {
+		return ChecksumAlgOff
+	}
+	version := data[fixedEventHeaderLength+2 : fixedEventHeaderLength+2+50]
+	if i := bytes.IndexByte(version, 0); i >= 0 {
+		version = version[:i]
+	}
+	minVersion := [3]int{5, 6, 1}
+	if bytes.Contains(bytes.ToLower(version), []byte("mariadb")) {
+		minVersion = [3]int{5, 3, 0}
+	}
+	var v [3]int
+	for i, part := range strings.SplitN(string(version), ".", 3) {
+		// Skip the suffix like 30-log
+		end := strings.IndexFunc(part, func(r rune) bool { return r < '0' || r > '9' })
+		if end >= 0 {
+			part = part[:end]
+		}
+		v[i], _ = strconv.Atoi(part)
+	}
+	for i := range v {
+		if v[i] != minVersion[i] {
+			if v[i] < minVersion[i] {
+				return ChecksumAlgOff
+			}
+			break
+		}
+	}
+	return data[len(data)-5]
+}
@@ -0,0 +1,337 @@
+package binlog
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+// WKB geometry types
+const (
+	wkbPoint = iota + 1
+	wkbLineString
+	wkbPolygon
+	wkbMultiPoint
+	wkbMultiLineString
+	wkbMultiPolygon
+	wkbGeometryCollection
+)
+
+const (
+	// Max nested level of the geometry collections
+	maxGeometryDepth = 64
+	// Min size of the wkb geometry, byte order and type
+	minWKBSize = 5
+)
+
+var (
+	wkbTypeNames = map[uint32][2]string{
+		wkbPoint:              {"POINT", "Point"},
+		wkbLineString:         {"LINESTRING", "LineString"},
+		wkbPolygon:            {"POLYGON", "Polygon"},
+		wkbMultiPoint:         {"MULTIPOINT", "MultiPoint"},
+		wkbMultiLineString:    {"MULTILINESTRING", "MultiLineString"},
+		wkbMultiPolygon:       {"MULTIPOLYGON", "MultiPolygon"},
+		wkbGeometryCollection: {"GEOMETRYCOLLECTION", "GeometryCollection"},
+	}
+)
+
+// Geometry is the value of the geometry column, mysql stores the geometry as the 4 bytes
+// little endian SRID followed by the WKB
+type Geometry struct {
+	SRID uint32
+	WKB  []byte
+}
+
+// wkbGeometry is the parsed WKB geometry
+type wkbGeometry struct {
+	kind uint32
+	// points of point, line string and multi point
+	points [][2]float64
+	// rings of polygon
+	rings [][][2]float64
+	// children of multi line string, multi polygon and geometry collection
+	children []*wkbGeometry
+}
+
+// decodeGeometry reads the geometry column, meta is the bytes of the length like blobs
+func decodeGeometry(r *serialize.BinReader, meta uint16) (interface{}, error) {
+	v, err := decodeBlob(r, meta)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	data := v.([]byte)
+	if len(data) < 4+minWKBSize {
+		return nil, errors.Errorf("invalid geometry length %d", len(data))
+	}
+	return Geometry{
+		SRID: binary.LittleEndian.Uint32(data),
+		WKB:  data[4:],
+	}, nil
+}
+
+// Value returns the mysql internal format of the geometry so mysql destinations
+// receive the value as is
+func (g Geometry) Value() (driver.Value, error) {
+	data := make([]byte, 4+len(g.WKB))
+	binary.LittleEndian.PutUint32(data, g.SRID)
+	copy(data[4:], g.WKB)
+	return data, nil
+}
+
+// String returns the WKT of the geometry, or the error if the WKB is invalid
+func (g Geometry) String() string {
+	s, err := g.WKT()
+	if nil != err {
+		return err.Error()
+	}
+	return s
+}
+
+// WKT returns the well known text of the geometry like ST_AsText
+func (g Geometry) WKT() (string, error) {
+	geo, err := parseWKB(g.WKB)
+	if nil != err {
+		return "", errors.Trace(err)
+	}
+	var b strings.Builder
+	geo.writeWKT(&b, true)
+	return b.String(), nil
+}
+
+// GeoJSON returns the GeoJSON geometry object, the SRID is ignored
+func (g Geometry) GeoJSON() ([]byte, error) {
+	geo, err := parseWKB(g.WKB)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	data, err := json.Marshal(geo.geoJSON())
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	return data, nil
+}
+
+// MarshalJSON encodes the geometry as GeoJSON
+func (g Geometry) MarshalJSON() ([]byte, error) {
+	return g.GeoJSON()
+}
+
+// parseWKB parses the WKB geometry, all bytes must be consumed
+func parseWKB(data []byte) (*wkbGeometry, error) {
+	r := serialize.NewBinReader(data)
+	geo, err := readWKBGeometry(r, 0)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	if !r.Empty() {
+		return nil, errors.Errorf("%d bytes left after the geometry", len(r.LeftBytes()))
+	}
+	return geo, nil
+}
+
+func readWKBGeometry(r *serialize.BinReader, depth int) (*wkbGeometry, error) {
+	if depth > maxGeometryDepth {
+		return nil, errors.New("geometry nested too deep")
+	}
+	order, err := r.ReadUint8()
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	if order > 1 {
+		return nil, errors.Errorf("invalid wkb byte order %d", order)
+	}
+	var bo binary.ByteOrder = binary.LittleEndian
+	if 0 == order {
+		bo = binary.BigEndian
+	}
+	readUint32 := func() (uint32, error) {
+		b, err := r.ReadBytes(4)
+		if nil != err {
+			return 0, errors.Trace(err)
+		}
+		return bo.Uint32(b), nil
+	}
+	// readCount reads the count of the elements and checks the elements are not
+	// larger than the left bytes
+	readCount := func(minSize int) (int, error) {
+		n, err := readUint32()
+		if nil != err {
+			return 0, errors.Trace(err)
+		}
+		if uint64(n)*uint64(minSize) > uint64(len(r.LeftBytes())) {
+			return 0, errors.Errorf("wkb elements count %d overflow", n)
+		}
+		return int(n), nil
+	}
+	readPoints := func() ([][2]float64, error) {
+		n, err := readCount(16)
+		if nil != err {
+			return nil, errors.Trace(err)
+		}
+		points := make([][2]float64, n)
+		for i := range points {
+			b, err := r.ReadBytes(16)
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			points[i][0] = math.Float64frombits(bo.Uint64(b))
+			points[i][1] = math.Float64frombits(bo.Uint64(b[8:]))
+		}
+		return points, nil
+	}
+
+	kind, err := readUint32()
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	geo := &wkbGeometry{kind: kind}
+	switch kind {
+	case wkbPoint:
+		{
+			b, err := r.ReadBytes(16)
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			geo.points = [][2]float64{{
+				math.Float64frombits(bo.Uint64(b)),
+				math.Float64frombits(bo.Uint64(b[8:])),
+			}}
+		}
+	case wkbLineString:
+		{
+			if geo.points, err = readPoints(); nil != err {
+				return nil, errors.Trace(err)
+			}
+		}
+	case wkbPolygon:
+		{
+			n, err := readCount(4)
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			geo.rings = make([][][2]float64, n)
+			for i := range geo.rings {
+				if geo.rings[i], err = readPoints(); nil != err {
+					return nil, errors.Trace(err)
+				}
+			}
+		}
+	case wkbMultiPoint, wkbMultiLineString, wkbMultiPolygon, wkbGeometryCollection:
+		{
+			n, err := readCount(minWKBSize)
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			geo.children = make([]*wkbGeometry, n)
+			for i := range geo.children {
+				child, err := readWKBGeometry(r, depth+1)
+				if nil != err {
+					return nil, errors.Trace(err)
+				}
+				// Elements of multi geometries must be the single geometries of the type
+				if wkbGeometryCollection != kind && kind-3 != child.kind {
+					return nil, errors.Errorf("invalid wkb type %d in type %d", child.kind, kind)
+				}
+				geo.children[i] = child
+			}
+		}
+	default:
+		{
+			return nil, errors.Errorf("unknown wkb type %d", kind)
+		}
+	}
+	return geo, nil
+}
+
+func writeWKTPoints(b *strings.Builder, points [][2]float64) {
+	b.WriteByte('(')
+	for i, p := range points {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(p[0], 'g', -1, 64))
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatFloat(p[1], 'g', -1, 64))
+	}
+	b.WriteByte(')')
+}
+
+// writeWKT writes the text of the geometry, the type name is omitted for the elements
+// of multi geometries
+func (g *wkbGeometry) writeWKT(b *strings.Builder, withName bool) {
+	if withName {
+		b.WriteString(wkbTypeNames[g.kind][0])
+	}
+	switch g.kind {
+	case wkbPoint, wkbLineString:
+		{
+			writeWKTPoints(b, g.points)
+		}
+	case wkbPolygon:
+		{
+			b.WriteByte('(')
+			for i, ring := range g.rings {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				writeWKTPoints(b, ring)
+			}
+			b.WriteByte(')')
+		}
+	default:
+		{
+			b.WriteByte('(')
+			for i, child := range g.children {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				child.writeWKT(b, wkbGeometryCollection == g.kind)
+			}
+			b.WriteByte(')')
+		}
+	}
+}
+
+// coordinates returns the GeoJSON coordinates of the geometry except collections
+func (g *wkbGeometry) coordinates() interface{} {
+	switch g.kind {
+	case wkbPoint:
+		{
+			return g.points[0][:]
+		}
+	case wkbLineString:
+		{
+			return g.points
+		}
+	case wkbPolygon:
+		{
+			return g.rings
+		}
+	}
+	coords := make([]interface{}, 0, len(g.children))
+	for _, child := range g.children {
+		coords = append(coords, child.coordinates())
+	}
+	return coords
+}
+
+func (g *wkbGeometry) geoJSON() map[string]interface{} {
+	obj := map[string]interface{}{"type": wkbTypeNames[g.kind][1]}
+	if wkbGeometryCollection != g.kind {
+		obj["coordinates"] = g.coordinates()
+		return obj
+	}
+	geometries := make([]interface{}, 0, len(g.children))
+	for _, child := range g.children {
+		geometries = append(geometries, child.geoJSON())
+	}
+	obj["geometries"] = geometries
+	return obj
+}
@@ -0,0 +1,101 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/sryanyuan/binp/mconn"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+// wkb builds the little endian wkb, elements are the float64 coordinates, uint32 counts
+// and nested wkb bytes
+func wkb(kind uint32, elems ...interface{}) []byte {
+	buf := []byte{1}
+	buf = binary.LittleEndian.AppendUint32(buf, kind)
+	for _, elem := range elems {
+		switch v := elem.(type) {
+		case float64:
+			{
+				buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+			}
+		case int:
+			{
+				buf = binary.LittleEndian.AppendUint32(buf, uint32(v))
+			}
+		case []byte:
+			{
+				buf = append(buf, v...)
+			}
+		}
+	}
+	return buf
+}
+
+func TestDecodeGeometry(t *testing.T) {
+	point := wkb(wkbPoint, 1.0, -2.5)
+	line := wkb(wkbLineString, 2, 0.0, 0.0, 1.0, 1.0)
+	polygon := wkb(wkbPolygon, 2,
+		4, 0.0, 0.0, 4.0, 0.0, 4.0, 4.0, 0.0, 0.0,
+		4, 1.0, 1.0, 2.0, 1.0, 2.0, 2.0, 1.0, 1.0)
+	// Big endian point in the collection
+	bePoint := []byte{0, 0, 0, 0, 1}
+	bePoint = binary.BigEndian.AppendUint64(bePoint, math.Float64bits(3))
+	bePoint = binary.BigEndian.AppendUint64(bePoint, math.Float64bits(4))
+
+	cases := []struct {
+		wkb     []byte
+		wkt     string
+		geoJSON string
+	}{
+		{point, "POINT(1 -2.5)", `{"coordinates":[1,-2.5],"type":"Point"}`},
+		{line, "LINESTRING(0 0,1 1)", `{"coordinates":[[0,0],[1,1]],"type":"LineString"}`},
+		{polygon, "POLYGON((0 0,4 0,4 4,0 0),(1 1,2 1,2 2,1 1))",
+			`{"coordinates":[[[0,0],[4,0],[4,4],[0,0]],[[1,1],[2,1],[2,2],[1,1]]],"type":"Polygon"}`},
+		{wkb(wkbMultiPoint, 2, point, bePoint), "MULTIPOINT((1 -2.5),(3 4))",
+			`{"coordinates":[[1,-2.5],[3,4]],"type":"MultiPoint"}`},
+		{wkb(wkbMultiPolygon, 1, polygon), "MULTIPOLYGON(((0 0,4 0,4 4,0 0),(1 1,2 1,2 2,1 1)))",
+			`{"coordinates":[[[[0,0],[4,0],[4,4],[0,0]],[[1,1],[2,1],[2,2],[1,1]]]],"type":"MultiPolygon"}`},
+		{wkb(wkbGeometryCollection, 2, bePoint, wkb(wkbGeometryCollection, 1, line)),
+			"GEOMETRYCOLLECTION(POINT(3 4),GEOMETRYCOLLECTION(LINESTRING(0 0,1 1)))",
+			`{"geometries":[{"coordinates":[3,4],"type":"Point"},{"geometries":[{"coordinates":[[0,0],[1,1]],"type":"LineString"}],"type":"GeometryCollection"}],"type":"GeometryCollection"}`},
+	}
+	for _, c := range cases {
+		raw := binary.LittleEndian.AppendUint32(nil, 4326)
+		raw = append(raw, c.wkb...)
+		w := serialize.NewBinWriter(nil)
+		w.WriteUint32(uint32(len(raw)))
+		w.WriteBytes(raw)
+		v, err := readValue(serialize.NewBinReader(w.Bytes()), mconn.FieldTypeGeometry, 4)
+		if nil != err {
+			t.Fatal(err)
+		}
+		g := v.(Geometry)
+		if 4326 != g.SRID {
+			t.Errorf("unexpected srid %d", g.SRID)
+		}
+		if wkt, err := g.WKT(); nil != err || c.wkt != wkt {
+			t.Errorf("unexpected wkt %s, want %s, err %v", wkt, c.wkt, err)
+		}
+		if data, err := g.GeoJSON(); nil != err || c.geoJSON != string(data) {
+			t.Errorf("unexpected geojson %s, want %s, err %v", data, c.geoJSON, err)
+		}
+		// The mysql executor gets the raw value
+		if dv, err := g.Value(); nil != err || !bytes.Equal(raw, dv.([]byte)) {
+			t.Errorf("unexpected raw value of %s", c.wkt)
+		}
+	}
+
+	for _, data := range [][]byte{
+		wkb(8),
+		wkb(wkbMultiPoint, 1, line),
+		wkb(wkbLineString, 1000, 0.0, 0.0),
+		append(point, 0),
+	} {
+		if _, err := (Geometry{WKB: data}).WKT(); nil == err {
+			t.Errorf("invalid wkb %x is parsed", data)
+		}
+	}
+}
@@ -14,9 +14,29 @@ type GTIDEvent struct {
 	CommitFlag uint8
 	SID        []byte
 	GNO        int64
+	// Logical clock of mysql 5.7+, transactions can be applied in parallel if the
+	// last committed is less than the sequence numbers of each other
+	LastCommitted  int64
+	SequenceNumber int64
+	// Commit timestamps in microseconds and the transaction length of mysql 8.0+
+	ImmediateCommitTimestamp uint64
+	OriginalCommitTimestamp  uint64
+	TransactionLength        uint64
+	// Server versions of mysql 8.0.14+
+	ImmediateServerVersion uint32
+	OriginalServerVersion  uint32
 }
 
-// Decode decodes the binary data into payload
+const (
+	// logicalTimestampTypeCode is the type code before the logical clock
+	logicalTimestampTypeCode = 2
+	// The highest bit of the immediate value is set if the original value follows
+	encodedCommitTimestampLength = 7
+	commitTimestampOriginalFlag  = uint64(1) << 55
+	serverVersionOriginalFlag    = uint32(1) << 31
+)
+
+// Decode decodes the binary data into payload, fields are optional by mysql versions
 func (e *GTIDEvent) Decode(data []byte) error {
 	r := serialize.NewBinReader(data)
 	var err error
@@ -32,14 +52,78 @@ func (e *GTIDEvent) Decode(data []byte) error {
 	if nil != err {
 		return errors.Trace(err)
 	}
+	if r.Empty() {
+		r.End()
+		return nil
+	}
+
+	tp, err := r.ReadUint8()
+	if nil != err {
+		return errors.Trace(err)
+	}
+	if logicalTimestampTypeCode != tp {
+		return errors.Errorf("unknown gtid logical timestamp type code %d", tp)
+	}
+	if e.LastCommitted, err = r.ReadInt64(); nil != err {
+		return errors.Trace(err)
+	}
+	if e.SequenceNumber, err = r.ReadInt64(); nil != err {
+		return errors.Trace(err)
+	}
+	if r.Empty() {
+		r.End()
+		return nil
+	}
+
+	if e.ImmediateCommitTimestamp, err = readCommitTimestamp(r); nil != err {
+		return errors.Trace(err)
+	}
+	e.OriginalCommitTimestamp = e.ImmediateCommitTimestamp
+	if 0 != e.ImmediateCommitTimestamp&commitTimestampOriginalFlag {
+		e.ImmediateCommitTimestamp &^= commitTimestampOriginalFlag
+		if e.OriginalCommitTimestamp, err = readCommitTimestamp(r); nil != err {
+			return errors.Trace(err)
+		}
+	}
+	if r.Empty() {
+		r.End()
+		return nil
+	}
+
+	if e.TransactionLength, err = r.ReadLenencInt(); nil != err {
+		return errors.Trace(err)
+	}
+	if r.Empty() {
+		r.End()
+		return nil
+	}
+
+	if e.ImmediateServerVersion, err = r.ReadUint32(); nil != err {
+		return errors.Trace(err)
+	}
+	e.OriginalServerVersion = e.ImmediateServerVersion
+	if 0 != e.ImmediateServerVersion&serverVersionOriginalFlag {
+		e.ImmediateServerVersion &^= serverVersionOriginalFlag
+		if e.OriginalServerVersion, err = r.ReadUint32(); nil != err {
+			return errors.Trace(err)
+		}
+	}
 	r.End()
 	return nil
 }
 
+func readCommitTimestamp(r *serialize.BinReader) (uint64, error) {
+	b, err := r.ReadBytes(encodedCommitTimestampLength)
+	if nil != err {
+		return 0, errors.Trace(err)
+	}
+	return serialize.NumberFromBytesLittleEndian(b), nil
+}
+
 func (e *GTIDEvent) String() string {
 	u, err := uuid.FromBytes(e.SID)
 	if nil != err {
 		return fmt.Sprintf("N/A: %s", err.Error())
 	}
-	return fmt.Sprintf("%s:1-%d", u.String(), e.GNO)
+	return fmt.Sprintf("%s:%d", u.String(), e.GNO)
 }
@@ -0,0 +1,64 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/sryanyuan/binp/serialize"
+)
+
+func TestGTIDEventLogicalClock(t *testing.T) {
+	header := func() *serialize.BinWriter {
+		w := serialize.NewBinWriter(nil)
+		w.WriteUint8(1)
+		w.WriteBytes(make([]byte, 16))
+		w.WriteInt64(7)
+		return w
+	}
+
+	// mysql 5.6
+	var e GTIDEvent
+	if err := e.Decode(header().Bytes()); nil != err || 7 != e.GNO || 0 != e.SequenceNumber {
+		t.Fatalf("unexpected gtid event %+v, err %v", e, err)
+	}
+
+	// mysql 5.7
+	w := header()
+	w.WriteUint8(logicalTimestampTypeCode)
+	w.WriteInt64(10)
+	w.WriteInt64(12)
+	e = GTIDEvent{}
+	if err := e.Decode(w.Bytes()); nil != err || 10 != e.LastCommitted || 12 != e.SequenceNumber {
+		t.Fatalf("unexpected gtid event %+v, err %v", e, err)
+	}
+
+	// mysql 8.0 with the original commit timestamp and server version
+	w.WriteBytes([]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x80})
+	w.WriteBytes([]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x00})
+	w.WriteLenencInt(300)
+	w.WriteUint32(80030 | serverVersionOriginalFlag)
+	w.WriteUint32(80025)
+	e = GTIDEvent{}
+	if err := e.Decode(w.Bytes()); nil != err {
+		t.Fatal(err)
+	}
+	if 0x060504030201 != e.ImmediateCommitTimestamp || 0x060504030201 != e.OriginalCommitTimestamp ||
+		300 != e.TransactionLength || 80030 != e.ImmediateServerVersion || 80025 != e.OriginalServerVersion {
+		t.Errorf("unexpected gtid event %+v", e)
+	}
+
+	// The original values are the immediate values if the flags are not set
+	w = header()
+	w.WriteUint8(logicalTimestampTypeCode)
+	w.WriteInt64(10)
+	w.WriteInt64(12)
+	w.WriteBytes([]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x00})
+	w.WriteLenencInt(300)
+	w.WriteUint32(80030)
+	e = GTIDEvent{}
+	if err := e.Decode(w.Bytes()); nil != err {
+		t.Fatal(err)
+	}
+	if e.ImmediateCommitTimestamp != e.OriginalCommitTimestamp || 80030 != e.OriginalServerVersion {
+		t.Errorf("unexpected gtid event %+v", e)
+	}
+}
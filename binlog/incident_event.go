@@ -0,0 +1,36 @@
+package binlog
+
+import (
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+// Types of the incident event
+const (
+	IncidentNone = iota
+	IncidentLostEvents
+)
+
+// IncidentEvent is written if something happened on the master may make the replica
+// inconsistent, e.g. events are lost
+// https://dev.mysql.com/doc/internals/en/incident-event.html
+type IncidentEvent struct {
+	Type    uint16
+	Message string
+}
+
+// Decode decodes the binary data into payload
+func (e *IncidentEvent) Decode(data []byte) error {
+	var err error
+	r := serialize.NewBinReader(data)
+	if e.Type, err = r.ReadUint16(); nil != err {
+		return errors.Trace(err)
+	}
+	if !r.Empty() {
+		if e.Message, err = r.ReadLenString(); nil != err {
+			return errors.Trace(err)
+		}
+	}
+	r.End()
+	return nil
+}
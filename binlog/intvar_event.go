@@ -0,0 +1,33 @@
+package binlog
+
+import (
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+// Types of the intvar event
+const (
+	IntvarTypeLastInsertID = iota + 1
+	IntvarTypeInsertID
+)
+
+// IntvarEvent has the auto increment value used by the next statement
+// https://dev.mysql.com/doc/internals/en/intvar-event.html
+type IntvarEvent struct {
+	Type  uint8
+	Value uint64
+}
+
+// Decode decodes the binary data into payload
+func (e *IntvarEvent) Decode(data []byte) error {
+	var err error
+	r := serialize.NewBinReader(data)
+	if e.Type, err = r.ReadUint8(); nil != err {
+		return errors.Trace(err)
+	}
+	if e.Value, err = r.ReadUint64(); nil != err {
+		return errors.Trace(err)
+	}
+	r.End()
+	return nil
+}
@@ -1,14 +1,276 @@
 package binlog
 
 import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
 	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/mconn"
 	"github.com/sryanyuan/binp/serialize"
 )
 
+// decodeJSON reads the json column as the json text, meta is the bytes of the length like blobs
 func decodeJSON(r *serialize.BinReader, meta uint16) (interface{}, error) {
-	l, err := r.ReadUint16()
+	doc, err := readJSONDocument(r, meta)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	v, err := formatJSON(doc)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	return v, nil
+}
+
+// readJSONDocument reads the json column as the decoded go value
+func readJSONDocument(r *serialize.BinReader, meta uint16) (interface{}, error) {
+	v, err := decodeBlob(r, meta)
 	if nil != err {
 		return nil, errors.Trace(err)
 	}
-	return readBlob(r, int(l))
+	doc, err := decodeJSONBinary(v.([]byte))
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	return doc, nil
+}
+
+// formatJSON formats the decoded json value like the mysql json output, separators
+// are followed by a space and object keys are sorted as they are stored
+func formatJSON(v interface{}) (string, error) {
+	var b strings.Builder
+	if err := writeJSON(&b, v); nil != err {
+		return "", errors.Trace(err)
+	}
+	return b.String(), nil
+}
+
+func writeJSON(b *strings.Builder, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		{
+			b.WriteString("null")
+		}
+	case bool:
+		{
+			b.WriteString(strconv.FormatBool(v))
+		}
+	case int64:
+		{
+			b.WriteString(strconv.FormatInt(v, 10))
+		}
+	case uint64:
+		{
+			b.WriteString(strconv.FormatUint(v, 10))
+		}
+	case float64:
+		{
+			b.WriteString(formatJSONDouble(v))
+		}
+	case string:
+		{
+			writeJSONString(b, v)
+		}
+	case JSONOpaque:
+		{
+			return errors.Trace(writeJSONOpaque(b, v))
+		}
+	case []interface{}:
+		{
+			b.WriteByte('[')
+			for i, elem := range v {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				if err := writeJSON(b, elem); nil != err {
+					return errors.Trace(err)
+				}
+			}
+			b.WriteByte(']')
+		}
+	case map[string]interface{}:
+		{
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Slice(keys, func(i, j int) bool {
+				if len(keys[i]) != len(keys[j]) {
+					return len(keys[i]) < len(keys[j])
+				}
+				return keys[i] < keys[j]
+			})
+			b.WriteByte('{')
+			for i, key := range keys {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				writeJSONString(b, key)
+				b.WriteString(": ")
+				if err := writeJSON(b, v[key]); nil != err {
+					return errors.Trace(err)
+				}
+			}
+			b.WriteByte('}')
+		}
+	default:
+		{
+			return errors.Errorf("unsupported json value type %T", v)
+		}
+	}
+	return nil
+}
+
+// formatJSONDouble formats the double like mysql, the scientific notation is used for
+// very large or small values, and ".0" is appended if the value looks like an integer
+func formatJSONDouble(v float64) string {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	s := strconv.FormatFloat(v, 'e', -1, 64)
+	i := strings.IndexByte(s, 'e')
+	exp, _ := strconv.Atoi(s[i+1:])
+	if exp < -4 || exp >= 15 {
+		// 1.5e-07 is written as 1.5e-7
+		return s[:i+1] + strconv.Itoa(exp)
+	}
+	s = strconv.FormatFloat(v, 'f', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+func writeJSONString(b *strings.Builder, s string) {
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if utf8.RuneError == r && 1 == size {
+				b.WriteString("\ufffd")
+			} else {
+				b.WriteString(s[i : i+size])
+			}
+			i += size
+			continue
+		}
+		switch c {
+		case '"':
+			{
+				b.WriteString(`\"`)
+			}
+		case '\\':
+			{
+				b.WriteString(`\\`)
+			}
+		case '\b':
+			{
+				b.WriteString(`\b`)
+			}
+		case '\f':
+			{
+				b.WriteString(`\f`)
+			}
+		case '\n':
+			{
+				b.WriteString(`\n`)
+			}
+		case '\r':
+			{
+				b.WriteString(`\r`)
+			}
+		case '\t':
+			{
+				b.WriteString(`\t`)
+			}
+		default:
+			{
+				if c < 0x20 {
+					fmt.Fprintf(b, `\u%04x`, c)
+				} else {
+					b.WriteByte(c)
+				}
+			}
+		}
+		i++
+	}
+	b.WriteByte('"')
+}
+
+// writeJSONOpaque writes the mysql typed value, temporal values are quoted strings with
+// microseconds, decimals are exact numbers and other values are base64 encoded like mysql
+func writeJSONOpaque(b *strings.Builder, v JSONOpaque) error {
+	switch v.Type {
+	case mconn.FieldTypeDate, mconn.FieldTypeNewDate, mconn.FieldTypeDateTime, mconn.FieldTypeDateTime2,
+		mconn.FieldTypeTimestamp, mconn.FieldTypeTimestamp2:
+		{
+			if len(v.Data) < 8 {
+				return errors.New("json datetime overflow")
+			}
+			s := formatPackedDatetime(int64(binary.LittleEndian.Uint64(v.Data)))
+			if mconn.FieldTypeDate == v.Type || mconn.FieldTypeNewDate == v.Type {
+				s = s[:10]
+			}
+			writeJSONString(b, s)
+		}
+	case mconn.FieldTypeTime, mconn.FieldTypeTime2:
+		{
+			if len(v.Data) < 8 {
+				return errors.New("json time overflow")
+			}
+			writeJSONString(b, formatPackedTime(int64(binary.LittleEndian.Uint64(v.Data))))
+		}
+	case mconn.FieldTypeNewDecimal:
+		{
+			if len(v.Data) < 2 {
+				return errors.New("json decimal overflow")
+			}
+			d, err := decodeDecimal(serialize.NewBinReader(v.Data[2:]), int(v.Data[0]), int(v.Data[1]))
+			if nil != err {
+				return errors.Trace(err)
+			}
+			b.WriteString(d)
+		}
+	default:
+		{
+			writeJSONString(b, fmt.Sprintf("base64:type%d:%s", v.Type, base64.StdEncoding.EncodeToString(v.Data)))
+		}
+	}
+	return nil
+}
+
+// formatPackedDatetime formats the packed datetime of mysql, see TIME_from_longlong_datetime_packed
+func formatPackedDatetime(packed int64) string {
+	sign := ""
+	if packed < 0 {
+		sign = "-"
+		packed = -packed
+	}
+	frac := packed % (1 << 24)
+	ymdhms := packed >> 24
+	ymd := ymdhms >> 17
+	ym := ymd >> 5
+	hms := ymdhms % (1 << 17)
+	return fmt.Sprintf("%s%04d-%02d-%02d %02d:%02d:%02d.%06d", sign,
+		ym/13, ym%13, ymd%(1<<5), hms>>12, (hms>>6)%(1<<6), hms%(1<<6), frac)
+}
+
+// formatPackedTime formats the packed time of mysql, see TIME_from_longlong_time_packed
+func formatPackedTime(packed int64) string {
+	sign := ""
+	if packed < 0 {
+		sign = "-"
+		packed = -packed
+	}
+	frac := packed % (1 << 24)
+	hms := packed >> 24
+	return fmt.Sprintf("%s%02d:%02d:%02d.%06d", sign,
+		(hms>>12)%(1<<10), (hms>>6)%(1<<6), hms%(1<<6), frac)
 }
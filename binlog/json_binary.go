@@ -0,0 +1,258 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/juju/errors"
+)
+
+// Value types of the mysql binary json
+// https://github.com/mysql/mysql-server/blob/8.0/sql/json_binary.h
+const (
+	jsonTypeSmallObject = 0x00
+	jsonTypeLargeObject = 0x01
+	jsonTypeSmallArray  = 0x02
+	jsonTypeLargeArray  = 0x03
+	jsonTypeLiteral     = 0x04
+	jsonTypeInt16       = 0x05
+	jsonTypeUint16      = 0x06
+	jsonTypeInt32       = 0x07
+	jsonTypeUint32      = 0x08
+	jsonTypeInt64       = 0x09
+	jsonTypeUint64      = 0x0a
+	jsonTypeDouble      = 0x0b
+	jsonTypeString      = 0x0c
+	jsonTypeOpaque      = 0x0f
+)
+
+// Literal values of the mysql binary json
+const (
+	jsonLiteralNull  = 0x00
+	jsonLiteralTrue  = 0x01
+	jsonLiteralFalse = 0x02
+)
+
+// JSONOpaque is a value of the mysql type inside the json, like DATETIME and DECIMAL
+type JSONOpaque struct {
+	// Type is the mconn.FieldType* of the value
+	Type uint8
+	Data []byte
+}
+
+// decodeJSONBinary decodes the mysql binary json document into go values. Objects are
+// map[string]interface{}, arrays are []interface{}, the json null is nil, integers are
+// int64 or uint64, doubles are float64 and mysql typed values are JSONOpaque
+func decodeJSONBinary(data []byte) (interface{}, error) {
+	// An empty value is the json null, it is written for the empty string of a json column
+	if 0 == len(data) {
+		return nil, nil
+	}
+	return decodeJSONValue(data[0], data[1:])
+}
+
+func decodeJSONValue(tp uint8, data []byte) (interface{}, error) {
+	switch tp {
+	case jsonTypeSmallObject, jsonTypeLargeObject, jsonTypeSmallArray, jsonTypeLargeArray:
+		{
+			large := jsonTypeLargeObject == tp || jsonTypeLargeArray == tp
+			object := jsonTypeSmallObject == tp || jsonTypeLargeObject == tp
+			return decodeJSONContainer(data, large, object)
+		}
+	case jsonTypeLiteral:
+		{
+			if len(data) < 1 {
+				return nil, errors.New("json literal overflow")
+			}
+			switch data[0] {
+			case jsonLiteralNull:
+				{
+					return nil, nil
+				}
+			case jsonLiteralTrue:
+				{
+					return true, nil
+				}
+			case jsonLiteralFalse:
+				{
+					return false, nil
+				}
+			}
+			return nil, errors.Errorf("unknown json literal %d", data[0])
+		}
+	case jsonTypeInt16, jsonTypeUint16:
+		{
+			if len(data) < 2 {
+				return nil, errors.New("json int16 overflow")
+			}
+			v := binary.LittleEndian.Uint16(data)
+			if jsonTypeInt16 == tp {
+				return int64(int16(v)), nil
+			}
+			return uint64(v), nil
+		}
+	case jsonTypeInt32, jsonTypeUint32:
+		{
+			if len(data) < 4 {
+				return nil, errors.New("json int32 overflow")
+			}
+			v := binary.LittleEndian.Uint32(data)
+			if jsonTypeInt32 == tp {
+				return int64(int32(v)), nil
+			}
+			return uint64(v), nil
+		}
+	case jsonTypeInt64, jsonTypeUint64, jsonTypeDouble:
+		{
+			if len(data) < 8 {
+				return nil, errors.New("json int64 overflow")
+			}
+			v := binary.LittleEndian.Uint64(data)
+			if jsonTypeInt64 == tp {
+				return int64(v), nil
+			}
+			if jsonTypeDouble == tp {
+				return math.Float64frombits(v), nil
+			}
+			return v, nil
+		}
+	case jsonTypeString:
+		{
+			l, n, err := readJSONVarLen(data)
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			if n+l > len(data) {
+				return nil, errors.New("json string overflow")
+			}
+			return string(data[n : n+l]), nil
+		}
+	case jsonTypeOpaque:
+		{
+			if len(data) < 1 {
+				return nil, errors.New("json opaque overflow")
+			}
+			l, n, err := readJSONVarLen(data[1:])
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			if 1+n+l > len(data) {
+				return nil, errors.New("json opaque overflow")
+			}
+			v := make([]byte, l)
+			copy(v, data[1+n:])
+			return JSONOpaque{Type: data[0], Data: v}, nil
+		}
+	}
+	return nil, errors.Errorf("unknown json type %d", tp)
+}
+
+// decodeJSONContainer decodes the object or the array, offsets are relative to the container
+func decodeJSONContainer(data []byte, large bool, object bool) (interface{}, error) {
+	offsetSize := 2
+	if large {
+		offsetSize = 4
+	}
+	readOffset := func(b []byte) int {
+		if large {
+			return int(binary.LittleEndian.Uint32(b))
+		}
+		return int(binary.LittleEndian.Uint16(b))
+	}
+	if len(data) < 2*offsetSize {
+		return nil, errors.New("json container header overflow")
+	}
+	count := readOffset(data)
+	size := readOffset(data[offsetSize:])
+	if size > len(data) {
+		return nil, errors.Errorf("json container size %d overflow", size)
+	}
+	data = data[:size]
+
+	valueEntrySize := 1 + offsetSize
+	keyEntrySize := 0
+	if object {
+		keyEntrySize = offsetSize + 2
+	}
+	if 2*offsetSize+count*(keyEntrySize+valueEntrySize) > size {
+		return nil, errors.Errorf("json container entries overflow, count %d", count)
+	}
+
+	var obj map[string]interface{}
+	var arr []interface{}
+	if object {
+		obj = make(map[string]interface{}, count)
+	} else {
+		arr = make([]interface{}, 0, count)
+	}
+	for i := 0; i < count; i++ {
+		var key string
+		if object {
+			entry := data[2*offsetSize+i*keyEntrySize:]
+			keyOffset := readOffset(entry)
+			keyLength := int(binary.LittleEndian.Uint16(entry[offsetSize:]))
+			if keyOffset+keyLength > size {
+				return nil, errors.New("json object key overflow")
+			}
+			key = string(data[keyOffset : keyOffset+keyLength])
+		}
+
+		entry := data[2*offsetSize+count*keyEntrySize+i*valueEntrySize:]
+		tp := entry[0]
+		var v interface{}
+		var err error
+		if isJSONInlined(tp, large) {
+			v, err = decodeJSONValue(tp, entry[1:1+offsetSize])
+		} else {
+			valueOffset := readOffset(entry[1:])
+			if valueOffset >= size {
+				return nil, errors.New("json value overflow")
+			}
+			v, err = decodeJSONValue(tp, data[valueOffset:])
+		}
+		if nil != err {
+			return nil, errors.Trace(err)
+		}
+
+		if object {
+			obj[key] = v
+		} else {
+			arr = append(arr, v)
+		}
+	}
+	if object {
+		return obj, nil
+	}
+	return arr, nil
+}
+
+// isJSONInlined returns true if the value is stored in the value entry
+func isJSONInlined(tp uint8, large bool) bool {
+	switch tp {
+	case jsonTypeLiteral, jsonTypeInt16, jsonTypeUint16:
+		{
+			return true
+		}
+	case jsonTypeInt32, jsonTypeUint32:
+		{
+			return large
+		}
+	}
+	return false
+}
+
+// readJSONVarLen reads the variable length of strings, 7 bits per byte and the high
+// bit tells whether more bytes follow
+func readJSONVarLen(data []byte) (int, int, error) {
+	var l uint64
+	for i := 0; i < 5 && i < len(data); i++ {
+		l |= uint64(data[i]&0x7f) << uint(7*i)
+		if 0 == data[i]&0x80 {
+			if l > math.MaxUint32 {
+				return 0, 0, errors.New("json variable length overflow")
+			}
+			return int(l), i + 1, nil
+		}
+	}
+	return 0, 0, errors.New("invalid json variable length")
+}
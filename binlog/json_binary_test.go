@@ -0,0 +1,273 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/juju/errors"
+)
+
+func appendJSONVarLen(b []byte, l int) []byte {
+	for {
+		if l < 0x80 {
+			return append(b, byte(l))
+		}
+		b = append(b, byte(l&0x7f)|0x80)
+		l >>= 7
+	}
+}
+
+// encodeJSONBinary encodes the go value into the mysql binary json, values are the
+// same as the decoded, and the go integers and float32 are accepted as well
+func encodeJSONBinary(v interface{}) ([]byte, error) {
+	tp, data, err := encodeJSONValue(v)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	return append([]byte{tp}, data...), nil
+}
+
+func encodeJSONValue(v interface{}) (uint8, []byte, error) {
+	switch v := v.(type) {
+	case nil:
+		{
+			return jsonTypeLiteral, []byte{jsonLiteralNull}, nil
+		}
+	case bool:
+		{
+			if v {
+				return jsonTypeLiteral, []byte{jsonLiteralTrue}, nil
+			}
+			return jsonTypeLiteral, []byte{jsonLiteralFalse}, nil
+		}
+	case int:
+		{
+			return encodeJSONInt(int64(v))
+		}
+	case int8:
+		{
+			return encodeJSONInt(int64(v))
+		}
+	case int16:
+		{
+			return encodeJSONInt(int64(v))
+		}
+	case int32:
+		{
+			return encodeJSONInt(int64(v))
+		}
+	case int64:
+		{
+			return encodeJSONInt(v)
+		}
+	case uint:
+		{
+			return encodeJSONUint(uint64(v))
+		}
+	case uint8:
+		{
+			return encodeJSONUint(uint64(v))
+		}
+	case uint16:
+		{
+			return encodeJSONUint(uint64(v))
+		}
+	case uint32:
+		{
+			return encodeJSONUint(uint64(v))
+		}
+	case uint64:
+		{
+			return encodeJSONUint(v)
+		}
+	case float32:
+		{
+			return encodeJSONDouble(float64(v))
+		}
+	case float64:
+		{
+			return encodeJSONDouble(v)
+		}
+	case string:
+		{
+			return jsonTypeString, append(appendJSONVarLen(nil, len(v)), v...), nil
+		}
+	case JSONOpaque:
+		{
+			data := appendJSONVarLen([]byte{v.Type}, len(v.Data))
+			return jsonTypeOpaque, append(data, v.Data...), nil
+		}
+	case map[string]interface{}:
+		{
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			// Keys are sorted by the length and then the bytes like mysql
+			sort.Slice(keys, func(i, j int) bool {
+				if len(keys[i]) != len(keys[j]) {
+					return len(keys[i]) < len(keys[j])
+				}
+				return keys[i] < keys[j]
+			})
+			values := make([]interface{}, len(keys))
+			for i, key := range keys {
+				values[i] = v[key]
+			}
+			return encodeJSONContainer(keys, values)
+		}
+	case []interface{}:
+		{
+			return encodeJSONContainer(nil, v)
+		}
+	}
+	return 0, nil, errors.Errorf("unsupported json value type %T", v)
+}
+
+func encodeJSONInt(v int64) (uint8, []byte, error) {
+	if v >= math.MinInt16 && v <= math.MaxInt16 {
+		data := make([]byte, 2)
+		binary.LittleEndian.PutUint16(data, uint16(v))
+		return jsonTypeInt16, data, nil
+	}
+	if v >= math.MinInt32 && v <= math.MaxInt32 {
+		data := make([]byte, 4)
+		binary.LittleEndian.PutUint32(data, uint32(v))
+		return jsonTypeInt32, data, nil
+	}
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, uint64(v))
+	return jsonTypeInt64, data, nil
+}
+
+func encodeJSONUint(v uint64) (uint8, []byte, error) {
+	if v <= math.MaxUint16 {
+		data := make([]byte, 2)
+		binary.LittleEndian.PutUint16(data, uint16(v))
+		return jsonTypeUint16, data, nil
+	}
+	if v <= math.MaxUint32 {
+		data := make([]byte, 4)
+		binary.LittleEndian.PutUint32(data, uint32(v))
+		return jsonTypeUint32, data, nil
+	}
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, v)
+	return jsonTypeUint64, data, nil
+}
+
+func encodeJSONDouble(v float64) (uint8, []byte, error) {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, math.Float64bits(v))
+	return jsonTypeDouble, data, nil
+}
+
+// encodeJSONContainer encodes the object if keys are not nil, or the array. The small
+// format is used unless offsets overflow 16 bits
+func encodeJSONContainer(keys []string, values []interface{}) (uint8, []byte, error) {
+	types := make([]uint8, len(values))
+	datas := make([][]byte, len(values))
+	for i, v := range values {
+		var err error
+		if types[i], datas[i], err = encodeJSONValue(v); nil != err {
+			return 0, nil, errors.Trace(err)
+		}
+	}
+
+	if data, ok := encodeJSONEntries(keys, types, datas, false); ok {
+		if nil != keys {
+			return jsonTypeSmallObject, data, nil
+		}
+		return jsonTypeSmallArray, data, nil
+	}
+	data, ok := encodeJSONEntries(keys, types, datas, true)
+	if !ok {
+		return 0, nil, errors.New("json container is too large")
+	}
+	if nil != keys {
+		return jsonTypeLargeObject, data, nil
+	}
+	return jsonTypeLargeArray, data, nil
+}
+
+// encodeJSONEntries lays out the container, returns false if the offset overflows
+func encodeJSONEntries(keys []string, types []uint8, datas [][]byte, large bool) ([]byte, bool) {
+	offsetSize := 2
+	maxOffset := math.MaxUint16
+	if large {
+		offsetSize = 4
+		maxOffset = math.MaxUint32
+	}
+	putOffset := func(b []byte, v int) {
+		if large {
+			binary.LittleEndian.PutUint32(b, uint32(v))
+		} else {
+			binary.LittleEndian.PutUint16(b, uint16(v))
+		}
+	}
+
+	count := len(types)
+	keyEntrySize := 0
+	if nil != keys {
+		keyEntrySize = offsetSize + 2
+	}
+	headerSize := 2*offsetSize + count*(keyEntrySize+1+offsetSize)
+	size := headerSize
+	for _, key := range keys {
+		if len(key) > math.MaxUint16 {
+			return nil, false
+		}
+		size += len(key)
+	}
+	for i := range datas {
+		if !isJSONInlined(types[i], large) {
+			size += len(datas[i])
+		}
+	}
+	if size > maxOffset || count > maxOffset {
+		return nil, false
+	}
+
+	data := make([]byte, headerSize, size)
+	putOffset(data, count)
+	putOffset(data[offsetSize:], size)
+	for i, key := range keys {
+		entry := data[2*offsetSize+i*keyEntrySize:]
+		putOffset(entry, len(data))
+		binary.LittleEndian.PutUint16(entry[offsetSize:], uint16(len(key)))
+		data = append(data, key...)
+	}
+	for i := range datas {
+		entry := data[2*offsetSize+count*keyEntrySize+i*(1+offsetSize):]
+		entry[0] = types[i]
+		if isJSONInlined(types[i], large) {
+			copy(entry[1:1+offsetSize], datas[i])
+			continue
+		}
+		putOffset(entry[1:], len(data))
+		data = append(data, datas[i]...)
+	}
+	return data, true
+}
+
+func TestJSONBinaryLargeContainer(t *testing.T) {
+	// Offsets of the large string overflow the small format
+	v := []interface{}{
+		string(make([]byte, 70000)),
+		map[string]interface{}{"n": int64(1 << 20), "u": uint64(1 << 63)},
+	}
+	data := mustEncodeJSON(t, v)
+	if jsonTypeLargeArray != data[0] {
+		t.Errorf("unexpected json type %d", data[0])
+	}
+	got, err := decodeJSONBinary(data)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, got) {
+		t.Errorf("unexpected json %v", got)
+	}
+}
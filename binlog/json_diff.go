@@ -0,0 +1,265 @@
+package binlog
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+// Operations of the json diff
+const (
+	jsonDiffReplace = iota
+	jsonDiffInsert
+	jsonDiffRemove
+)
+
+// Options of the partial update rows event after image
+const (
+	rowValueOptionPartialJSON = 0x01
+)
+
+// jsonDiff is a partial update of the json column, see Json_diff_vector::read_binary
+// https://github.com/mysql/mysql-server/blob/8.0/sql/json_diff.cc
+type jsonDiff struct {
+	op   int
+	path string
+	// value is the decoded value of replace and insert
+	value interface{}
+}
+
+// jsonPathLeg is a member or an array index of the json path
+type jsonPathLeg struct {
+	key   string
+	index int
+	isKey bool
+}
+
+// readJSONDiffs reads the json diffs of the partial json column
+func readJSONDiffs(data []byte) ([]*jsonDiff, error) {
+	var diffs []*jsonDiff
+	r := serialize.NewBinReader(data)
+	for !r.Empty() {
+		var diff jsonDiff
+		op, err := r.ReadUint8()
+		if nil != err {
+			return nil, errors.Trace(err)
+		}
+		diff.op = int(op)
+		if diff.op > jsonDiffRemove {
+			return nil, errors.Errorf("unknown json diff operation %d", diff.op)
+		}
+		path, err := r.ReadLenencBytes()
+		if nil != err {
+			return nil, errors.Trace(err)
+		}
+		diff.path = string(path)
+		if jsonDiffRemove != diff.op {
+			value, err := r.ReadLenencBytes()
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			if diff.value, err = decodeJSONBinary(value); nil != err {
+				return nil, errors.Annotatef(err, "decode value of json diff %s", diff.path)
+			}
+		}
+		diffs = append(diffs, &diff)
+	}
+	r.End()
+	return diffs, nil
+}
+
+// applyJSONDiffs applies the diffs to the decoded json document, returns the new document.
+// The document is modified in place
+func applyJSONDiffs(v interface{}, diffs []*jsonDiff) (interface{}, error) {
+	for _, diff := range diffs {
+		legs, err := parseJSONPath(diff.path)
+		if nil != err {
+			return nil, errors.Trace(err)
+		}
+		if v, err = diff.apply(v, legs); nil != err {
+			return nil, errors.Annotatef(err, "apply json diff %d of %s", diff.op, diff.path)
+		}
+	}
+	return v, nil
+}
+
+// apply applies the diff to the node at the path, returns the new node
+func (d *jsonDiff) apply(node interface{}, legs []jsonPathLeg) (interface{}, error) {
+	if 0 == len(legs) {
+		if jsonDiffReplace != d.op {
+			return nil, errors.New("only replace is allowed on the root")
+		}
+		return d.value, nil
+	}
+
+	leg := legs[0]
+	if len(legs) > 1 {
+		child, ok := leg.get(node)
+		if !ok {
+			return nil, errors.New("path not found")
+		}
+		child, err := d.apply(child, legs[1:])
+		if nil != err {
+			return nil, errors.Trace(err)
+		}
+		return leg.set(node, child, false)
+	}
+
+	switch d.op {
+	case jsonDiffReplace:
+		{
+			if _, ok := leg.get(node); !ok {
+				return nil, errors.New("path not found")
+			}
+			return leg.set(node, d.value, false)
+		}
+	case jsonDiffInsert:
+		{
+			return leg.set(node, d.value, true)
+		}
+	}
+	return leg.remove(node)
+}
+
+func (l *jsonPathLeg) get(node interface{}) (interface{}, bool) {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		{
+			if !l.isKey {
+				return nil, false
+			}
+			v, ok := node[l.key]
+			return v, ok
+		}
+	case []interface{}:
+		{
+			if l.isKey || l.index >= len(node) {
+				return nil, false
+			}
+			return node[l.index], true
+		}
+	}
+	return nil, false
+}
+
+// set sets the value at the leg, the value is inserted before the index of arrays or
+// appended if the index is beyond the end if insert is true
+func (l *jsonPathLeg) set(node interface{}, v interface{}, insert bool) (interface{}, error) {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		{
+			if l.isKey {
+				node[l.key] = v
+				return node, nil
+			}
+		}
+	case []interface{}:
+		{
+			if l.isKey {
+				break
+			}
+			if !insert {
+				if l.index >= len(node) {
+					return nil, errors.New("array index out of range")
+				}
+				node[l.index] = v
+				return node, nil
+			}
+			if l.index >= len(node) {
+				return append(node, v), nil
+			}
+			node = append(node, nil)
+			copy(node[l.index+1:], node[l.index:])
+			node[l.index] = v
+			return node, nil
+		}
+	}
+	return nil, errors.Errorf("path leg doesn't match the json value %T", node)
+}
+
+func (l *jsonPathLeg) remove(node interface{}) (interface{}, error) {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		{
+			if _, ok := node[l.key]; l.isKey && ok {
+				delete(node, l.key)
+				return node, nil
+			}
+		}
+	case []interface{}:
+		{
+			if !l.isKey && l.index < len(node) {
+				return append(node[:l.index], node[l.index+1:]...), nil
+			}
+		}
+	}
+	return nil, errors.New("path not found")
+}
+
+// parseJSONPath parses the json path of the diff like $.a[1]."b c", wildcards are not
+// allowed in json diffs
+func parseJSONPath(path string) ([]jsonPathLeg, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, errors.Errorf("invalid json path %s", path)
+	}
+	var legs []jsonPathLeg
+	s := path[1:]
+	for "" != s {
+		switch s[0] {
+		case '.':
+			{
+				s = s[1:]
+				var key string
+				if strings.HasPrefix(s, `"`) {
+					end := 1
+					for ; end < len(s) && '"' != s[end]; end++ {
+						if '\\' == s[end] {
+							end++
+						}
+					}
+					if end >= len(s) {
+						return nil, errors.Errorf("unterminated key of json path %s", path)
+					}
+					v, err := strconv.Unquote(s[:end+1])
+					if nil != err || !utf8.ValidString(v) {
+						return nil, errors.Errorf("invalid key of json path %s", path)
+					}
+					key = v
+					s = s[end+1:]
+				} else {
+					end := strings.IndexAny(s, ".[")
+					if end < 0 {
+						end = len(s)
+					}
+					key = s[:end]
+					s = s[end:]
+				}
+				if "" == key || "*" == key {
+					return nil, errors.Errorf("invalid key of json path %s", path)
+				}
+				legs = append(legs, jsonPathLeg{key: key, isKey: true})
+			}
+		case '[':
+			{
+				end := strings.IndexByte(s, ']')
+				if end < 0 {
+					return nil, errors.Errorf("unterminated index of json path %s", path)
+				}
+				index, err := strconv.Atoi(strings.TrimSpace(s[1:end]))
+				if nil != err || index < 0 {
+					return nil, errors.Errorf("invalid index of json path %s", path)
+				}
+				legs = append(legs, jsonPathLeg{index: index})
+				s = s[end+1:]
+			}
+		default:
+			{
+				return nil, errors.Errorf("invalid json path %s", path)
+			}
+		}
+	}
+	return legs, nil
+}
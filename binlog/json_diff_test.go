@@ -0,0 +1,140 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/sryanyuan/binp/mconn"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+func mustEncodeJSON(t *testing.T, v interface{}) []byte {
+	data, err := encodeJSONBinary(v)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestPartialUpdateRowsEvent(t *testing.T) {
+	before := map[string]interface{}{
+		"a": int64(1),
+		"b": []interface{}{"x", "y"},
+		"c": map[string]interface{}{"key with space": true},
+		"d": nil,
+	}
+	diffs := []struct {
+		op    int
+		path  string
+		value interface{}
+	}{
+		{jsonDiffReplace, "$.a", int64(100000)},
+		{jsonDiffInsert, "$.b[1]", 2.5},
+		{jsonDiffInsert, "$.b[3]", "z"},
+		{jsonDiffRemove, `$.c."key with space"`, nil},
+		{jsonDiffInsert, "$.e", "new"},
+	}
+	dw := serialize.NewBinWriter(nil)
+	for _, d := range diffs {
+		dw.WriteUint8(uint8(d.op))
+		dw.WriteLenencString(d.path)
+		if jsonDiffRemove != d.op {
+			dw.WriteLenencBytes(mustEncodeJSON(t, d.value))
+		}
+	}
+
+	// Columns id int, doc json, other json
+	w := serialize.NewBinWriter(nil)
+	w.WriteUint16(RowsEventFlagStmtEnd)
+	w.WriteUint16(2)
+	w.WriteLenencInt(3)
+	w.WriteUint8(0x07)
+	w.WriteUint8(0x07)
+	// Before image
+	doc := mustEncodeJSON(t, before)
+	other := mustEncodeJSON(t, []interface{}{int64(-1), uint64(1 << 40)})
+	w.WriteUint8(0)
+	w.WriteInt32(1)
+	w.WriteUint32(uint32(len(doc)))
+	w.WriteBytes(doc)
+	w.WriteUint32(uint32(len(other)))
+	w.WriteBytes(other)
+	// After image with the partial doc column
+	w.WriteLenencInt(rowValueOptionPartialJSON)
+	w.WriteUint8(0x01)
+	w.WriteUint8(0)
+	w.WriteInt32(1)
+	w.WriteUint32(uint32(len(dw.Bytes())))
+	w.WriteBytes(dw.Bytes())
+	w.WriteUint32(uint32(len(other)))
+	w.WriteBytes(other)
+
+	e := &RowsEvent{
+		version: 2,
+		partial: true,
+		Action:  RowUpdate,
+		Table: &TableMapEvent{
+			ColumnDefine: []byte{mconn.FieldTypeLong, mconn.FieldTypeJSON, mconn.FieldTypeJSON},
+			ColumnMeta:   []uint16{0, 4, 4},
+		},
+	}
+	if err := e.Decode(w.Bytes()); nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(e.Rows) {
+		t.Fatalf("unexpected rows count %d", len(e.Rows))
+	}
+	for i, want := range []string{
+		`{"a": 1, "b": ["x", "y"], "c": {"key with space": true}, "d": null}`,
+		`{"a": 100000, "b": ["x", 2.5, "y", "z"], "c": {}, "d": null, "e": "new"}`,
+	} {
+		if v := e.Rows[i].ColumnDatas[1]; want != v {
+			t.Errorf("row %d: unexpected json %v, want %s", i, v, want)
+		}
+	}
+	if v := e.Rows[1].ColumnDatas[2]; "[-1, 1099511627776]" != v {
+		t.Errorf("unexpected json column %v", v)
+	}
+}
+
+func TestPartialUpdateWithoutBeforeImage(t *testing.T) {
+	dw := serialize.NewBinWriter(nil)
+	dw.WriteUint8(jsonDiffReplace)
+	dw.WriteLenencString("$.a")
+	dw.WriteLenencBytes(mustEncodeJSON(t, int64(2)))
+
+	// Columns id int, doc json, the before image logs the id only
+	w := serialize.NewBinWriter(nil)
+	w.WriteUint16(RowsEventFlagStmtEnd)
+	w.WriteUint16(2)
+	w.WriteLenencInt(2)
+	w.WriteUint8(0x01)
+	w.WriteUint8(0x03)
+	w.WriteUint8(0)
+	w.WriteInt32(1)
+	w.WriteLenencInt(rowValueOptionPartialJSON)
+	w.WriteUint8(0x01)
+	w.WriteUint8(0)
+	w.WriteInt32(1)
+	w.WriteUint32(uint32(len(dw.Bytes())))
+	w.WriteBytes(dw.Bytes())
+
+	e := &RowsEvent{
+		version: 2,
+		partial: true,
+		Action:  RowUpdate,
+		Table: &TableMapEvent{
+			ColumnDefine: []byte{mconn.FieldTypeLong, mconn.FieldTypeJSON},
+			ColumnMeta:   []uint16{0, 4},
+		},
+	}
+	if err := e.Decode(w.Bytes()); nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(e.Rows) {
+		t.Fatalf("unexpected rows count %d", len(e.Rows))
+	}
+	after := e.Rows[1]
+	if !after.Present[0] || after.Present[1] || nil != after.ColumnDatas[1] {
+		t.Errorf("unexpected after image %v, present %v", after.ColumnDatas, after.Present)
+	}
+}
@@ -0,0 +1,82 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/sryanyuan/binp/mconn"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+// readJSONColumn reads the binary json as the json column with 4 bytes length
+func readJSONColumn(t *testing.T, data []byte) interface{} {
+	w := serialize.NewBinWriter(nil)
+	w.WriteUint32(uint32(len(data)))
+	w.WriteBytes(data)
+	v, err := readValue(serialize.NewBinReader(w.Bytes()), mconn.FieldTypeJSON, 4)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestDecodeJSON(t *testing.T) {
+	// 2015-01-15 23:24:25.000123 and -838:59:58.5 packed by mysql
+	datetime := make([]byte, 8)
+	ymd := int64((2015*13+1)<<5 | 15)
+	binary.LittleEndian.PutUint64(datetime, uint64((ymd<<17|23<<12|24<<6|25)<<24+123))
+	tm := make([]byte, 8)
+	packed := -int64((838<<12|59<<6|58)<<24 + 500000)
+	binary.LittleEndian.PutUint64(tm, uint64(packed))
+
+	tests := []struct {
+		data string
+		want string
+	}{
+		// Literals and scalars
+		{"0400", "null"},
+		{"0401", "true"},
+		{"0402", "false"},
+		{"05ffff", "-1"},
+		{"06ffff", "65535"},
+		{"0700000080", "-2147483648"},
+		{"08ffffffff", "4294967295"},
+		{"090000000000000080", "-9223372036854775808"},
+		{"0affffffffffffffff", "18446744073709551615"},
+		{"0b0000000000000440", "2.5"},
+		{"0b000000000000f03f", "1.0"},
+		{"0b9a9999999999b93f", "0.1"},
+		{"0b00000000000020c0", "-8.0"},
+		{"0b8eedb5a0f7c6c03e", "2.0000000000000003e-6"},
+		{"0bf64ae1c7022db544", "1e23"},
+		{"0c00", `""`},
+		{"0c0861220a5c09e4b8ad", `"a\"\n\\\t中"`},
+		{"0c0101", `"\u0001"`},
+		// {"a": 1}
+		{"0001000c000b00010005010061", `{"a": 1}`},
+		// [1, "ab", true]
+		{"0203001000050100" + "0c0d00" + "040100" + "026162", `[1, "ab", true]`},
+		// {}, []
+		{"0000000400", "{}"},
+		{"0200000400", "[]"},
+		// {"b": [], "aa": {"x": null}}
+		{"000200250012000100130002000215000019006261610000040001000c000b00010004000078",
+			`{"b": [], "aa": {"x": null}}`},
+		// Opaque values
+		{"0f0c08" + hex.EncodeToString(datetime), `"2015-01-15 23:24:25.000123"`},
+		{"0f0a08" + hex.EncodeToString(datetime), `"2015-01-15"`},
+		{"0f0b08" + hex.EncodeToString(tm), `"-838:59:58.500000"`},
+		{"0ff604" + "0302830e", "3.14"},
+		{"0ffc020102", `"base64:type252:AQI="`},
+	}
+	for _, test := range tests {
+		data, err := hex.DecodeString(test.data)
+		if nil != err {
+			t.Fatalf("%s: %v", test.data, err)
+		}
+		if v := readJSONColumn(t, data); test.want != v {
+			t.Errorf("%s: unexpected json %v, want %s", test.data, v, test.want)
+		}
+	}
+}
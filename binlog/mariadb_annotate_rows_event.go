@@ -0,0 +1,13 @@
+package binlog
+
+// MariadbAnnotateRowsEvent has the original statement of the following rows events,
+// it is written if binlog_annotate_row_events is on
+type MariadbAnnotateRowsEvent struct {
+	Query string
+}
+
+// Decode decodes the binary data into payload
+func (e *MariadbAnnotateRowsEvent) Decode(data []byte) error {
+	e.Query = string(data)
+	return nil
+}
@@ -0,0 +1,26 @@
+package binlog
+
+import (
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+// MariadbBinlogCheckpointEvent has the oldest binlog file the master still needs
+// for the crash recovery
+type MariadbBinlogCheckpointEvent struct {
+	Filename string
+}
+
+// Decode decodes the binary data into payload
+func (e *MariadbBinlogCheckpointEvent) Decode(data []byte) error {
+	r := serialize.NewBinReader(data)
+	n, err := r.ReadUint32()
+	if nil != err {
+		return errors.Trace(err)
+	}
+	if e.Filename, err = r.ReadStringWithLen(int(n)); nil != err {
+		return errors.Trace(err)
+	}
+	r.End()
+	return nil
+}
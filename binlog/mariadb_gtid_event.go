@@ -12,8 +12,15 @@ type MariadbGTIDEvent struct {
 	DomainID       uint32
 	ServerID       uint32
 	SequenceNumber uint64
+	Flags          uint8
 }
 
+// Flags of mariadb gtid event
+const (
+	MariadbGTIDFlagStandalone    = 0x01
+	MariadbGTIDFlagGroupCommitID = 0x02
+)
+
 // Decode decodes the binary data into payload
 func (e *MariadbGTIDEvent) Decode(data []byte) error {
 	var err error
@@ -27,6 +34,10 @@ func (e *MariadbGTIDEvent) Decode(data []byte) error {
 	if nil != err {
 		return errors.Trace(err)
 	}
+	e.Flags, err = r.ReadUint8()
+	if nil != err {
+		return errors.Trace(err)
+	}
 
 	r.End()
 
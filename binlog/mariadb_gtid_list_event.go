@@ -0,0 +1,44 @@
+package binlog
+
+import (
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/mconn"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+// MariadbGTIDListEvent is written at the beginning of every binlog file, it has the last
+// gtid of every domain and server in the previous binlog files
+type MariadbGTIDListEvent struct {
+	Flags uint8
+	GTIDs []mconn.MariadbGTID
+}
+
+// Decode decodes the binary data into payload
+func (e *MariadbGTIDListEvent) Decode(data []byte) error {
+	r := serialize.NewBinReader(data)
+	v, err := r.ReadUint32()
+	if nil != err {
+		return errors.Trace(err)
+	}
+	// The low 28 bits are the count and the high 4 bits are the flags
+	n := int(v & 0x0fffffff)
+	e.Flags = uint8(v >> 28)
+	if n*16 > len(r.LeftBytes()) {
+		return errors.Errorf("gtid list count %d overflow", n)
+	}
+	e.GTIDs = make([]mconn.MariadbGTID, n)
+	for i := range e.GTIDs {
+		g := &e.GTIDs[i]
+		if g.DomainID, err = r.ReadUint32(); nil != err {
+			return errors.Trace(err)
+		}
+		if g.ServerID, err = r.ReadUint32(); nil != err {
+			return errors.Trace(err)
+		}
+		if g.SequenceNumber, err = r.ReadUint64(); nil != err {
+			return errors.Trace(err)
+		}
+	}
+	r.End()
+	return nil
+}
@@ -2,18 +2,47 @@ package binlog
 
 import (
 	"encoding/binary"
+	"fmt"
+	"hash/crc32"
 
 	"github.com/juju/errors"
 	"github.com/sryanyuan/binp/rule"
 	"github.com/sryanyuan/binp/serialize"
 )
 
+// ChecksumError is returned if the crc32 checksum of the event mismatches, the
+// event is corrupted by the network or the disk
+type ChecksumError struct {
+	EventType uint8
+	LogPos    uint32
+	Expected  uint32
+	Actual    uint32
+	// Algorithm is set if the checksum algorithm of the format description event is invalid
+	Algorithm uint8
+}
+
+func (e *ChecksumError) Error() string {
+	if 0 != e.Algorithm {
+		return fmt.Sprintf("invalid checksum algorithm %d of format description event, log pos %d",
+			e.Algorithm, e.LogPos)
+	}
+	return fmt.Sprintf("checksum mismatch of event type %d, log pos %d, expected 0x%08x, actual 0x%08x",
+		e.EventType, e.LogPos, e.Expected, e.Actual)
+}
+
+// IsChecksumError returns true if the error is caused by a corrupted event
+func IsChecksumError(err error) bool {
+	_, ok := errors.Cause(err).(*ChecksumError)
+	return ok
+}
+
 // Parser parse the binlog event
 type Parser struct {
 	tables   map[uint64]*TableMapEvent
 	format   *FormatDescriptionEvent
 	checksum uint8
 	srule    rule.ISyncRule
+	semiSync bool
 }
 
 // NewParser create a new binlog parser
@@ -34,6 +63,11 @@ func (p *Parser) SetChecksum(cs uint8) {
 	p.checksum = cs
 }
 
+// SetSemiSync set whether the binlog stream has semi-sync headers
+func (p *Parser) SetSemiSync(v bool) {
+	p.semiSync = v
+}
+
 // SetSyncRule set the sync rule for the parser
 // Sync rule only effect rows event, ddl (query event) won't be effected
 func (p *Parser) SetSyncRule(r rule.ISyncRule) {
@@ -44,8 +78,24 @@ func (p *Parser) SetSyncRule(r rule.ISyncRule) {
 func (p *Parser) Parse(data []byte) (*Event, error) {
 	// Skip ok header
 	data = data[1:]
-	// TODO: semi ack
+	// Strip the semi-sync header
+	needAck := false
+	if p.semiSync && len(data) > 2 && data[0] == SemiSyncIndicator {
+		needAck = 0 != data[1]&SemiSyncFlagNeedAck
+		data = data[2:]
+	}
+
+	event, err := p.ParseEvent(data)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	event.NeedAck = needAck
+
+	return event, nil
+}
 
+// ParseEvent parses the binlog event without the packet header, like events read from binlog files
+func (p *Parser) ParseEvent(data []byte) (*Event, error) {
 	event, err := p.parseEvent(data)
 	if nil != err {
 		return nil, errors.Trace(err)
@@ -64,7 +114,8 @@ func (p *Parser) Parse(data []byte) (*Event, error) {
 			}
 		case WriteRowsEventV0Type, WriteRowsEventV1Type, WriteRowsEventV2Type,
 			UpdateRowsEventV0Type, UpdateRowsEventV1Type, UpdateRowsEventV2Type,
-			DeleteRowsEventV0Type, DeleteRowsEventV1Type, DeleteRowsEventV2Type:
+			DeleteRowsEventV0Type, DeleteRowsEventV1Type, DeleteRowsEventV2Type,
+			PartialUpdateRowsEventType:
 			{
 				if event.Payload.Rows.Flags&RowsEventFlagStmtEnd != 0 {
 					//  If the table id is 0x00ffffff it is a dummy event that should have the end of statement flag set that
@@ -80,11 +131,15 @@ func (p *Parser) Parse(data []byte) (*Event, error) {
 
 func (p *Parser) parseEvent(data []byte) (*Event, error) {
 	var event Event
+	event.Data = data
 	// Parse header first
 	offset, err := p.parseHeader(&event.Header, data)
 	if nil != err {
 		return nil, errors.Trace(err)
 	}
+	if err = p.verifyChecksum(&event.Header, event.Data); nil != err {
+		return nil, err
+	}
 	data = data[offset:]
 
 	if err = p.parsePayload(&event, data); nil != err {
@@ -137,6 +192,44 @@ func (p *Parser) parseHeader(header *EventHeader, data []byte) (int, error) {
 	return offset, nil
 }
 
+// verifyChecksum verifies the crc32 checksum of the event. The format description event
+// has the checksum if its algorithm byte is CRC32, and it must have one if the binlog
+// stream is checksummed, so a corrupted algorithm byte can't disable the verification
+func (p *Parser) verifyChecksum(header *EventHeader, data []byte) error {
+	checksum := p.checksum
+	if FormatDescriptionEventType == header.EventType {
+		alg := FormatDescriptionChecksum(data)
+		switch alg {
+		case ChecksumAlgOff, ChecksumAlgUndef:
+		case ChecksumAlgCRC32:
+			{
+				checksum = alg
+			}
+		default:
+			{
+				return &ChecksumError{EventType: header.EventType, LogPos: header.LogPos, Algorithm: alg}
+			}
+		}
+	}
+	if ChecksumAlgCRC32 != checksum {
+		return nil
+	}
+	if len(data) < fixedEventHeaderLength+4 {
+		return errors.Errorf("event size %d is too small to have checksum", len(data))
+	}
+	size := len(data) - 4
+	expected := binary.LittleEndian.Uint32(data[size:])
+	if actual := crc32.ChecksumIEEE(data[:size]); expected != actual {
+		return &ChecksumError{
+			EventType: header.EventType,
+			LogPos:    header.LogPos,
+			Expected:  expected,
+			Actual:    actual,
+		}
+	}
+	return nil
+}
+
 func (p *Parser) parsePayload(event *Event, data []byte) error {
 	var err error
 
@@ -204,7 +297,8 @@ func (p *Parser) parsePayload(event *Event, data []byte) error {
 		}
 	case WriteRowsEventV0Type, WriteRowsEventV1Type, WriteRowsEventV2Type,
 		UpdateRowsEventV0Type, UpdateRowsEventV1Type, UpdateRowsEventV2Type,
-		DeleteRowsEventV0Type, DeleteRowsEventV1Type, DeleteRowsEventV2Type:
+		DeleteRowsEventV0Type, DeleteRowsEventV1Type, DeleteRowsEventV2Type,
+		PartialUpdateRowsEventType:
 		{
 			evt := &RowsEvent{}
 			event.Payload.Rows = evt
@@ -226,8 +320,9 @@ func (p *Parser) parsePayload(event *Event, data []byte) error {
 			event.Payload.RowsQuery = evt
 			payload = evt
 		}
-	case GTIDEventType:
+	case GTIDEventType, AnonymousGtidEventType:
 		{
+			// Anonymous gtid events carry the logical clock without the gtid
 			evt := &GTIDEvent{}
 			event.Payload.Parsed = true
 			event.Payload.GTID = evt
@@ -248,6 +343,83 @@ func (p *Parser) parsePayload(event *Event, data []byte) error {
 			event.Payload.Heartbeat = evt
 			payload = evt
 		}
+	case TransactionPayloadEventType:
+		{
+			evt := &TransactionPayloadEvent{}
+			event.Payload.Parsed = true
+			event.Payload.TransactionPayload = evt
+			payload = evt
+		}
+	case PreviousGtidsEventType:
+		{
+			evt := &PreviousGTIDsEvent{}
+			event.Payload.Parsed = true
+			event.Payload.PreviousGTIDs = evt
+			payload = evt
+		}
+	case IntvarEventType:
+		{
+			evt := &IntvarEvent{}
+			event.Payload.Parsed = true
+			event.Payload.Intvar = evt
+			payload = evt
+		}
+	case RandEventType:
+		{
+			evt := &RandEvent{}
+			event.Payload.Parsed = true
+			event.Payload.Rand = evt
+			payload = evt
+		}
+	case UserVarEventType:
+		{
+			evt := &UserVarEvent{}
+			event.Payload.Parsed = true
+			event.Payload.UserVar = evt
+			payload = evt
+		}
+	case IncidentEventType:
+		{
+			evt := &IncidentEvent{}
+			event.Payload.Parsed = true
+			event.Payload.Incident = evt
+			payload = evt
+		}
+	case StopEventType:
+		{
+			evt := &StopEvent{}
+			event.Payload.Parsed = true
+			event.Payload.Stop = evt
+			payload = evt
+		}
+	case XAPrepareLogEventType:
+		{
+			evt := &XAPrepareEvent{}
+			event.Payload.Parsed = true
+			event.Payload.XAPrepare = evt
+			payload = evt
+		}
+	case MariadbGTIDListEventType:
+		{
+			evt := &MariadbGTIDListEvent{}
+			event.Payload.Parsed = true
+			event.Payload.MariadbGTIDList = evt
+			payload = evt
+		}
+	case MariadbBinlogCheckpointEventType:
+		{
+			evt := &MariadbBinlogCheckpointEvent{}
+			event.Payload.Parsed = true
+			event.Payload.MariadbBinlogCheckpoint = evt
+			payload = evt
+		}
+	case MariadbAnnotateRowsEventType:
+		{
+			evt := &MariadbAnnotateRowsEvent{}
+			event.Payload.Parsed = true
+			event.Payload.MariadbAnnotateRows = evt
+			payload = evt
+		}
 	}
 
 	if nil == payload {
@@ -257,10 +429,56 @@ func (p *Parser) parsePayload(event *Event, data []byte) error {
 	if err = payload.Decode(data); nil != err {
 		return errors.Trace(err)
 	}
+	if nil != event.Payload.TransactionPayload {
+		if err = p.parseTransactionPayload(event); nil != err {
+			return errors.Trace(err)
+		}
+	}
 
 	return nil
 }
 
+// parseTransactionPayload parses the inner events of the transaction payload event,
+// table map events of the transaction are kept by the parser like normal events
+func (p *Parser) parseTransactionPayload(event *Event) error {
+	evt := event.Payload.TransactionPayload
+	data, err := evt.Uncompress()
+	if nil != err {
+		return errors.Trace(err)
+	}
+
+	// Inner events have no checksum
+	checksum := p.checksum
+	p.checksum = ChecksumAlgOff
+	defer func() {
+		p.checksum = checksum
+	}()
+	var startPos uint32
+	if event.Header.LogPos >= event.Header.EventSize {
+		startPos = event.Header.LogPos - event.Header.EventSize
+	}
+	for len(data) > 0 {
+		if len(data) < fixedEventHeaderLength {
+			return errors.Errorf("truncated inner event header of transaction payload, size %d", len(data))
+		}
+		size := binary.LittleEndian.Uint32(data[9:])
+		if size < fixedEventHeaderLength || int(size) > len(data) {
+			return errors.Errorf("invalid inner event size %d of transaction payload", size)
+		}
+		inner, err := p.ParseEvent(data[:size])
+		if nil != err {
+			return errors.Annotate(err, "parse inner event of transaction payload")
+		}
+		data = data[size:]
+		inner.Header.LogPos = startPos
+		if 0 == len(data) {
+			inner.Header.LogPos = event.Header.LogPos
+		}
+		evt.Events = append(evt.Events, inner)
+	}
+	return nil
+}
+
 func (p *Parser) preParseRowsEvent(event *Event, data []byte) ([]byte, error) {
 	evt := event.Payload.Rows
 	// Check the post header len from format description
@@ -316,10 +534,17 @@ func (p *Parser) preParseRowsEvent(event *Event, data []byte) ([]byte, error) {
 		evt.version = 2
 	}
 
+	// Partial update rows event is the same as the v2 update rows event
+	if et == PartialUpdateRowsEventType {
+		evt.version = 2
+		evt.partial = true
+	}
+
 	evt.Action = RowWrite
 	if et == UpdateRowsEventV0Type ||
 		et == UpdateRowsEventV1Type ||
-		et == UpdateRowsEventV2Type {
+		et == UpdateRowsEventV2Type ||
+		et == PartialUpdateRowsEventType {
 		evt.Action = RowUpdate
 	}
 	if et == DeleteRowsEventV0Type ||
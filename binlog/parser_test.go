@@ -0,0 +1,43 @@
+package binlog
+
+import (
+	"testing"
+
+	"github.com/sryanyuan/binp/serialize"
+)
+
+func TestParseSemiSyncHeader(t *testing.T) {
+	w := serialize.NewBinWriter(nil)
+	w.WriteUint32(0)
+	w.WriteUint8(XidEventType)
+	w.WriteUint32(1)
+	w.WriteUint32(19 + 8)
+	w.WriteUint32(4)
+	w.WriteUint16(0)
+	w.WriteUint64(1)
+	event := w.Bytes()
+
+	p := NewParser()
+	p.SetSemiSync(true)
+	for _, c := range []struct {
+		flag    uint8
+		needAck bool
+	}{
+		{0x00, false},
+		{SemiSyncFlagNeedAck, true},
+		// Unknown flags are ignored
+		{0x02, false},
+		{0x02 | SemiSyncFlagNeedAck, true},
+	} {
+		e, err := p.Parse(append([]byte{0x00, SemiSyncIndicator, c.flag}, event...))
+		if nil != err {
+			t.Fatal(err)
+		}
+		if c.needAck != e.NeedAck {
+			t.Errorf("flag %#x: unexpected need ack %v", c.flag, e.NeedAck)
+		}
+		if !e.Payload.Parsed || 1 != e.Payload.Xid.Xid {
+			t.Errorf("flag %#x: unexpected payload %+v", c.flag, e.Payload.Xid)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package binlog
+
+import (
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/mconn"
+)
+
+// PreviousGTIDsEvent is written at the beginning of every binlog file, it has the gtid set
+// executed in all previous binlog files
+type PreviousGTIDsEvent struct {
+	GTIDSet *mconn.MysqlGTIDSet
+}
+
+// Decode decodes the binary data into payload
+func (e *PreviousGTIDsEvent) Decode(data []byte) error {
+	var err error
+	if e.GTIDSet, err = mconn.DecodeMysqlGTIDSet(data); nil != err {
+		return errors.Trace(err)
+	}
+	return nil
+}
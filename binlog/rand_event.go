@@ -0,0 +1,27 @@
+package binlog
+
+import (
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+// RandEvent has the seeds of RAND() used by the next statement
+// https://dev.mysql.com/doc/internals/en/rand-event.html
+type RandEvent struct {
+	Seed1 uint64
+	Seed2 uint64
+}
+
+// Decode decodes the binary data into payload
+func (e *RandEvent) Decode(data []byte) error {
+	var err error
+	r := serialize.NewBinReader(data)
+	if e.Seed1, err = r.ReadUint64(); nil != err {
+		return errors.Trace(err)
+	}
+	if e.Seed2, err = r.ReadUint64(); nil != err {
+		return errors.Trace(err)
+	}
+	r.End()
+	return nil
+}
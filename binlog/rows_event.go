@@ -27,6 +27,11 @@ const (
 // Row is a row data contain columns
 type Row struct {
 	ColumnDatas []interface{}
+	// Present is true if the column is logged in the row image, columns absent in
+	// minimal or noblob row images are nil but not null
+	Present []bool
+	// jsonDocs are decoded json columns of partial update rows events to apply json diffs
+	jsonDocs map[int]interface{}
 }
 
 // RowsEvent see below
@@ -34,6 +39,9 @@ type Row struct {
 type RowsEvent struct {
 	tableIDSize uint8
 	version     int
+	// partial is true for the partial update rows event, json columns of the after
+	// image may be the json diffs of the before image
+	partial     bool
 	Action      int
 	TableID     uint64
 	Table       *TableMapEvent
@@ -114,11 +122,12 @@ func readValue(r *serialize.BinReader, tp uint8, meta uint16) (interface{}, erro
 		{
 			precision := int(meta >> 8)
 			decimals := int(meta & 0xff)
-			fv, err := decodeDecimal(r, precision, decimals)
+			// Decimals are exact strings, float64 loses the precision
+			v, err := decodeDecimal(r, precision, decimals)
 			if nil != err {
 				return nil, errors.Trace(err)
 			}
-			return fv, nil
+			return v, nil
 		}
 	case mconn.FieldTypeFloat:
 		{
@@ -221,14 +230,12 @@ func readValue(r *serialize.BinReader, tp uint8, meta uint16) (interface{}, erro
 		}
 	case mconn.FieldTypeSet:
 		{
-			n := int(meta & 0xFF)
-			nbits := n * 8
-
-			v, err := decodeBit(r, uint16(nbits), n)
+			// The bitmask of the set members is little endian
+			bv, err := r.ReadBytes(int(meta & 0xFF))
 			if nil != err {
 				return nil, errors.Trace(err)
 			}
-			return v, nil
+			return serialize.NumberFromBytesLittleEndian(bv), nil
 		}
 	case mconn.FieldTypeBlob:
 		{
@@ -261,6 +268,10 @@ func readValue(r *serialize.BinReader, tp uint8, meta uint16) (interface{}, erro
 					tp = b0
 				}
 			}
+			// Enum and set columns are logged as strings with the real type in the meta
+			if mconn.FieldTypeEnum == tp || mconn.FieldTypeSet == tp {
+				return readValue(r, tp, meta)
+			}
 			v, err := decodeVarChar(r, meta)
 			if nil != err {
 				return nil, errors.Trace(err)
@@ -277,7 +288,7 @@ func readValue(r *serialize.BinReader, tp uint8, meta uint16) (interface{}, erro
 		}
 	case mconn.FieldTypeGeometry:
 		{
-			v, err := decodeBlob(r, meta)
+			v, err := decodeGeometry(r, meta)
 			if nil != err {
 				return nil, errors.Trace(err)
 			}
@@ -293,13 +304,17 @@ func readValue(r *serialize.BinReader, tp uint8, meta uint16) (interface{}, erro
 	//return nil, errors.Errorf("Unknown type %v", tp)
 }
 
-func (e *RowsEvent) readRow(r *serialize.BinReader, mask []byte) (*Row, error) {
+// readRow reads the row image. For the after image of the partial update rows event,
+// the before row is given and json columns set in the partial bitmap are json diffs
+func (e *RowsEvent) readRow(r *serialize.BinReader, mask []byte, before *Row, partial []byte) (*Row, error) {
 	row := &Row{}
 	row.ColumnDatas = make([]interface{}, int(e.ColumnCount))
+	row.Present = make([]bool, int(e.ColumnCount))
 	// Check how many column is presented
 	count := 0
 	for i := 0; i < int(e.ColumnCount); i++ {
 		if isBitSet(mask, i) {
+			row.Present[i] = true
 			count++
 		}
 	}
@@ -311,7 +326,14 @@ func (e *RowsEvent) readRow(r *serialize.BinReader, mask []byte) (*Row, error) {
 	}
 
 	columnIndex := 0
+	jsonIndex := 0
 	for i := 0; i < int(e.ColumnCount); i++ {
+		// The partial bitmap has a bit for every json column whether it is present or not
+		isPartial := false
+		if nil != partial && mconn.FieldTypeJSON == e.Table.ColumnDefine[i] {
+			isPartial = isBitSet(partial, jsonIndex)
+			jsonIndex++
+		}
 		if !isBitSet(mask, i) {
 			continue
 		}
@@ -325,7 +347,13 @@ func (e *RowsEvent) readRow(r *serialize.BinReader, mask []byte) (*Row, error) {
 			continue
 		}
 
-		row.ColumnDatas[i], err = readValue(r, e.Table.ColumnDefine[i], e.Table.ColumnMeta[i])
+		if isPartial {
+			row.ColumnDatas[i], err = e.readPartialJSON(r, i, before, row)
+		} else if e.partial && mconn.FieldTypeJSON == e.Table.ColumnDefine[i] {
+			row.ColumnDatas[i], err = e.readJSON(r, i, row)
+		} else {
+			row.ColumnDatas[i], err = readValue(r, e.Table.ColumnDefine[i], e.Table.ColumnMeta[i])
+		}
 		if nil != err {
 			return nil, errors.Trace(err)
 		}
@@ -334,6 +362,74 @@ func (e *RowsEvent) readRow(r *serialize.BinReader, mask []byte) (*Row, error) {
 	return row, nil
 }
 
+// readPartialBitmap reads the value options of the partial update after image, returns
+// the partial bitmap of json columns, nil if no json column is partially updated
+func (e *RowsEvent) readPartialBitmap(r *serialize.BinReader) ([]byte, error) {
+	options, err := r.ReadLenencInt()
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	if 0 == options&rowValueOptionPartialJSON {
+		return nil, nil
+	}
+	count := 0
+	for _, tp := range e.Table.ColumnDefine {
+		if mconn.FieldTypeJSON == tp {
+			count++
+		}
+	}
+	bitmap, err := r.ReadBytes((count + 7) / 8)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	return bitmap, nil
+}
+
+// readJSON reads the json column and keeps the decoded document in the row
+func (e *RowsEvent) readJSON(r *serialize.BinReader, i int, row *Row) (interface{}, error) {
+	doc, err := readJSONDocument(r, e.Table.ColumnMeta[i])
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	return row.setJSON(i, doc)
+}
+
+// readPartialJSON reads the json diffs of the column and applies them to the before image.
+// The column is not present in the row if the before image doesn't log it, like minimal
+// and noblob row images
+func (e *RowsEvent) readPartialJSON(r *serialize.BinReader, i int, before *Row, row *Row) (interface{}, error) {
+	v, err := decodeBlob(r, e.Table.ColumnMeta[i])
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	diffs, err := readJSONDiffs(v.([]byte))
+	if nil != err {
+		return nil, errors.Annotatef(err, "column %d", i)
+	}
+	doc, ok := before.jsonDocs[i]
+	if !ok {
+		row.Present[i] = false
+		return nil, nil
+	}
+	if doc, err = applyJSONDiffs(doc, diffs); nil != err {
+		return nil, errors.Annotatef(err, "column %d", i)
+	}
+	return row.setJSON(i, doc)
+}
+
+// setJSON keeps the json document and returns the json text
+func (row *Row) setJSON(i int, doc interface{}) (interface{}, error) {
+	if nil == row.jsonDocs {
+		row.jsonDocs = make(map[int]interface{})
+	}
+	row.jsonDocs[i] = doc
+	v, err := formatJSON(doc)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	return v, nil
+}
+
 // Decode decodes the binary data into payload
 func (e *RowsEvent) Decode(data []byte) error {
 	var err error
@@ -404,7 +500,7 @@ func (e *RowsEvent) Decode(data []byte) error {
 		if r.Empty() {
 			break
 		}
-		row, err := e.readRow(r, e.Bitmap1)
+		row, err := e.readRow(r, e.Bitmap1, nil, nil)
 		if nil != err {
 			return errors.Trace(err)
 		}
@@ -412,7 +508,13 @@ func (e *RowsEvent) Decode(data []byte) error {
 		// Is update event and version > 0 ?
 		if e.Action == RowUpdate &&
 			e.version > 0 {
-			row, err = e.readRow(r, e.Bitmap2)
+			var partial []byte
+			if e.partial {
+				if partial, err = e.readPartialBitmap(r); nil != err {
+					return errors.Trace(err)
+				}
+			}
+			row, err = e.readRow(r, e.Bitmap2, row, partial)
 			if nil != err {
 				return errors.Trace(err)
 			}
@@ -0,0 +1,11 @@
+package binlog
+
+// StopEvent is written when the master is shutdown
+// https://dev.mysql.com/doc/internals/en/stop-event.html
+type StopEvent struct {
+}
+
+// Decode decodes the binary data into payload
+func (e *StopEvent) Decode(data []byte) error {
+	return nil
+}
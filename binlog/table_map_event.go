@@ -20,6 +20,20 @@ type TableMapEvent struct {
 	ColumnDefine []byte
 	ColumnMeta   []uint16
 	NullBitmask  []byte
+
+	// Optional metadata logged with binlog_row_metadata, column slices are indexed by column
+	// and nil if the field is absent
+	ColumnName     []string
+	ColumnUnsigned []bool
+	// ColumnCharset is the collation id of the character, enum and set columns
+	ColumnCharset []uint64
+	// EnumSetValues are the members of the enum and set columns
+	EnumSetValues [][]string
+	GeometryType  []uint64
+	// PrimaryKey are the column indexes of the primary key, the prefix length is 0 if
+	// the whole column is used
+	PrimaryKey       []int
+	PrimaryKeyPrefix []uint64
 }
 
 func (e *TableMapEvent) decodeColumnMetaDef(meta []byte) error {
@@ -150,11 +164,15 @@ func (e *TableMapEvent) Decode(data []byte) error {
 		return errors.Trace(err)
 	}
 
-	leftBytes := r.LeftBytes()
-	if len(leftBytes) != (int(e.ColumnCount)+7)/8 {
-		return errors.New("invalid null mask")
+	e.NullBitmask, err = r.ReadBytes((int(e.ColumnCount) + 7) / 8)
+	if nil != err {
+		return errors.Annotate(err, "invalid null mask")
+	}
+
+	// MySQL 8 appends the optional metadata
+	if err = e.decodeOptionalMeta(r.LeftBytes()); nil != err {
+		return errors.Trace(err)
 	}
-	e.NullBitmask = leftBytes
 
 	r.End()
 
@@ -0,0 +1,96 @@
+package binlog
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sryanyuan/binp/mconn"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+func TestTableMapOptionalMetadata(t *testing.T) {
+	// id int unsigned, name varchar(10), status enum, tags set, g point, price decimal(10,2)
+	w := serialize.NewBinWriter(nil)
+	w.WriteUint32(1)
+	w.WriteUint16(0)
+	w.WriteBytes([]byte{0x01, 'd', 0x00, 0x01, 't', 0x00})
+	w.WriteLenencInt(6)
+	w.WriteBytes([]byte{mconn.FieldTypeLong, mconn.FieldTypeVarChar, mconn.FieldTypeString,
+		mconn.FieldTypeString, mconn.FieldTypeGeometry, mconn.FieldTypeNewDecimal})
+	w.WriteLenencBytes([]byte{0x28, 0x00, mconn.FieldTypeEnum, 0x01, mconn.FieldTypeSet, 0x01, 0x04, 0x0a, 0x02})
+	w.WriteUint8(0x3e)
+
+	tlv := func(tp uint8, build func(*serialize.BinWriter)) {
+		vw := serialize.NewBinWriter(nil)
+		build(vw)
+		w.WriteUint8(tp)
+		w.WriteLenencBytes(vw.Bytes())
+	}
+	tlv(TableMapMetaSignedness, func(vw *serialize.BinWriter) { vw.WriteUint8(0x80) })
+	tlv(TableMapMetaDefaultCharset, func(vw *serialize.BinWriter) {
+		vw.WriteLenencInt(255)
+		vw.WriteLenencInt(0)
+		vw.WriteLenencInt(33)
+	})
+	tlv(TableMapMetaEnumAndSetColumnCharset, func(vw *serialize.BinWriter) {
+		vw.WriteLenencInt(45)
+		vw.WriteLenencInt(46)
+	})
+	tlv(TableMapMetaColumnName, func(vw *serialize.BinWriter) {
+		for _, name := range []string{"id", "name", "status", "tags", "g", "price"} {
+			vw.WriteLenencString(name)
+		}
+	})
+	for _, tp := range []uint8{TableMapMetaEnumStrValue, TableMapMetaSetStrValue} {
+		tlv(tp, func(vw *serialize.BinWriter) {
+			vw.WriteLenencInt(2)
+			vw.WriteLenencString("a")
+			vw.WriteLenencString("b")
+		})
+	}
+	tlv(TableMapMetaGeometryType, func(vw *serialize.BinWriter) { vw.WriteLenencInt(1) })
+	tlv(TableMapMetaSimplePrimaryKey, func(vw *serialize.BinWriter) { vw.WriteLenencInt(0) })
+	// Unknown fields are skipped
+	tlv(TableMapMetaColumnVisibility, func(vw *serialize.BinWriter) { vw.WriteUint8(0xfc) })
+
+	e := &TableMapEvent{tableIDSize: 4}
+	if err := e.Decode(w.Bytes()); nil != err {
+		t.Fatal(err)
+	}
+	if !e.HasFullMetadata() {
+		t.Fatal("missing full metadata")
+	}
+	if want := []string{"id", "name", "status", "tags", "g", "price"}; !reflect.DeepEqual(want, e.ColumnName) {
+		t.Errorf("unexpected column names %v", e.ColumnName)
+	}
+	if want := []bool{true, false, false, false, false, false}; !reflect.DeepEqual(want, e.ColumnUnsigned) {
+		t.Errorf("unexpected signedness %v", e.ColumnUnsigned)
+	}
+	if want := []uint64{0, 33, 45, 46, 0, 0}; !reflect.DeepEqual(want, e.ColumnCharset) {
+		t.Errorf("unexpected charsets %v", e.ColumnCharset)
+	}
+	if want := [][]string{nil, nil, {"a", "b"}, {"a", "b"}, nil, nil}; !reflect.DeepEqual(want, e.EnumSetValues) {
+		t.Errorf("unexpected enum and set values %v", e.EnumSetValues)
+	}
+	if want := []uint64{0, 0, 0, 0, 1, 0}; !reflect.DeepEqual(want, e.GeometryType) {
+		t.Errorf("unexpected geometry types %v", e.GeometryType)
+	}
+	if !reflect.DeepEqual([]int{0}, e.PrimaryKey) || !reflect.DeepEqual([]uint64{0}, e.PrimaryKeyPrefix) {
+		t.Errorf("unexpected primary key %v, prefix %v", e.PrimaryKey, e.PrimaryKeyPrefix)
+	}
+	if mconn.FieldTypeEnum != e.RealType(2) || mconn.FieldTypeSet != e.RealType(3) {
+		t.Errorf("unexpected real types %d, %d", e.RealType(2), e.RealType(3))
+	}
+
+	o := &TableMapEvent{tableIDSize: 4}
+	if err := o.Decode(w.Bytes()); nil != err {
+		t.Fatal(err)
+	}
+	if !e.SameTable(o) {
+		t.Error("events of the same table differ")
+	}
+	o.ColumnName[1] = "title"
+	if e.SameTable(o) || e.SameTable(nil) {
+		t.Error("events of the changed table are the same")
+	}
+}
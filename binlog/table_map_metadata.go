@@ -0,0 +1,273 @@
+package binlog
+
+import (
+	"reflect"
+
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/mconn"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+// Types of the table map optional metadata, see Table_map_log_event::Optional_metadata_field_type
+const (
+	TableMapMetaSignedness = iota + 1
+	TableMapMetaDefaultCharset
+	TableMapMetaColumnCharset
+	TableMapMetaColumnName
+	TableMapMetaSetStrValue
+	TableMapMetaEnumStrValue
+	TableMapMetaGeometryType
+	TableMapMetaSimplePrimaryKey
+	TableMapMetaPrimaryKeyWithPrefix
+	TableMapMetaEnumAndSetDefaultCharset
+	TableMapMetaEnumAndSetColumnCharset
+	TableMapMetaColumnVisibility
+)
+
+// RealType returns the real type of the column, enum and set columns are logged as strings
+func (e *TableMapEvent) RealType(i int) uint8 {
+	tp := e.ColumnDefine[i]
+	if mconn.FieldTypeString == tp && e.ColumnMeta[i] >= 256 {
+		b0 := uint8(e.ColumnMeta[i] >> 8)
+		if b0&0x30 == 0x30 {
+			return b0
+		}
+		return b0 | 0x30
+	}
+	return tp
+}
+
+// HasFullMetadata returns true if the event is logged with binlog_row_metadata=FULL
+func (e *TableMapEvent) HasFullMetadata() bool {
+	return nil != e.ColumnName
+}
+
+// SameTable returns true if both events map the same table id with the same columns
+// and metadata, events of the same table are decoded again in every transaction
+func (e *TableMapEvent) SameTable(o *TableMapEvent) bool {
+	return nil != o && reflect.DeepEqual(*e, *o)
+}
+
+func isNumericType(tp uint8) bool {
+	switch tp {
+	case mconn.FieldTypeTiny, mconn.FieldTypeShort, mconn.FieldTypeInt24, mconn.FieldTypeLong,
+		mconn.FieldTypeLongLong, mconn.FieldTypeFloat, mconn.FieldTypeDouble,
+		mconn.FieldTypeDecimal, mconn.FieldTypeNewDecimal:
+		{
+			return true
+		}
+	}
+	return false
+}
+
+func isCharacterType(tp uint8) bool {
+	switch tp {
+	case mconn.FieldTypeString, mconn.FieldTypeVarString, mconn.FieldTypeVarChar, mconn.FieldTypeBlob,
+		mconn.FieldTypeTinyBlob, mconn.FieldTypeMediumBlob, mconn.FieldTypeLongBlob:
+		{
+			return true
+		}
+	}
+	return false
+}
+
+func isEnumOrSetType(tp uint8) bool {
+	return mconn.FieldTypeEnum == tp || mconn.FieldTypeSet == tp
+}
+
+// columnsOf returns the indexes of the columns matches the type filter
+func (e *TableMapEvent) columnsOf(match func(uint8) bool) []int {
+	var cols []int
+	for i := range e.ColumnDefine {
+		if match(e.RealType(i)) {
+			cols = append(cols, i)
+		}
+	}
+	return cols
+}
+
+// decodeOptionalMeta decodes the TLV fields of the optional metadata, unknown fields are skipped
+func (e *TableMapEvent) decodeOptionalMeta(data []byte) error {
+	r := serialize.NewBinReader(data)
+	for !r.Empty() {
+		tp, err := r.ReadUint8()
+		if nil != err {
+			return errors.Trace(err)
+		}
+		value, err := r.ReadLenencBytes()
+		if nil != err {
+			return errors.Trace(err)
+		}
+		vr := serialize.NewBinReader(value)
+		switch tp {
+		case TableMapMetaSignedness:
+			{
+				err = e.decodeSignedness(value)
+			}
+		case TableMapMetaDefaultCharset:
+			{
+				err = e.decodeDefaultCharset(vr, e.columnsOf(isCharacterType))
+			}
+		case TableMapMetaEnumAndSetDefaultCharset:
+			{
+				err = e.decodeDefaultCharset(vr, e.columnsOf(isEnumOrSetType))
+			}
+		case TableMapMetaColumnCharset:
+			{
+				err = e.decodeColumnCharset(vr, e.columnsOf(isCharacterType))
+			}
+		case TableMapMetaEnumAndSetColumnCharset:
+			{
+				err = e.decodeColumnCharset(vr, e.columnsOf(isEnumOrSetType))
+			}
+		case TableMapMetaColumnName:
+			{
+				e.ColumnName = make([]string, 0, e.ColumnCount)
+				for !vr.Empty() {
+					name, err := vr.ReadLenencBytes()
+					if nil != err {
+						return errors.Trace(err)
+					}
+					e.ColumnName = append(e.ColumnName, string(name))
+				}
+				if len(e.ColumnName) != int(e.ColumnCount) {
+					return errors.Errorf("column names count %d mismatch columns count %d",
+						len(e.ColumnName), e.ColumnCount)
+				}
+			}
+		case TableMapMetaSetStrValue:
+			{
+				err = e.decodeStrValues(vr, mconn.FieldTypeSet)
+			}
+		case TableMapMetaEnumStrValue:
+			{
+				err = e.decodeStrValues(vr, mconn.FieldTypeEnum)
+			}
+		case TableMapMetaGeometryType:
+			{
+				e.GeometryType = make([]uint64, e.ColumnCount)
+				for _, i := range e.columnsOf(func(tp uint8) bool { return mconn.FieldTypeGeometry == tp }) {
+					if e.GeometryType[i], err = vr.ReadLenencInt(); nil != err {
+						return errors.Trace(err)
+					}
+				}
+			}
+		case TableMapMetaSimplePrimaryKey:
+			{
+				for !vr.Empty() {
+					col, err := vr.ReadLenencInt()
+					if nil != err {
+						return errors.Trace(err)
+					}
+					e.PrimaryKey = append(e.PrimaryKey, int(col))
+					e.PrimaryKeyPrefix = append(e.PrimaryKeyPrefix, 0)
+				}
+			}
+		case TableMapMetaPrimaryKeyWithPrefix:
+			{
+				for !vr.Empty() {
+					col, err := vr.ReadLenencInt()
+					if nil != err {
+						return errors.Trace(err)
+					}
+					prefix, err := vr.ReadLenencInt()
+					if nil != err {
+						return errors.Trace(err)
+					}
+					e.PrimaryKey = append(e.PrimaryKey, int(col))
+					e.PrimaryKeyPrefix = append(e.PrimaryKeyPrefix, prefix)
+				}
+			}
+		}
+		if nil != err {
+			return errors.Annotatef(err, "decode optional metadata %d", tp)
+		}
+	}
+	for _, col := range e.PrimaryKey {
+		if col >= int(e.ColumnCount) {
+			return errors.Errorf("primary key column %d out of range", col)
+		}
+	}
+	return nil
+}
+
+// decodeSignedness decodes the bitmap of the numeric columns, the most significant bit is
+// the first column and the bit is set if the column is unsigned
+func (e *TableMapEvent) decodeSignedness(bitmap []byte) error {
+	e.ColumnUnsigned = make([]bool, e.ColumnCount)
+	for n, i := range e.columnsOf(isNumericType) {
+		if n/8 >= len(bitmap) {
+			return errors.New("signedness bitmap overflow")
+		}
+		e.ColumnUnsigned[i] = 0 != bitmap[n/8]&(0x80>>uint(n%8))
+	}
+	return nil
+}
+
+// decodeDefaultCharset decodes the default collation and the collations of the columns
+// not using the default, indexes are counted in the columns of the type
+func (e *TableMapEvent) decodeDefaultCharset(r *serialize.BinReader, cols []int) error {
+	def, err := r.ReadLenencInt()
+	if nil != err {
+		return errors.Trace(err)
+	}
+	if nil == e.ColumnCharset {
+		e.ColumnCharset = make([]uint64, e.ColumnCount)
+	}
+	for _, i := range cols {
+		e.ColumnCharset[i] = def
+	}
+	for !r.Empty() {
+		n, err := r.ReadLenencInt()
+		if nil != err {
+			return errors.Trace(err)
+		}
+		collation, err := r.ReadLenencInt()
+		if nil != err {
+			return errors.Trace(err)
+		}
+		if n >= uint64(len(cols)) {
+			return errors.Errorf("charset column %d out of range", n)
+		}
+		e.ColumnCharset[cols[n]] = collation
+	}
+	return nil
+}
+
+// decodeColumnCharset decodes the collation of every column of the type
+func (e *TableMapEvent) decodeColumnCharset(r *serialize.BinReader, cols []int) error {
+	if nil == e.ColumnCharset {
+		e.ColumnCharset = make([]uint64, e.ColumnCount)
+	}
+	for _, i := range cols {
+		collation, err := r.ReadLenencInt()
+		if nil != err {
+			return errors.Trace(err)
+		}
+		e.ColumnCharset[i] = collation
+	}
+	return nil
+}
+
+// decodeStrValues decodes the members of every enum or set column
+func (e *TableMapEvent) decodeStrValues(r *serialize.BinReader, tp uint8) error {
+	if nil == e.EnumSetValues {
+		e.EnumSetValues = make([][]string, e.ColumnCount)
+	}
+	for _, i := range e.columnsOf(func(t uint8) bool { return tp == t }) {
+		n, err := r.ReadLenencInt()
+		if nil != err {
+			return errors.Trace(err)
+		}
+		values := make([]string, 0, n)
+		for ; n > 0; n-- {
+			v, err := r.ReadLenencBytes()
+			if nil != err {
+				return errors.Trace(err)
+			}
+			values = append(values, string(v))
+		}
+		e.EnumSetValues[i] = values
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package binlog
+
+import (
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/klauspost/compress/zstd"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+// Compression types of the transaction payload event
+const (
+	PayloadCompressionZstd = 0
+	PayloadCompressionNone = 255
+)
+
+// Field types of the transaction payload event header
+const (
+	payloadHeaderEndMark = iota
+	payloadSizeField
+	payloadCompressionTypeField
+	payloadUncompressedSizeField
+)
+
+var (
+	payloadDecoder     *zstd.Decoder
+	payloadDecoderErr  error
+	payloadDecoderOnce sync.Once
+)
+
+// TransactionPayloadEvent is the compressed transaction of mysql 8.0.20+ with
+// binlog_transaction_compression=ON, see below
+// https://dev.mysql.com/doc/refman/8.0/en/binary-log-transaction-compression.html
+type TransactionPayloadEvent struct {
+	PayloadSize      uint64
+	CompressionType  uint64
+	UncompressedSize uint64
+	// Payload is the compressed events
+	Payload []byte
+	// Events are the inner events parsed by the parser. Inner events are positioned at
+	// the start of the payload event except the last one ends at the payload event
+	Events []*Event
+}
+
+// Decode decodes the binary data into payload
+func (e *TransactionPayloadEvent) Decode(data []byte) error {
+	r := serialize.NewBinReader(data)
+	e.CompressionType = PayloadCompressionNone
+	for {
+		tp, err := r.ReadLenencInt()
+		if nil != err {
+			return errors.Trace(err)
+		}
+		if payloadHeaderEndMark == tp {
+			break
+		}
+		length, err := r.ReadLenencInt()
+		if nil != err {
+			return errors.Trace(err)
+		}
+		switch tp {
+		case payloadSizeField:
+			{
+				e.PayloadSize, err = r.ReadLenencInt()
+			}
+		case payloadCompressionTypeField:
+			{
+				e.CompressionType, err = r.ReadLenencInt()
+			}
+		case payloadUncompressedSizeField:
+			{
+				e.UncompressedSize, err = r.ReadLenencInt()
+			}
+		default:
+			{
+				// Skip unknown fields
+				_, err = r.ReadBytes(int(length))
+			}
+		}
+		if nil != err {
+			return errors.Trace(err)
+		}
+	}
+
+	e.Payload = r.LeftBytes()
+	if uint64(len(e.Payload)) != e.PayloadSize {
+		return errors.Errorf("payload size %d mismatch the size %d of the header", len(e.Payload), e.PayloadSize)
+	}
+	r.End()
+
+	return nil
+}
+
+// Uncompress returns the uncompressed inner events
+func (e *TransactionPayloadEvent) Uncompress() ([]byte, error) {
+	switch e.CompressionType {
+	case PayloadCompressionNone:
+		{
+			return e.Payload, nil
+		}
+	case PayloadCompressionZstd:
+		{
+			payloadDecoderOnce.Do(func() {
+				payloadDecoder, payloadDecoderErr = zstd.NewReader(nil)
+			})
+			if nil != payloadDecoderErr {
+				return nil, errors.Trace(payloadDecoderErr)
+			}
+			data, err := payloadDecoder.DecodeAll(e.Payload, nil)
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			if uint64(len(data)) != e.UncompressedSize {
+				return nil, errors.Errorf("uncompressed size %d mismatch the size %d of the header",
+					len(data), e.UncompressedSize)
+			}
+			return data, nil
+		}
+	}
+	return nil, errors.Errorf("unsupported compression type %d of transaction payload", e.CompressionType)
+}
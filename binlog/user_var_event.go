@@ -0,0 +1,75 @@
+package binlog
+
+import (
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+// Types of the user variable value, see Item_result
+const (
+	UserVarStringResult = iota
+	UserVarRealResult
+	UserVarIntResult
+	UserVarRowResult
+	UserVarDecimalResult
+)
+
+// Flags of the user variable
+const (
+	UserVarFlagUnsigned = 0x01
+)
+
+// UserVarEvent has the user variable used by the next statement
+// https://dev.mysql.com/doc/internals/en/user-var-event.html
+type UserVarEvent struct {
+	Name   string
+	IsNull bool
+	Type   uint8
+	// Charset is the collation id of the string value
+	Charset uint32
+	// Value is the binary value, int and real values are little endian
+	Value []byte
+	Flags uint8
+}
+
+// Decode decodes the binary data into payload
+func (e *UserVarEvent) Decode(data []byte) error {
+	r := serialize.NewBinReader(data)
+	n, err := r.ReadUint32()
+	if nil != err {
+		return errors.Trace(err)
+	}
+	if e.Name, err = r.ReadStringWithLen(int(n)); nil != err {
+		return errors.Trace(err)
+	}
+	isNull, err := r.ReadUint8()
+	if nil != err {
+		return errors.Trace(err)
+	}
+	e.IsNull = 0 != isNull
+	if e.IsNull {
+		r.End()
+		return nil
+	}
+
+	if e.Type, err = r.ReadUint8(); nil != err {
+		return errors.Trace(err)
+	}
+	if e.Charset, err = r.ReadUint32(); nil != err {
+		return errors.Trace(err)
+	}
+	if n, err = r.ReadUint32(); nil != err {
+		return errors.Trace(err)
+	}
+	if e.Value, err = r.ReadBytes(int(n)); nil != err {
+		return errors.Trace(err)
+	}
+	// Flags are written since mysql 5.5
+	if !r.Empty() {
+		if e.Flags, err = r.ReadUint8(); nil != err {
+			return errors.Trace(err)
+		}
+	}
+	r.End()
+	return nil
+}
@@ -0,0 +1,46 @@
+package binlog
+
+import (
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+// XAPrepareEvent ends the prepared part of the xa transaction, see XA_prepare_event
+type XAPrepareEvent struct {
+	OnePhase bool
+	FormatID int32
+	Gtrid    []byte
+	Bqual    []byte
+}
+
+// Decode decodes the binary data into payload
+func (e *XAPrepareEvent) Decode(data []byte) error {
+	r := serialize.NewBinReader(data)
+	onePhase, err := r.ReadUint8()
+	if nil != err {
+		return errors.Trace(err)
+	}
+	e.OnePhase = 0 != onePhase
+	if e.FormatID, err = r.ReadInt32(); nil != err {
+		return errors.Trace(err)
+	}
+	gtridLen, err := r.ReadInt32()
+	if nil != err {
+		return errors.Trace(err)
+	}
+	bqualLen, err := r.ReadInt32()
+	if nil != err {
+		return errors.Trace(err)
+	}
+	if gtridLen < 0 || bqualLen < 0 {
+		return errors.Errorf("invalid xid length %d, %d", gtridLen, bqualLen)
+	}
+	if e.Gtrid, err = r.ReadBytes(int(gtridLen)); nil != err {
+		return errors.Trace(err)
+	}
+	if e.Bqual, err = r.ReadBytes(int(bqualLen)); nil != err {
+		return errors.Trace(err)
+	}
+	r.End()
+	return nil
+}
@@ -0,0 +1,190 @@
+// Package binlogserver serves stored binlog files to mysql replicas like a master, replicas
+// register and dump binlog by the file and position or the executed gtid set
+package binlogserver
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sryanyuan/binp/mconn"
+)
+
+const (
+	defaultServerID      = 1
+	defaultServerVersion = "5.7.30-binp-log"
+	defaultIndexFile     = "relay-bin.index"
+)
+
+// pollInterval is the interval to check new events at the end of binlog, a variable for tests
+var pollInterval = 100 * time.Millisecond
+
+// Config is the config of the binlog server
+type Config struct {
+	// Addr is the listen address, the binlog server is disabled if empty
+	Addr string `json:"addr" toml:"addr"`
+	// ServerID and ServerUUID are reported to replicas, the uuid is generated if empty
+	ServerID      uint32 `json:"server-id" toml:"server-id"`
+	ServerUUID    string `json:"server-uuid" toml:"server-uuid"`
+	ServerVersion string `json:"server-version" toml:"server-version"`
+	// Username and Password are the account of replicas, any user is accepted if empty
+	Username string `json:"username" toml:"username"`
+	Password string `json:"password" toml:"password"`
+	// Dir is the directory of binlog files, IndexFile lists the files in order,
+	// relay log files or binlog files copied from the master can be served
+	Dir       string `json:"dir" toml:"dir"`
+	IndexFile string `json:"index-file" toml:"index-file"`
+	// GtidMode reports gtid_mode ON to replicas so they can dump by gtid
+	GtidMode bool `json:"gtid-mode" toml:"gtid-mode"`
+}
+
+// Server is the binlog server
+type Server struct {
+	cfg Config
+	ln  net.Listener
+	wg  sync.WaitGroup
+
+	mu       sync.Mutex
+	sessions map[uint32]*session
+	connID   uint32
+	closed   bool
+}
+
+// NewServer creates the binlog server and starts listening
+func NewServer(cfg *Config) (*Server, error) {
+	s := &Server{
+		cfg:      *cfg,
+		sessions: make(map[uint32]*session),
+	}
+	if "" == s.cfg.Dir {
+		return nil, errors.New("binlog server requires the binlog directory")
+	}
+	if 0 == s.cfg.ServerID {
+		s.cfg.ServerID = defaultServerID
+	}
+	if "" == s.cfg.ServerVersion {
+		s.cfg.ServerVersion = defaultServerVersion
+	}
+	if "" == s.cfg.IndexFile {
+		s.cfg.IndexFile = defaultIndexFile
+	}
+	if "" == s.cfg.ServerUUID {
+		var id [16]byte
+		if _, err := rand.Read(id[:]); nil != err {
+			return nil, errors.Trace(err)
+		}
+		s.cfg.ServerUUID = fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+	}
+
+	ln, err := net.Listen("tcp", s.cfg.Addr)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	s.ln = ln
+	logrus.Infof("Binlog server listens on %s, serving %s", ln.Addr(), s.cfg.Dir)
+
+	s.wg.Add(1)
+	go s.acceptLoop()
+	return s, nil
+}
+
+// Addr returns the listening address
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Close stops the server and closes all replica connections
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	for _, ss := range s.sessions {
+		ss.close()
+	}
+	s.mu.Unlock()
+
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+// variables returns the global variables reported to replicas
+func (s *Server) variables() map[string]string {
+	gtidMode := "OFF"
+	if s.cfg.GtidMode {
+		gtidMode = "ON"
+	}
+	return map[string]string{
+		"server_id":                    fmt.Sprint(s.cfg.ServerID),
+		"server_uuid":                  s.cfg.ServerUUID,
+		"version":                      s.cfg.ServerVersion,
+		"gtid_mode":                    gtidMode,
+		"binlog_checksum":              "CRC32",
+		"rpl_semi_sync_master_enabled": "OFF",
+		"log_bin":                      "ON",
+		"binlog_format":                "ROW",
+		"time_zone":                    "SYSTEM",
+		"character_set_server":         "utf8",
+		"collation_server":             "utf8_general_ci",
+	}
+}
+
+func (s *Server) acceptLoop() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.ln.Accept()
+		if nil != err {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.connID++
+		ss := newSession(s, s.connID, conn)
+		s.sessions[ss.id] = ss
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if err := ss.serve(); nil != err {
+				logrus.Warnf("Binlog server session %d from %s exit: %v", ss.id, conn.RemoteAddr(), err)
+			}
+			s.mu.Lock()
+			delete(s.sessions, ss.id)
+			s.mu.Unlock()
+			ss.close()
+		}()
+	}
+}
+
+// fatalError is the error sent to the replica as the ER_MASTER_FATAL_ERROR_READING_BINLOG
+type fatalError struct {
+	msg string
+}
+
+func (e *fatalError) Error() string {
+	return e.msg
+}
+
+func newFatalError(format string, args ...interface{}) error {
+	return &fatalError{msg: fmt.Sprintf(format, args...)}
+}
+
+// errCodeOf returns the mysql error code sent to the replica
+func errCodeOf(err error) uint16 {
+	if _, ok := errors.Cause(err).(*fatalError); ok {
+		return mconn.ErrCodeMasterFatal
+	}
+	return mconn.ErrCodeUnknownError
+}
@@ -0,0 +1,249 @@
+package binlogserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sryanyuan/binp/fakemaster"
+	"github.com/sryanyuan/binp/mconn"
+	"github.com/sryanyuan/binp/slave"
+)
+
+const testSID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+var testTable = &fakemaster.Table{
+	ID:      1,
+	Schema:  "test",
+	Name:    "t",
+	Columns: []fakemaster.Column{{Type: mconn.FieldTypeLong}},
+}
+
+// appendInsert appends a gtid transaction inserts the id
+func appendInsert(t *testing.T, m *fakemaster.Master, id int32) {
+	gtid, err := fakemaster.NewGTIDEvent(fmt.Sprintf("%s:%d", testSID, id))
+	if nil != err {
+		t.Fatal(err)
+	}
+	rows, err := testTable.NewWriteRowsEvent([]interface{}{id})
+	if nil != err {
+		t.Fatal(err)
+	}
+	m.AppendEvents(gtid, fakemaster.NewQueryEvent("test", "BEGIN"),
+		testTable.NewTableMapEvent(), rows, fakemaster.NewXidEvent(uint64(id)))
+}
+
+func newTestServer(t *testing.T, dir string, index string) *Server {
+	s, err := NewServer(&Config{
+		Addr:      "127.0.0.1:0",
+		ServerID:  10,
+		Dir:       dir,
+		IndexFile: index,
+		GtidMode:  true,
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func dataSource(s *Server) mconn.DataSource {
+	addr := s.Addr().(*net.TCPAddr)
+	return mconn.DataSource{Host: addr.IP.String(), Port: uint16(addr.Port)}
+}
+
+// readIDs reads inserted ids from the slave until the dump ends
+func readIDs(t *testing.T, s *slave.Slave, count int) []int32 {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var ids []int32
+	for len(ids) < count {
+		ev, err := s.Next(ctx)
+		if io.EOF == err {
+			break
+		}
+		if nil != err {
+			t.Fatal(err)
+		}
+		if nil != ev.Payload.Rows {
+			ids = append(ids, ev.Payload.Rows.Rows[0].ColumnDatas[0].(int32))
+		}
+	}
+	return ids
+}
+
+func TestServeBinlogFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlogserver")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m, err := fakemaster.NewMaster(&fakemaster.Config{Checksum: true})
+	if nil != err {
+		t.Fatal(err)
+	}
+	appendInsert(t, m, 1)
+	middle := m.Point()
+	name := m.Rotate()
+	appendInsert(t, m, 2)
+	m.Close()
+	if err = m.SaveBinlogFiles(dir); nil != err {
+		t.Fatal(err)
+	}
+	index := fmt.Sprintf("./%s\n./%s\n", middle.Filename, name)
+	if err = ioutil.WriteFile(filepath.Join(dir, "mysql-bin.index"), []byte(index), 0644); nil != err {
+		t.Fatal(err)
+	}
+
+	srv := newTestServer(t, dir, "mysql-bin.index")
+	defer srv.Close()
+
+	tests := []struct {
+		rc    mconn.ReplicationConfig
+		point mconn.ReplicationPoint
+		want  string
+	}{
+		{
+			point: mconn.ReplicationPoint{Filename: middle.Filename, Offset: 4},
+			want:  "[1 2]",
+		},
+		{
+			point: middle,
+			want:  "[2]",
+		},
+		{
+			rc:    mconn.ReplicationConfig{EnableGtid: true},
+			point: mconn.ReplicationPoint{Gtid: testSID + ":1"},
+			want:  "[2]",
+		},
+	}
+	for i, test := range tests {
+		rc := test.rc
+		rc.SlaveID = 100
+		rc.NonBlock = true
+		s := slave.NewSlave([]mconn.DataSource{dataSource(srv)}, &rc, nil)
+		if err = s.Start(test.point); nil != err {
+			t.Fatal(err)
+		}
+		if ids := fmt.Sprint(readIDs(t, s, 3)); test.want != ids {
+			t.Errorf("test %d: unexpected ids %s, want %s", i, ids, test.want)
+		}
+		s.Stop()
+	}
+
+	// Unknown positions are rejected
+	s := slave.NewSlave([]mconn.DataSource{dataSource(srv)},
+		&mconn.ReplicationConfig{SlaveID: 100}, nil)
+	if err = s.Start(mconn.ReplicationPoint{Filename: "mysql-bin.000009", Offset: 4}); nil != err {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err = s.Next(ctx); nil == err || context.DeadlineExceeded == err {
+		t.Errorf("dump from unknown position should fail, got %v", err)
+	}
+}
+
+func TestServePurgedGTIDs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlogserver")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m, err := fakemaster.NewMaster(&fakemaster.Config{Checksum: true})
+	if nil != err {
+		t.Fatal(err)
+	}
+	appendInsert(t, m, 1)
+	name := m.Rotate()
+	previous, err := fakemaster.NewPreviousGTIDsEvent(testSID + ":1")
+	if nil != err {
+		t.Fatal(err)
+	}
+	m.AppendEvents(previous)
+	appendInsert(t, m, 2)
+	m.Close()
+	if err = m.SaveBinlogFiles(dir); nil != err {
+		t.Fatal(err)
+	}
+	// The first binlog file is purged
+	if err = ioutil.WriteFile(filepath.Join(dir, "mysql-bin.index"), []byte("./"+name+"\n"), 0644); nil != err {
+		t.Fatal(err)
+	}
+
+	srv := newTestServer(t, dir, "mysql-bin.index")
+	defer srv.Close()
+
+	rc := &mconn.ReplicationConfig{SlaveID: 100, EnableGtid: true, NonBlock: true}
+	s := slave.NewSlave([]mconn.DataSource{dataSource(srv)}, rc, nil)
+	if err = s.Start(mconn.ReplicationPoint{Gtid: testSID + ":1"}); nil != err {
+		t.Fatal(err)
+	}
+	if ids := fmt.Sprint(readIDs(t, s, 2)); "[2]" != ids {
+		t.Errorf("unexpected ids %s", ids)
+	}
+	s.Stop()
+
+	// The replica requires the purged transaction
+	s = slave.NewSlave([]mconn.DataSource{dataSource(srv)}, rc, nil)
+	if err = s.Start(mconn.ReplicationPoint{Gtid: testSID + ":2"}); nil != err {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err = s.Next(ctx); nil == err || context.DeadlineExceeded == err || io.EOF == err {
+		t.Errorf("dump without purged gtids should fail, got %v", err)
+	}
+}
+
+func TestServeRelayLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlogserver")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m, err := fakemaster.NewMaster(&fakemaster.Config{Checksum: true})
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	appendInsert(t, m, 1)
+
+	// The relay slave persists events of the master to the relay log
+	rc := &mconn.ReplicationConfig{SlaveID: 100}
+	rc.RelayLog.Dir = dir
+	relay := slave.NewSlave([]mconn.DataSource{m.DataSource()}, rc, nil)
+	if err = relay.Start(mconn.ReplicationPoint{Filename: "mysql-bin.000001"}); nil != err {
+		t.Fatal(err)
+	}
+	defer relay.Stop()
+	if ids := fmt.Sprint(readIDs(t, relay, 1)); "[1]" != ids {
+		t.Fatalf("unexpected ids %s", ids)
+	}
+
+	srv := newTestServer(t, dir, "relay-bin.index")
+	defer srv.Close()
+	s := slave.NewSlave([]mconn.DataSource{dataSource(srv)},
+		&mconn.ReplicationConfig{SlaveID: 101}, nil)
+	if err = s.Start(mconn.ReplicationPoint{Filename: "mysql-bin.000001"}); nil != err {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	// Events are streamed once they are relayed
+	appendInsert(t, m, 2)
+	if ids := fmt.Sprint(readIDs(t, s, 2)); "[1 2]" != ids {
+		t.Errorf("unexpected ids %s", ids)
+	}
+}
@@ -0,0 +1,393 @@
+package binlogserver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sryanyuan/binp/binlog"
+	"github.com/sryanyuan/binp/mconn"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+var (
+	setRegexp          = regexp.MustCompile(`(?i)^SET\s+(.+)$`)
+	setVariableRegexp  = regexp.MustCompile(`(?i)^(@@session\.|@@global\.|@@|@)?(\w+)\s*=\s*(.+)$`)
+	selectRegexp       = regexp.MustCompile(`(?i)^SELECT\s+(@@global\.|@@session\.|@@|@)(\w+)(\s+AS\s+\S+)?$`)
+	selectFuncRegexp   = regexp.MustCompile(`(?i)^SELECT\s+(UNIX_TIMESTAMP|VERSION)\s*\(\s*\)$`)
+	showVariableRegexp = regexp.MustCompile(`(?i)^SHOW\s+(GLOBAL\s+|SESSION\s+)?VARIABLES\s+LIKE\s+'([^']*)'$`)
+)
+
+// session is a replica connection of the binlog server
+type session struct {
+	srv  *Server
+	id   uint32
+	conn net.Conn
+	sc   *mconn.ServerConn
+	// vars are the user variables set by the replica
+	vars      map[string]string
+	quit      chan struct{}
+	closeOnce sync.Once
+}
+
+func newSession(srv *Server, id uint32, conn net.Conn) *session {
+	return &session{
+		srv:  srv,
+		id:   id,
+		conn: conn,
+		vars: make(map[string]string),
+		quit: make(chan struct{}),
+	}
+}
+
+func (s *session) close() {
+	s.closeOnce.Do(func() {
+		close(s.quit)
+		s.conn.Close()
+	})
+}
+
+func (s *session) serve() error {
+	sc, err := mconn.NewServerConn(s.conn, &mconn.ServerConfig{
+		ServerVersion: s.srv.cfg.ServerVersion,
+		ConnectionID:  s.id,
+		Username:      s.srv.cfg.Username,
+		Password:      s.srv.cfg.Password,
+	})
+	if nil != err {
+		return errors.Trace(err)
+	}
+	s.sc = sc
+
+	for {
+		data, err := sc.ReadCommand()
+		if nil != err {
+			if io.EOF == errors.Cause(err) {
+				return nil
+			}
+			return errors.Trace(err)
+		}
+
+		switch data[0] {
+		case mconn.ComQuit:
+			{
+				return nil
+			}
+		case mconn.ComPing:
+			{
+				err = sc.WriteOK(0, 0)
+			}
+		case mconn.ComQuery:
+			{
+				err = s.handleQuery(strings.TrimSpace(string(data[1:])))
+			}
+		case mconn.ComRegisterSlave:
+			{
+				var prs mconn.PacketRegisterSlave
+				if err = prs.Decode(data); nil != err {
+					return errors.Trace(err)
+				}
+				logrus.Infof("Replica %d registered from %s", prs.ServerID, sc.RemoteAddr())
+				err = sc.WriteOK(0, 0)
+			}
+		case mconn.ComBinlogDump:
+			{
+				var pbd mconn.PacketBinlogDump
+				if err = pbd.Decode(data); nil != err {
+					return errors.Trace(err)
+				}
+				point := mconn.ReplicationPoint{Filename: pbd.BinlogFile, Offset: pbd.BinlogPos}
+				return s.writeDumpError(s.dump(point, pbd.Flags, nil))
+			}
+		case mconn.ComBinlogDumpGtid:
+			{
+				var pbd mconn.PacketBinlogDumpGtid
+				if err = pbd.Decode(data); nil != err {
+					return errors.Trace(err)
+				}
+				gset, err := mconn.DecodeMysqlGTIDSet(pbd.Data)
+				if nil != err {
+					return errors.Trace(err)
+				}
+				return s.writeDumpError(s.dump(mconn.ReplicationPoint{}, pbd.Flags, gset))
+			}
+		default:
+			{
+				err = sc.WriteError(mconn.ErrCodeUnknownCommand, "08S01",
+					fmt.Sprintf("Unknown command %d", data[0]))
+			}
+		}
+		if nil != err {
+			return errors.Trace(err)
+		}
+	}
+}
+
+func (s *session) handleQuery(query string) error {
+	if matches := setRegexp.FindStringSubmatch(query); nil != matches {
+		// Only user variables are saved, system variables are accepted and ignored
+		for _, assign := range strings.Split(matches[1], ",") {
+			m := setVariableRegexp.FindStringSubmatch(strings.TrimSpace(assign))
+			if nil == m {
+				return errors.Trace(s.sc.WriteError(mconn.ErrCodeUnknownError, "HY000",
+					fmt.Sprintf("Unsupported query %s", query)))
+			}
+			if "@" == m[1] {
+				value, err := s.evalExpr(strings.TrimSpace(m[3]))
+				if nil != err {
+					return errors.Trace(err)
+				}
+				s.vars[strings.ToLower(m[2])] = value
+			}
+		}
+		return errors.Trace(s.sc.WriteOK(0, 0))
+	}
+	if matches := selectRegexp.FindStringSubmatch(query); nil != matches {
+		var value interface{}
+		name := strings.ToLower(matches[2])
+		if "@" == matches[1] {
+			if v, ok := s.vars[name]; ok {
+				value = v
+			}
+		} else {
+			v, ok, err := s.variable(name)
+			if nil != err {
+				return errors.Trace(err)
+			}
+			if ok {
+				value = v
+			}
+		}
+		return errors.Trace(s.sc.WriteResultSet([]string{matches[1] + matches[2]},
+			[][]interface{}{{value}}))
+	}
+	if matches := selectFuncRegexp.FindStringSubmatch(query); nil != matches {
+		var value interface{} = s.srv.cfg.ServerVersion
+		if strings.EqualFold(matches[1], "UNIX_TIMESTAMP") {
+			value = time.Now().Unix()
+		}
+		return errors.Trace(s.sc.WriteResultSet([]string{matches[1] + "()"},
+			[][]interface{}{{value}}))
+	}
+	if matches := showVariableRegexp.FindStringSubmatch(query); nil != matches {
+		var rows [][]interface{}
+		v, ok, err := s.variable(strings.ToLower(matches[2]))
+		if nil != err {
+			return errors.Trace(err)
+		}
+		if ok {
+			rows = append(rows, []interface{}{matches[2], v})
+		}
+		return errors.Trace(s.sc.WriteResultSet([]string{"Variable_name", "Value"}, rows))
+	}
+	return errors.Trace(s.sc.WriteError(mconn.ErrCodeUnknownError, "HY000",
+		fmt.Sprintf("Unsupported query %s", query)))
+}
+
+// variable returns the global variable
+func (s *session) variable(name string) (string, bool, error) {
+	if "binlog_checksum" == name {
+		checksum, err := s.srv.checksum()
+		if nil != err {
+			return "", false, errors.Trace(err)
+		}
+		return checksum, true, nil
+	}
+	v, ok := s.srv.variables()[name]
+	return v, ok, nil
+}
+
+// evalExpr evaluates the value of SET statement, supports literals and global variables
+func (s *session) evalExpr(expr string) (string, error) {
+	lower := strings.ToLower(expr)
+	for _, prefix := range []string{"@@global.", "@@"} {
+		if strings.HasPrefix(lower, prefix) {
+			v, _, err := s.variable(lower[len(prefix):])
+			return v, errors.Trace(err)
+		}
+	}
+	if unquoted, err := strconv.Unquote(strings.Replace(expr, "'", "\"", -1)); nil == err {
+		return unquoted, nil
+	}
+	return expr, nil
+}
+
+// heartbeatPeriod returns the heartbeat period set by the replica, 0 if disabled
+func (s *session) heartbeatPeriod() time.Duration {
+	v, err := strconv.ParseInt(s.vars["master_heartbeat_period"], 10, 64)
+	if nil != err {
+		return 0
+	}
+	return time.Duration(v)
+}
+
+// writeDumpError sends the error of the dump to the replica
+func (s *session) writeDumpError(err error) error {
+	if nil == err || io.EOF == err {
+		return nil
+	}
+	if werr := s.sc.WriteError(errCodeOf(err), "HY000", err.Error()); nil != werr {
+		logrus.Warnf("Write error to replica error: %v", werr)
+	}
+	return errors.Trace(err)
+}
+
+func (s *session) writeEvent(data []byte) error {
+	pkt := make([]byte, 5, 5+len(data))
+	pkt[4] = mconn.PacketHeaderOK
+	pkt = append(pkt, data...)
+	return errors.Trace(s.sc.WritePacket(pkt))
+}
+
+// writeArtificialEvent writes the event not stored in binlog files, like the fake rotate event
+func (s *session) writeArtificialEvent(tp uint8, body []byte, logPos uint32, checksum uint8) error {
+	header := binlog.EventHeader{
+		Timestamp: 0,
+		EventType: tp,
+		ServerID:  s.srv.cfg.ServerID,
+		LogPos:    logPos,
+		Flags:     binlog.LogEventArtificialFlag,
+	}
+	return errors.Trace(s.writeEvent(header.Encode(body, checksum)))
+}
+
+// dump streams binlog events after the point, if gset is not nil, events are streamed
+// from the oldest binlog file and transactions in the set are skipped, the set must
+// contain the purged transactions
+func (s *session) dump(point mconn.ReplicationPoint, flags uint16, gset mconn.GTIDSet) error {
+	st := newStreamer(s.srv)
+	defer st.close()
+
+	if nil == gset {
+		found, err := st.seek(point)
+		if nil != err {
+			return errors.Trace(err)
+		}
+		if !found {
+			return newFatalError("Could not find binlog position %s:%d in binary log index file",
+				point.Filename, point.Offset)
+		}
+		logrus.Infof("Replica dumps binlog from %s:%d", point.Filename, point.Offset)
+	} else {
+		if err := st.nextFile(); nil != err && io.EOF != err {
+			return errors.Trace(err)
+		}
+		if nil != st.r {
+			// Transactions before the oldest binlog file are purged
+			purged, err := st.previousGTIDs()
+			if nil != err {
+				return errors.Trace(err)
+			}
+			if nil != purged && !gset.Contain(purged) {
+				return newFatalError("The slave is connecting using CHANGE MASTER TO MASTER_AUTO_POSITION = 1, " +
+					"but the master has purged binary logs containing GTIDs that the slave requires")
+			}
+		}
+		point = st.point
+		logrus.Infof("Replica dumps binlog by gtid %s", gset.String())
+	}
+
+	// The checksum aware replica sets the variable to the checksum of the master
+	replicaChecksum := strings.ToUpper(s.vars["master_binlog_checksum"])
+	headerSent := false
+	skipping := false
+	var lastSend time.Time
+	for {
+		data, err := st.next()
+		if nil != err {
+			if io.EOF != err {
+				return errors.Trace(err)
+			}
+			if 0 != flags&mconn.BinlogDumpNonBlock {
+				return errors.Trace(s.sc.WriteEOF())
+			}
+			// Wait for new events
+			select {
+			case <-s.quit:
+				{
+					return io.EOF
+				}
+			case <-time.After(pollInterval):
+				{
+				}
+			}
+			if period := s.heartbeatPeriod(); headerSent && period > 0 && time.Since(lastSend) >= period {
+				if err = s.writeArtificialEvent(binlog.HeartbeatEventType, []byte(st.point.Filename),
+					st.point.Offset, st.checksum); nil != err {
+					return errors.Trace(err)
+				}
+				lastSend = time.Now()
+			}
+			continue
+		}
+
+		tp := data[4]
+		if (!headerSent || binlog.FormatDescriptionEventType == tp) &&
+			binlog.ChecksumAlgCRC32 == st.checksum && "CRC32" != replicaChecksum {
+			return newFatalError("Slave can not handle replication events with the checksum that master is configured to log")
+		}
+		if !headerSent {
+			// The fake rotate event tells the replica the binlog file, then the format description
+			// event is sent if the dump does not start at the beginning of the file
+			if nil == st.format {
+				return newFatalError("missing format description event before %s:%d",
+					st.point.Filename, st.point.Offset)
+			}
+			if "" == point.Filename {
+				// The gtid dump waits for the first binlog file
+				point = st.point
+			}
+			w := serialize.NewBinWriter(nil)
+			w.WriteUint64(uint64(point.Offset))
+			w.WriteEOFString(point.Filename)
+			if err = s.writeArtificialEvent(binlog.RotateEventType, w.Bytes(), 0, st.checksum); nil != err {
+				return errors.Trace(err)
+			}
+			if binlog.FormatDescriptionEventType != tp {
+				if err = s.writeFormatDescription(st.format, st.checksum); nil != err {
+					return errors.Trace(err)
+				}
+			}
+			headerSent = true
+		}
+
+		if nil != gset {
+			if binlog.GTIDEventType == tp {
+				one, err := st.gtidOf(data)
+				if nil != err {
+					return errors.Trace(err)
+				}
+				skipping = gset.Contain(one)
+			}
+			if skipping && binlog.RotateEventType != tp && binlog.FormatDescriptionEventType != tp {
+				continue
+			}
+		}
+		if err = s.writeEvent(data); nil != err {
+			return errors.Trace(err)
+		}
+		lastSend = time.Now()
+	}
+}
+
+// writeFormatDescription sends the format description event, the log position is 0
+// to tell the replica not to update the position
+func (s *session) writeFormatDescription(data []byte, checksum uint8) error {
+	var header binlog.EventHeader
+	header.Timestamp = binary.LittleEndian.Uint32(data)
+	header.EventType = binlog.FormatDescriptionEventType
+	header.ServerID = s.srv.cfg.ServerID
+	body := data[eventHeaderLength:]
+	if binlog.ChecksumAlgCRC32 == checksum {
+		body = body[:len(body)-4]
+	}
+	return errors.Trace(s.writeEvent(header.Encode(body, checksum)))
+}
@@ -0,0 +1,273 @@
+package binlogserver
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/binlog"
+	"github.com/sryanyuan/binp/mconn"
+)
+
+const eventHeaderLength = 19
+
+// readIndex returns the paths of binlog files listed in the index file
+func (s *Server) readIndex() ([]string, error) {
+	f, err := os.Open(filepath.Join(s.cfg.Dir, s.cfg.IndexFile))
+	if nil != err {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Trace(err)
+	}
+	defer f.Close()
+
+	var files []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if "" == name {
+			continue
+		}
+		files = append(files, filepath.Join(s.cfg.Dir, filepath.Base(name)))
+	}
+	if err = scanner.Err(); nil != err {
+		return nil, errors.Trace(err)
+	}
+	return files, nil
+}
+
+// checksum returns the checksum algorithm of the newest binlog file, NONE or CRC32
+func (s *Server) checksum() (string, error) {
+	files, err := s.readIndex()
+	if nil != err {
+		return "", errors.Trace(err)
+	}
+	if 0 == len(files) {
+		return "NONE", nil
+	}
+	r, err := binlog.NewFileReader(files[len(files)-1], nil)
+	if nil != err {
+		return "", errors.Trace(err)
+	}
+	defer r.Close()
+	data, err := r.NextData()
+	if nil != err {
+		return "", errors.Trace(err)
+	}
+	if binlog.FormatDescriptionEventType == data[4] &&
+		binlog.ChecksumAlgCRC32 == binlog.FormatDescriptionChecksum(data) {
+		return "CRC32", nil
+	}
+	return "NONE", nil
+}
+
+// streamer reads events of the binlog files in order and tracks the master point of
+// events. A binlog file copied from the master starts at the point of its name, and
+// rotate events in relay log files tell the master point
+type streamer struct {
+	srv   *Server
+	files []string
+	index int
+	r     *binlog.FileReader
+	point mconn.ReplicationPoint
+	// format is the last format description event, checksum is its checksum algorithm
+	format   []byte
+	checksum uint8
+}
+
+func newStreamer(srv *Server) *streamer {
+	return &streamer{srv: srv, index: -1}
+}
+
+func (st *streamer) close() {
+	if nil != st.r {
+		st.r.Close()
+		st.r = nil
+	}
+}
+
+// next returns the next event, io.EOF is returned if no more events for now
+func (st *streamer) next() ([]byte, error) {
+	for {
+		if nil != st.r {
+			data, err := st.r.NextData()
+			if nil == err {
+				if err = st.onEvent(data); nil != err {
+					return nil, errors.Trace(err)
+				}
+				return data, nil
+			}
+			if io.EOF != err && io.ErrUnexpectedEOF != err {
+				return nil, errors.Trace(err)
+			}
+		}
+		if err := st.nextFile(); nil != err {
+			return nil, err
+		}
+	}
+}
+
+// seek reads events until the master point, returns false if the point is not found
+func (st *streamer) seek(point mconn.ReplicationPoint) (bool, error) {
+	if err := st.nextFile(); nil != err {
+		if io.EOF == err {
+			return false, nil
+		}
+		return false, err
+	}
+	for {
+		if st.point.Filename == point.Filename && st.point.Offset == point.Offset {
+			return true, nil
+		}
+		data, err := st.r.NextData()
+		if nil == err {
+			if err = st.onEvent(data); nil != err {
+				return false, errors.Trace(err)
+			}
+			continue
+		}
+		if io.EOF != err && io.ErrUnexpectedEOF != err {
+			return false, errors.Trace(err)
+		}
+		if err = st.nextFile(); nil != err {
+			if io.EOF == err {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+}
+
+// nextFile opens the file after the current file, io.EOF is returned if it is not created
+func (st *streamer) nextFile() error {
+	files, err := st.srv.readIndex()
+	if nil != err {
+		return errors.Trace(err)
+	}
+	next := 0
+	if nil != st.r {
+		current := st.files[st.index]
+		next = -1
+		for i, name := range files {
+			if name == current {
+				next = i + 1
+				break
+			}
+		}
+		if next < 0 {
+			return newFatalError("binlog file %s is purged while reading", filepath.Base(current))
+		}
+	}
+	if next >= len(files) {
+		return io.EOF
+	}
+
+	r, err := binlog.NewFileReader(files[next], nil)
+	if nil != err {
+		return errors.Trace(err)
+	}
+	st.close()
+	st.files = files
+	st.index = next
+	st.r = r
+	st.point = mconn.ReplicationPoint{Filename: filepath.Base(files[next]), Offset: 4}
+	return nil
+}
+
+// onEvent tracks the master point after the event
+func (st *streamer) onEvent(data []byte) error {
+	if logPos := binary.LittleEndian.Uint32(data[13:]); logPos > 0 {
+		st.point.Offset = logPos
+	}
+	switch data[4] {
+	case binlog.FormatDescriptionEventType:
+		{
+			st.format = data
+			st.checksum = binlog.FormatDescriptionChecksum(data)
+		}
+	case binlog.RotateEventType:
+		{
+			var evt binlog.RotateEvent
+			if err := evt.Decode(st.body(data)); nil != err {
+				return errors.Trace(err)
+			}
+			st.point.Filename = evt.NextName
+			st.point.Offset = uint32(evt.Position)
+		}
+	}
+	return nil
+}
+
+// body returns the event body without the header and checksum
+func (st *streamer) body(data []byte) []byte {
+	body := data[eventHeaderLength:]
+	if binlog.ChecksumAlgCRC32 == st.checksum {
+		body = body[:len(body)-4]
+	}
+	return body
+}
+
+// gtidOf returns the gtid of the gtid event
+func (st *streamer) gtidOf(data []byte) (mconn.GTIDSet, error) {
+	var evt binlog.GTIDEvent
+	if err := evt.Decode(st.body(data)); nil != err {
+		return nil, errors.Trace(err)
+	}
+	gset, err := mconn.ParseMysqlGTIDSet(evt.String())
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	return gset, nil
+}
+
+// previousGTIDs returns the previous gtids of the current file, nil if the file doesn't
+// log it. The file is read by another reader to keep the stream at the start
+func (st *streamer) previousGTIDs() (mconn.GTIDSet, error) {
+	r, err := binlog.NewFileReader(st.files[st.index], nil)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	defer r.Close()
+
+	var checksum uint8
+	for {
+		data, err := r.NextData()
+		if nil != err {
+			if io.EOF == err || io.ErrUnexpectedEOF == err {
+				return nil, nil
+			}
+			return nil, errors.Trace(err)
+		}
+		switch data[4] {
+		case binlog.FormatDescriptionEventType:
+			{
+				checksum = binlog.FormatDescriptionChecksum(data)
+			}
+		case binlog.RotateEventType:
+			{
+				// Relay log files tell the master point first
+			}
+		case binlog.PreviousGtidsEventType:
+			{
+				body := data[eventHeaderLength:]
+				if binlog.ChecksumAlgCRC32 == checksum {
+					body = body[:len(body)-4]
+				}
+				var evt binlog.PreviousGTIDsEvent
+				if err = evt.Decode(body); nil != err {
+					return nil, errors.Trace(err)
+				}
+				return evt.GTIDSet, nil
+			}
+		default:
+			{
+				return nil, nil
+			}
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/binlogserver"
 	"github.com/sryanyuan/binp/mconn"
 	"github.com/sryanyuan/binp/rule"
 	"github.com/sryanyuan/binp/worker"
@@ -22,10 +23,12 @@ type AppConfig struct {
 	Log         LogConfig               `json:"log" toml:"log"`
 	SRule       rule.DefaultSyncConfig  `json:"sync-rule" toml:"sync-rule"`
 	// Dispatch policy, dispatch by table name by default, optional values:
-	// 0:dispatch by table 1:dispatch by primary key
+	// 0:dispatch by table 1:dispatch by primary key 2:dispatch by the logical clock of the master
 	DispatchPolicy int `json:"dispatch-policy" toml:"dispatch policy"`
 	// Storage source, support local (start with prefix ls: )
 	StorageSource string `json:"storage-source" toml:"storage-source"`
+	// Binlog server serves the relay log to downstream replicas
+	BinlogServer binlogserver.Config `json:"binlog-server" toml:"binlog-server"`
 }
 
 func (c *AppConfig) fromFile(cpath string) error {
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"database/sql"
+	"io"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sryanyuan/binp/utils"
@@ -28,18 +30,28 @@ type EventHandler struct {
 	strw   *storageReaderWriter
 	wmgr   *worker.WorkerManager
 	tables map[string]*tableinfo.TableInfo
-	nchain *observer.NotifyChain
+	// Table map events of the tables built from the binlog metadata
+	tableMaps map[string]*binlog.TableMapEvent
+	nchain    *observer.NotifyChain
+	// Tracks the replication point of handled events
+	tracker *slave.PointTracker
 
-	fromDBs []*sql.DB
+	// Logical clock of the current transaction
+	lastCommitted  int64
+	sequenceNumber int64
+
+	fromDBs   []*sql.DB
+	closeOnce sync.Once
 }
 
 // NewEventHandler create a event handler
 func NewEventHandler(s *slave.Slave, cfg *AppConfig) *EventHandler {
 	return &EventHandler{
-		slv:    s,
-		cfg:    cfg,
-		tables: make(map[string]*tableinfo.TableInfo),
-		nchain: &observer.NotifyChain{},
+		slv:       s,
+		cfg:       cfg,
+		tables:    make(map[string]*tableinfo.TableInfo),
+		tableMaps: make(map[string]*binlog.TableMapEvent),
+		nchain:    &observer.NotifyChain{},
 	}
 }
 
@@ -80,13 +92,7 @@ func (e *EventHandler) Prepare() error {
 	e.fromDBs = make([]*sql.DB, 0, len(e.cfg.DataSources))
 	for i := range e.cfg.DataSources {
 		ds := &e.cfg.DataSources[i]
-		var sourceConfig mconn.DBConfig
-		sourceConfig.Host = ds.Host
-		sourceConfig.Port = ds.Port
-		sourceConfig.Username = ds.Username
-		sourceConfig.Password = ds.Password
-		sourceConfig.Type = "mysql"
-		fromDB, err := utils.CreateDB(&sourceConfig)
+		fromDB, err := utils.CreateDB(ds.ToDBConfig())
 		if nil != err {
 			return errors.Annotate(err, "Create mysql master connection failed")
 		}
@@ -117,16 +123,29 @@ func (e *EventHandler) Prepare() error {
 		return errors.Trace(err)
 	}
 
+	// The gtid flavor is known after the slave started
+	e.tracker, err = slave.NewPointTracker(position, e.slv.GTIDFlavor())
+	if nil != err {
+		return errors.Trace(err)
+	}
+
 	return nil
 }
 
 // Close closes the event handler and stop the slave
 func (e *EventHandler) Close() error {
-	// Close the slave
-	e.slv.Stop()
-	// Stop workers
-	e.wmgr.Stop()
-	return nil
+	var err error
+	e.closeOnce.Do(func() {
+		// Close the slave
+		e.slv.Stop()
+		// Stop workers
+		e.wmgr.Stop()
+		// Save the last written point, the lazy save may not have saved it yet
+		if nil != e.strw {
+			err = e.strw.savePositive()
+		}
+	})
+	return errors.Trace(err)
 }
 
 func (e *EventHandler) handleEvent() error {
@@ -139,6 +158,15 @@ func (e *EventHandler) handleEvent() error {
 		if err == context.DeadlineExceeded {
 			continue
 		}
+		// The binlog dump is done, save the point after all jobs are committed
+		if err == io.EOF {
+			e.wmgr.Flush()
+			point := e.tracker.Point()
+			if err = e.strw.writePoint(&point); nil != err {
+				return errors.Trace(err)
+			}
+			return errors.Trace(e.strw.savePositive())
+		}
 		// Check error
 		if nil != err {
 			return errors.Trace(err)
@@ -152,10 +180,10 @@ func (e *EventHandler) handleEvent() error {
 
 func (e *EventHandler) onBinlogEvent(event *binlog.Event) error {
 	var err error
-	var point mconn.ReplicationPoint
-	if event.Header.LogPos > 0 {
-		point.Offset = event.Header.LogPos
+	if err = e.tracker.OnEvent(event); nil != err {
+		return errors.Trace(err)
 	}
+	point := e.tracker.Point()
 
 	// Here we interest is to record the current replication point(position or gtid)
 	// and filter event we do not interested. Column filter and rewrite will also processed here.
@@ -169,8 +197,6 @@ func (e *EventHandler) onBinlogEvent(event *binlog.Event) error {
 		{
 			evt := event.Payload.Rotate
 			logrus.Infof("Rotate to binlog %v:%v", evt.NextName, evt.Position)
-			point.Filename = evt.NextName
-			point.Offset = uint32(evt.Position)
 		}
 	case binlog.QueryEventType:
 		{
@@ -179,7 +205,8 @@ func (e *EventHandler) onBinlogEvent(event *binlog.Event) error {
 		}
 	case binlog.WriteRowsEventV0Type, binlog.WriteRowsEventV1Type, binlog.WriteRowsEventV2Type,
 		binlog.UpdateRowsEventV0Type, binlog.UpdateRowsEventV1Type, binlog.UpdateRowsEventV2Type,
-		binlog.DeleteRowsEventV0Type, binlog.DeleteRowsEventV1Type, binlog.DeleteRowsEventV2Type:
+		binlog.DeleteRowsEventV0Type, binlog.DeleteRowsEventV1Type, binlog.DeleteRowsEventV2Type,
+		binlog.PartialUpdateRowsEventType:
 		{
 			evt := event.Payload.Rows
 			logrus.Debug(evt)
@@ -187,68 +214,116 @@ func (e *EventHandler) onBinlogEvent(event *binlog.Event) error {
 				return errors.Trace(err)
 			}
 		}
-	case binlog.GTIDEventType:
+	case binlog.GTIDEventType, binlog.AnonymousGtidEventType:
 		{
 			evt := event.Payload.GTID
 			logrus.Debugf("%v", evt)
+			e.lastCommitted = evt.LastCommitted
+			e.sequenceNumber = evt.SequenceNumber
 		}
 	case binlog.MariadbGTIDEventType:
 		{
 			evt := event.Payload.MariadbGTID
 			logrus.Debugf("%v", evt)
+			e.lastCommitted, e.sequenceNumber = 0, 0
+		}
+	case binlog.IncidentEventType:
+		{
+			// The master may lose events, the destination can't be consistent any more
+			evt := event.Payload.Incident
+			return errors.Errorf("Incident event %d at %v: %s", evt.Type, point, evt.Message)
+		}
+	case binlog.PreviousGtidsEventType:
+		{
+			evt := event.Payload.PreviousGTIDs
+			logrus.Debugf("previous gtids %v", evt.GTIDSet)
+		}
+	case binlog.MariadbAnnotateRowsEventType:
+		{
+			evt := event.Payload.MariadbAnnotateRows
+			logrus.Debugf("annotate rows %v", evt.Query)
 		}
 	}
 
 	if err = e.nchain.Broadcast(event); nil != err {
 		return errors.Trace(err)
 	}
+
+	// Ack after all events of the transaction are committed and the point is saved,
+	// the flush commits the worker queues without waiting for the commit interval
+	if event.NeedAck {
+		e.wmgr.Flush()
+		if err = e.strw.writePoint(&point); nil == err {
+			err = e.strw.savePositive()
+		}
+		if nil != err {
+			// Don't ack the transaction which may be lost after restart
+			logrus.Errorf("Save point %v before semi-sync ack error: %v", point, err)
+			return nil
+		}
+		if err = e.slv.SemiSyncAck(point); nil != err {
+			// The master falls back to async replication if no ack is received
+			logrus.Errorf("Semi-sync ack error: %v", err)
+		}
+	}
 	return nil
 }
 
-func (e *EventHandler) getTable(schema string, table string, desc *rule.SyncDesc) (*tableinfo.TableInfo, error) {
+func (e *EventHandler) getTable(tme *binlog.TableMapEvent, desc *rule.SyncDesc) (*tableinfo.TableInfo, error) {
 	var err error
+	schema, table := tme.SchemaName, tme.TableName
 	key := utils.GetTableKey(schema, table)
 	ti, ok := e.tables[key]
 	if ok && ti != nil {
-		return ti, nil
+		// Table info from the binlog is rebuilt once the table map changes
+		if !tme.HasFullMetadata() || tme.SameTable(e.tableMaps[key]) {
+			return ti, nil
+		}
 	}
 
-	// Load table information from master
-	var tbl tableinfo.TableInfo
-	tbl.Schema = schema
-	tbl.Name = table
-	// TODO: If get information failed, retry and switch data source(Master slave switch)
-	if err = tbl.GetTableColumnInfo(e.fromDBs[e.slv.GetDataSourceIndex()], schema, table); nil != err {
-		return nil, errors.Trace(err)
-	}
-	if err = tbl.GetTablePrimaryKeys(e.fromDBs[e.slv.GetDataSourceIndex()], schema, table); nil != err {
-		return nil, errors.Trace(err)
+	if tme.HasFullMetadata() {
+		// The metadata describes the table when the event is written, the schema of
+		// the master may be changed
+		if ti, err = tableinfo.NewTableInfoFromTableMap(tme); nil != err {
+			return nil, errors.Trace(err)
+		}
+		e.tableMaps[key] = tme
+	} else {
+		// Load table information from master
+		ti = &tableinfo.TableInfo{Schema: schema, Name: table}
+		// TODO: If get information failed, retry and switch data source(Master slave switch)
+		if err = ti.GetTableColumnInfo(e.fromDBs[e.slv.GetDataSourceIndex()], schema, table); nil != err {
+			return nil, errors.Trace(err)
+		}
+		if err = ti.GetTablePrimaryKeys(e.fromDBs[e.slv.GetDataSourceIndex()], schema, table); nil != err {
+			return nil, errors.Trace(err)
+		}
+		delete(e.tableMaps, key)
 	}
 
 	// Handle table info with sync desc
-	tbl.IndexColumns = make([]*tableinfo.ColumnInfo, 0, len(tbl.Columns))
-	for _, col := range tbl.Columns {
+	ti.IndexColumns = make([]*tableinfo.ColumnInfo, 0, len(ti.Columns))
+	for _, col := range ti.Columns {
 		if col.IsPrimary {
-			tbl.IndexColumns = append(tbl.IndexColumns, col)
+			ti.IndexColumns = append(ti.IndexColumns, col)
 		}
 	}
 	if nil != desc {
 		if desc.IndexKeys != nil {
 			for _, ik := range desc.IndexKeys {
-				col := tableinfo.FindColumnByName(tbl.Columns, ik)
+				col := tableinfo.FindColumnByName(ti.Columns, ik)
 				if nil == col {
 					return nil, errors.Errorf("Can't find column %s by sync desc, table = %s",
 						ik, key)
 				}
-				tbl.IndexColumns = append(tbl.IndexColumns, col)
+				ti.IndexColumns = append(ti.IndexColumns, col)
 			}
 		}
 	}
-	if len(tbl.IndexColumns) == 0 {
+	if len(ti.IndexColumns) == 0 {
 		return nil, errors.Errorf("Table %s missing index key", key)
 	}
 
-	ti = &tbl
 	e.tables[key] = ti
 
 	return ti, nil
@@ -256,4 +331,5 @@ func (e *EventHandler) getTable(schema string, table string, desc *rule.SyncDesc
 
 func (e *EventHandler) cleanTable(schema string, table string) {
 	delete(e.tables, utils.GetTableKey(schema, table))
+	delete(e.tableMaps, utils.GetTableKey(schema, table))
 }
@@ -14,7 +14,7 @@ func (e *EventHandler) onRowsEvent(point *mconn.ReplicationPoint, evt *binlog.Ev
 		return errors.New("Nil rows payload")
 	}
 	// Get table info and check binlog meta and table info
-	ti, err := e.getTable(revt.Table.SchemaName, revt.Table.TableName, revt.Rule)
+	ti, err := e.getTable(revt.Table, revt.Rule)
 	if nil != err {
 		return errors.Trace(err)
 	}
@@ -23,7 +23,7 @@ func (e *EventHandler) onRowsEvent(point *mconn.ReplicationPoint, evt *binlog.Ev
 		// Force get table info again and check if new table info
 		// is valid
 		e.cleanTable(revt.Table.SchemaName, revt.Table.TableName)
-		ti, err = e.getTable(revt.Table.SchemaName, revt.Table.TableName, revt.Rule)
+		ti, err = e.getTable(revt.Table, revt.Rule)
 		if nil != err {
 			return errors.Trace(err)
 		}
@@ -39,10 +39,12 @@ func (e *EventHandler) onRowsEvent(point *mconn.ReplicationPoint, evt *binlog.Ev
 		job.Timestamp = evt.Header.Timestamp
 		job.Ti = ti
 		job.SDesc = revt.Rule
+		job.LastCommitted = e.lastCommitted
+		job.SequenceNumber = e.sequenceNumber
 		// Fill row data
-		job.Columns = tableinfo.FillColumnsWithValue(ti, revt.Rows[i].ColumnDatas)
+		job.Columns = tableinfo.FillColumnsWithValue(ti, revt.Rows[i].ColumnDatas, revt.Rows[i].Present)
 		if revt.Action == binlog.RowUpdate {
-			job.NewColumns = tableinfo.FillColumnsWithValue(ti, revt.Rows[i+1].ColumnDatas)
+			job.NewColumns = tableinfo.FillColumnsWithValue(ti, revt.Rows[i+1].ColumnDatas, revt.Rows[i+1].Present)
 		}
 		// Get event type
 		if revt.Action == binlog.RowWrite {
@@ -8,6 +8,7 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/sryanyuan/binp/binlogserver"
 	"github.com/sryanyuan/binp/dbg"
 	"github.com/sryanyuan/binp/rule"
 
@@ -67,10 +68,32 @@ func main() {
 	slv := slave.NewSlave(config.DataSources, &config.Replication, sr)
 	handler := NewEventHandler(slv, &config)
 	if err = handler.Prepare(); nil != err {
-		logrus.Errorf(errors.Details(err))
+		logrus.Error(errors.Details(err))
 		return
 	}
 
+	// Serve the relay log to downstream replicas
+	if "" != config.BinlogServer.Addr {
+		bcfg := config.BinlogServer
+		if "" == bcfg.Dir {
+			bcfg.Dir = config.Replication.RelayLog.Dir
+		}
+		if "" == bcfg.IndexFile && "" != config.Replication.RelayLog.BaseName {
+			bcfg.IndexFile = config.Replication.RelayLog.BaseName + ".index"
+		}
+		if config.Replication.RelayLog.IsEnabled() &&
+			0 == config.Replication.RelayLog.MaxAge && 0 == config.Replication.RelayLog.MaxTotalSize {
+			logrus.Warnf("Relay log files are purged once applied, replicas of the binlog server may miss them")
+		}
+		srv, err := binlogserver.NewServer(&bcfg)
+		if nil != err {
+			logrus.Errorf("start binlog server error = %v", err)
+			handler.Close()
+			return
+		}
+		defer srv.Close()
+	}
+
 	eh := make(chan struct{})
 	sh := make(chan os.Signal, 1)
 	signal.Notify(sh,
@@ -81,7 +104,9 @@ func main() {
 	go func() {
 		s := <-sh
 		logrus.Infof("Got signal %v", s)
-		handler.Close()
+		if err := handler.Close(); nil != err {
+			logrus.Errorf("Close event handler error: %v", err)
+		}
 		close(eh)
 	}()
 
@@ -96,6 +121,10 @@ func main() {
 	if nil != err {
 		logrus.Errorf("Handle binlog event error: %v", errors.ErrorStack(err))
 	} else {
-		<-eh
+		// Dump is done in non-block mode or the stop condition is reached
+		logrus.Infof("Binlog dump finished")
+		if err = handler.Close(); nil != err {
+			logrus.Errorf("Close event handler error: %v", err)
+		}
 	}
 }
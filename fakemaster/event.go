@@ -0,0 +1,413 @@
+package fakemaster
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+
+	"github.com/juju/errors"
+	"github.com/klauspost/compress/zstd"
+	"github.com/sryanyuan/binp/binlog"
+	"github.com/sryanyuan/binp/mconn"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+const (
+	eventHeaderLength = 19
+	binlogVersion     = 4
+	// rowsEventTableIDSize is the table id size of the table map and rows events
+	rowsEventTableIDSize = 6
+)
+
+// postHeaderLengths is the post header lengths of event types in the format
+// description event, the same as mysql 5.7
+var postHeaderLengths = []byte{
+	56, 13, 0, 8, 0, 18, 0, 4, 4, 4, 4, 18, 0, 0, 95, 0, 4, 26, 8, 0, 0, 0,
+	8, 8, 8, 2, 0, 0, 0, 10, 10, 10, 42, 42, 0, 18, 52, 0,
+}
+
+// Event is a binlog event appended to the fake master, the server id,
+// log position and checksum are filled when it is appended
+type Event struct {
+	Type      uint8
+	Timestamp uint32
+	Flags     uint16
+	Body      []byte
+}
+
+// encode encodes the event with the header and checksum
+func (e *Event) encode(serverID uint32, logPos uint32, checksum bool) []byte {
+	size := eventHeaderLength + len(e.Body)
+	if checksum {
+		size += 4
+	}
+	data := make([]byte, size)
+	binary.LittleEndian.PutUint32(data[0:], e.Timestamp)
+	data[4] = e.Type
+	binary.LittleEndian.PutUint32(data[5:], serverID)
+	binary.LittleEndian.PutUint32(data[9:], uint32(size))
+	binary.LittleEndian.PutUint32(data[13:], logPos)
+	binary.LittleEndian.PutUint16(data[17:], e.Flags)
+	copy(data[eventHeaderLength:], e.Body)
+	if checksum {
+		fillChecksum(data)
+	}
+	return data
+}
+
+// fillChecksum fills the crc32 checksum of the encoded event
+func fillChecksum(data []byte) {
+	l := len(data) - 4
+	binary.LittleEndian.PutUint32(data[l:], crc32.ChecksumIEEE(data[:l]))
+}
+
+// NewFormatDescriptionEvent creates the format description event
+func NewFormatDescriptionEvent(serverVersion string, timestamp uint32, checksum bool) *Event {
+	w := serialize.NewBinWriter(nil)
+	w.WriteUint16(binlogVersion)
+	var version [50]byte
+	copy(version[:], serverVersion)
+	w.WriteBytes(version[:])
+	w.WriteUint32(timestamp)
+	w.WriteUint8(eventHeaderLength)
+	w.WriteBytes(postHeaderLengths)
+	alg := uint8(binlog.ChecksumAlgOff)
+	if checksum {
+		alg = binlog.ChecksumAlgCRC32
+	}
+	w.WriteUint8(alg)
+	return &Event{
+		Type:      binlog.FormatDescriptionEventType,
+		Timestamp: timestamp,
+		Body:      w.Bytes(),
+	}
+}
+
+// NewRotateEvent creates the rotate event to the next binlog file
+func NewRotateEvent(nextName string, position uint64) *Event {
+	w := serialize.NewBinWriter(nil)
+	w.WriteUint64(position)
+	w.WriteEOFString(nextName)
+	return &Event{
+		Type: binlog.RotateEventType,
+		Body: w.Bytes(),
+	}
+}
+
+// NewHeartbeatEvent creates the heartbeat event of the binlog file
+func NewHeartbeatEvent(name string) *Event {
+	return &Event{
+		Type: binlog.HeartbeatEventType,
+		Body: []byte(name),
+	}
+}
+
+// NewQueryEvent creates the query event
+func NewQueryEvent(schema string, query string) *Event {
+	w := serialize.NewBinWriter(nil)
+	// slave proxy id, execution time
+	w.WriteUint32(1)
+	w.WriteUint32(0)
+	w.WriteUint8(uint8(len(schema)))
+	// error code and status vars length
+	w.WriteUint16(0)
+	w.WriteUint16(0)
+	w.WriteEOFString(schema)
+	w.WriteUint8(0)
+	w.WriteEOFString(query)
+	return &Event{
+		Type: binlog.QueryEventType,
+		Body: w.Bytes(),
+	}
+}
+
+// NewXidEvent creates the xid event commits the transaction
+func NewXidEvent(xid uint64) *Event {
+	w := serialize.NewBinWriter(nil)
+	w.WriteUint64(xid)
+	return &Event{
+		Type: binlog.XidEventType,
+		Body: w.Bytes(),
+	}
+}
+
+// NewGTIDEvent creates the gtid event of the gtid in uuid:gno format
+func NewGTIDEvent(gtid string) (*Event, error) {
+	gset, err := mconn.ParseMysqlGTIDSet(gtid)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	if 1 != len(gset.Sets) {
+		return nil, errors.Errorf("invalid gtid %s", gtid)
+	}
+	w := serialize.NewBinWriter(nil)
+	for _, us := range gset.Sets {
+		if 1 != len(us.Intervals) || us.Intervals[0].Start+1 != us.Intervals[0].Stop {
+			return nil, errors.Errorf("invalid gtid %s", gtid)
+		}
+		// commit flag
+		w.WriteUint8(1)
+		w.WriteBytes(us.SID.Bytes())
+		w.WriteInt64(us.Intervals[0].Start)
+	}
+	return &Event{
+		Type: binlog.GTIDEventType,
+		Body: w.Bytes(),
+	}, nil
+}
+
+// NewPreviousGTIDsEvent creates the previous gtids event of the gtid set
+func NewPreviousGTIDsEvent(gtids string) (*Event, error) {
+	gset, err := mconn.ParseMysqlGTIDSet(gtids)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	return &Event{
+		Type: binlog.PreviousGtidsEventType,
+		Body: gset.Encode(),
+	}, nil
+}
+
+// NewTransactionPayloadEvent creates the zstd compressed transaction payload event of
+// the events, inner events have no checksum and log position like mysql 8
+func NewTransactionPayloadEvent(events ...*Event) (*Event, error) {
+	var data []byte
+	for _, e := range events {
+		data = append(data, e.encode(defaultServerID, 0, false)...)
+	}
+	enc, err := zstd.NewWriter(nil)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	payload := enc.EncodeAll(data, nil)
+	enc.Close()
+
+	// Header fields of the compression type, uncompressed size and payload size
+	w := serialize.NewBinWriter(nil)
+	fields := [][2]uint64{
+		{2, binlog.PayloadCompressionZstd},
+		{3, uint64(len(data))},
+		{1, uint64(len(payload))},
+	}
+	for _, f := range fields {
+		v := serialize.NewBinWriter(nil)
+		v.WriteLenencInt(f[1])
+		w.WriteLenencInt(f[0])
+		w.WriteLenencInt(uint64(len(v.Bytes())))
+		w.WriteBytes(v.Bytes())
+	}
+	// header end mark
+	w.WriteLenencInt(0)
+	w.WriteBytes(payload)
+	return &Event{
+		Type: binlog.TransactionPayloadEventType,
+		Body: w.Bytes(),
+	}, nil
+}
+
+// Column is the column definition of the table
+type Column struct {
+	// Type is the mconn.FieldType* of the column
+	Type uint8
+	// Meta is the column meta, the max length of the varchar, the length bytes of the blob
+	Meta uint16
+}
+
+// Table is a table to create table map and rows events
+type Table struct {
+	ID      uint64
+	Schema  string
+	Name    string
+	Columns []Column
+}
+
+// NewTableMapEvent creates the table map event of the table
+func (t *Table) NewTableMapEvent() *Event {
+	w := serialize.NewBinWriter(nil)
+	writeTableID(w, t.ID)
+	w.WriteUint16(0)
+	w.WriteLenString(t.Schema)
+	w.WriteUint8(0)
+	w.WriteLenString(t.Name)
+	w.WriteUint8(0)
+	w.WriteLenencInt(uint64(len(t.Columns)))
+	meta := serialize.NewBinWriter(nil)
+	for _, col := range t.Columns {
+		w.WriteUint8(col.Type)
+		switch col.Type {
+		case mconn.FieldTypeVarChar, mconn.FieldTypeVarString:
+			{
+				meta.WriteUint16(col.Meta)
+			}
+		case mconn.FieldTypeBlob, mconn.FieldTypeDouble, mconn.FieldTypeFloat:
+			{
+				meta.WriteUint8(uint8(col.Meta))
+			}
+		}
+	}
+	w.WriteLenencBytes(meta.Bytes())
+	// All columns are nullable
+	nullBitmap := make([]byte, (len(t.Columns)+7)/8)
+	for i := range nullBitmap {
+		nullBitmap[i] = 0xff
+	}
+	w.WriteBytes(nullBitmap)
+	return &Event{
+		Type: binlog.TableMapEventType,
+		Body: w.Bytes(),
+	}
+}
+
+// NewWriteRowsEvent creates the v2 write rows event of the rows
+func (t *Table) NewWriteRowsEvent(rows ...[]interface{}) (*Event, error) {
+	return t.newRowsEvent(binlog.WriteRowsEventV2Type, rows)
+}
+
+// NewUpdateRowsEvent creates the v2 update rows event, rows are pairs of the before and after image
+func (t *Table) NewUpdateRowsEvent(rows ...[]interface{}) (*Event, error) {
+	if 0 != len(rows)%2 {
+		return nil, errors.New("update rows must be pairs")
+	}
+	return t.newRowsEvent(binlog.UpdateRowsEventV2Type, rows)
+}
+
+// NewDeleteRowsEvent creates the v2 delete rows event of the rows
+func (t *Table) NewDeleteRowsEvent(rows ...[]interface{}) (*Event, error) {
+	return t.newRowsEvent(binlog.DeleteRowsEventV2Type, rows)
+}
+
+func (t *Table) newRowsEvent(tp uint8, rows [][]interface{}) (*Event, error) {
+	w := serialize.NewBinWriter(nil)
+	writeTableID(w, t.ID)
+	w.WriteUint16(binlog.RowsEventFlagStmtEnd)
+	// extra data length, no extra data
+	w.WriteUint16(2)
+	w.WriteLenencInt(uint64(len(t.Columns)))
+	// All columns are present
+	bitmap := make([]byte, (len(t.Columns)+7)/8)
+	for i := range bitmap {
+		bitmap[i] = 0xff
+	}
+	w.WriteBytes(bitmap)
+	if binlog.UpdateRowsEventV2Type == tp {
+		w.WriteBytes(bitmap)
+	}
+
+	for _, row := range rows {
+		if len(row) != len(t.Columns) {
+			return nil, errors.Errorf("row has %d columns, want %d", len(row), len(t.Columns))
+		}
+		nullBitmap := make([]byte, (len(t.Columns)+7)/8)
+		values := serialize.NewBinWriter(nil)
+		for i, v := range row {
+			if nil == v {
+				nullBitmap[i/8] |= 1 << uint(i%8)
+				continue
+			}
+			if err := writeValue(values, &t.Columns[i], v); nil != err {
+				return nil, errors.Annotatef(err, "column %d", i)
+			}
+		}
+		w.WriteBytes(nullBitmap)
+		w.WriteBytes(values.Bytes())
+	}
+
+	return &Event{
+		Type: tp,
+		Body: w.Bytes(),
+	}, nil
+}
+
+func writeTableID(w *serialize.BinWriter, id uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], id)
+	w.WriteBytes(buf[:rowsEventTableIDSize])
+}
+
+func toInt64(v interface{}) (int64, error) {
+	switch iv := v.(type) {
+	case int:
+		{
+			return int64(iv), nil
+		}
+	case int8:
+		{
+			return int64(iv), nil
+		}
+	case int16:
+		{
+			return int64(iv), nil
+		}
+	case int32:
+		{
+			return int64(iv), nil
+		}
+	case int64:
+		{
+			return iv, nil
+		}
+	}
+	return 0, errors.Errorf("value %v is not an integer", v)
+}
+
+// writeValue writes the row value of the column
+func writeValue(w *serialize.BinWriter, col *Column, v interface{}) error {
+	switch col.Type {
+	case mconn.FieldTypeTiny, mconn.FieldTypeShort, mconn.FieldTypeInt24,
+		mconn.FieldTypeLong, mconn.FieldTypeLongLong:
+		{
+			iv, err := toInt64(v)
+			if nil != err {
+				return errors.Trace(err)
+			}
+			var buf [8]byte
+			binary.LittleEndian.PutUint64(buf[:], uint64(iv))
+			size := map[uint8]int{
+				mconn.FieldTypeTiny:     1,
+				mconn.FieldTypeShort:    2,
+				mconn.FieldTypeInt24:    3,
+				mconn.FieldTypeLong:     4,
+				mconn.FieldTypeLongLong: 8,
+			}[col.Type]
+			return errors.Trace(w.WriteBytes(buf[:size]))
+		}
+	case mconn.FieldTypeDouble:
+		{
+			fv, ok := v.(float64)
+			if !ok {
+				return errors.Errorf("value %v is not a float64", v)
+			}
+			return errors.Trace(w.WriteUint64(math.Float64bits(fv)))
+		}
+	case mconn.FieldTypeVarChar, mconn.FieldTypeVarString, mconn.FieldTypeBlob:
+		{
+			var data []byte
+			switch sv := v.(type) {
+			case string:
+				{
+					data = []byte(sv)
+				}
+			case []byte:
+				{
+					data = sv
+				}
+			default:
+				{
+					return errors.Errorf("value %v is not a string", v)
+				}
+			}
+			// The length bytes of varchar depends on the max length
+			lenBytes := 1
+			if mconn.FieldTypeBlob == col.Type {
+				lenBytes = int(col.Meta)
+			} else if col.Meta >= 256 {
+				lenBytes = 2
+			}
+			var buf [4]byte
+			binary.LittleEndian.PutUint32(buf[:], uint32(len(data)))
+			w.WriteBytes(buf[:lenBytes])
+			return errors.Trace(w.WriteBytes(data))
+		}
+	}
+	return errors.Errorf("unsupported column type %d", col.Type)
+}
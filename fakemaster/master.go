@@ -0,0 +1,299 @@
+// Package fakemaster implements an in-process mysql master for tests, it serves
+// the queries issued by slaves and streams scripted or file-backed binlog events
+package fakemaster
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sryanyuan/binp/binlog"
+	"github.com/sryanyuan/binp/mconn"
+)
+
+const (
+	defaultServerID      = 1
+	defaultServerVersion = "5.7.30-fakemaster"
+	defaultBinlogBase    = "mysql-bin"
+)
+
+// Config is the config of the fake master
+type Config struct {
+	// Addr is the listen address, 127.0.0.1:0 by default
+	Addr          string
+	ServerID      uint32
+	ServerVersion string
+	// Username and Password are the account of slaves, any user is accepted if empty
+	Username string
+	Password string
+	// Checksum enables the crc32 checksum of binlog events
+	Checksum bool
+	// BinlogBase is the base name of binlog files
+	BinlogBase string
+}
+
+// binlogFile is a binlog file of the master, data contains the magic header
+type binlogFile struct {
+	name string
+	data []byte
+}
+
+// Master is a fake mysql master
+type Master struct {
+	cfg Config
+	ln  net.Listener
+	wg  sync.WaitGroup
+
+	mu       sync.Mutex
+	files    []*binlogFile
+	vars     map[string]string
+	sessions map[uint32]*session
+	connID   uint32
+	dumps    int
+	closed   bool
+	// notify is closed and renewed once binlog events are appended
+	notify chan struct{}
+}
+
+// NewMaster creates a fake master listens on the address, a binlog file starts
+// with the format description event is created
+func NewMaster(cfg *Config) (*Master, error) {
+	m := &Master{
+		cfg:      *cfg,
+		vars:     make(map[string]string),
+		sessions: make(map[uint32]*session),
+		notify:   make(chan struct{}),
+	}
+	if 0 == m.cfg.ServerID {
+		m.cfg.ServerID = defaultServerID
+	}
+	if "" == m.cfg.ServerVersion {
+		m.cfg.ServerVersion = defaultServerVersion
+	}
+	if "" == m.cfg.BinlogBase {
+		m.cfg.BinlogBase = defaultBinlogBase
+	}
+	if "" == m.cfg.Addr {
+		m.cfg.Addr = "127.0.0.1:0"
+	}
+
+	checksum := "NONE"
+	if m.cfg.Checksum {
+		checksum = "CRC32"
+	}
+	m.vars["binlog_checksum"] = checksum
+	m.vars["server_id"] = fmt.Sprint(m.cfg.ServerID)
+	m.vars["version"] = m.cfg.ServerVersion
+	m.vars["rpl_semi_sync_master_enabled"] = "OFF"
+	m.newBinlogFile(fmt.Sprintf("%s.%06d", m.cfg.BinlogBase, 1))
+
+	ln, err := net.Listen("tcp", m.cfg.Addr)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	m.ln = ln
+	m.wg.Add(1)
+	go m.acceptLoop()
+
+	return m, nil
+}
+
+// Addr returns the listening address
+func (m *Master) Addr() *net.TCPAddr {
+	return m.ln.Addr().(*net.TCPAddr)
+}
+
+// DataSource returns the data source connecting to the master
+func (m *Master) DataSource() mconn.DataSource {
+	return mconn.DataSource{
+		Host:     m.Addr().IP.String(),
+		Port:     uint16(m.Addr().Port),
+		Username: m.cfg.Username,
+		Password: m.cfg.Password,
+	}
+}
+
+// Close stops the master and closes all connections
+func (m *Master) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	m.mu.Unlock()
+
+	m.ln.Close()
+	m.KillConnections()
+	m.wg.Wait()
+}
+
+// KillConnections closes all connections of the master, like slaves lost the master
+func (m *Master) KillConnections() {
+	m.mu.Lock()
+	for id, s := range m.sessions {
+		s.close()
+		delete(m.sessions, id)
+	}
+	m.mu.Unlock()
+}
+
+// SetVariable sets the global variable returned by SHOW VARIABLES and SELECT @@global
+func (m *Master) SetVariable(name string, value string) {
+	m.mu.Lock()
+	m.vars[name] = value
+	m.mu.Unlock()
+}
+
+func (m *Master) getVariable(name string) (string, bool) {
+	m.mu.Lock()
+	v, ok := m.vars[name]
+	m.mu.Unlock()
+	return v, ok
+}
+
+// Dumps returns the count of binlog dump requests received
+func (m *Master) Dumps() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dumps
+}
+
+// Point returns the end position of binlog
+func (m *Master) Point() mconn.ReplicationPoint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f := m.files[len(m.files)-1]
+	return mconn.ReplicationPoint{
+		Filename: f.name,
+		Offset:   uint32(len(f.data)),
+	}
+}
+
+// AppendEvents appends events to the current binlog file and wakes up dumping slaves,
+// zero timestamps are filled with the current time
+func (m *Master) AppendEvents(events ...*Event) {
+	m.mu.Lock()
+	for _, e := range events {
+		m.appendEvent(e)
+	}
+	m.wakeup()
+	m.mu.Unlock()
+}
+
+// Rotate writes the rotate event and switches to a new binlog file, returns the new file name
+func (m *Master) Rotate() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name := fmt.Sprintf("%s.%06d", m.cfg.BinlogBase, len(m.files)+1)
+	m.appendEvent(NewRotateEvent(name, 4))
+	m.newBinlogFile(name)
+	m.wakeup()
+	return name
+}
+
+// LoadBinlogFile appends the binlog file as the newest binlog of the master, events are
+// served as is, so the checksum config must match the file
+func (m *Master) LoadBinlogFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		return errors.Trace(err)
+	}
+	if !bytes.HasPrefix(data, binlog.FileMagic) {
+		return errors.Errorf("%s is not a binlog file", path)
+	}
+	// Validates the event sizes
+	for pos := len(binlog.FileMagic); pos < len(data); {
+		if pos+eventHeaderLength > len(data) {
+			return errors.Errorf("truncated event header at %d", pos)
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos+9:]))
+		if size < eventHeaderLength || pos+size > len(data) {
+			return errors.Errorf("invalid event size %d at %d", size, pos)
+		}
+		pos += size
+	}
+
+	m.mu.Lock()
+	m.files = append(m.files, &binlogFile{name: filepath.Base(path), data: data})
+	m.wakeup()
+	m.mu.Unlock()
+	return nil
+}
+
+// SaveBinlogFiles writes the binlog files of the master to the directory
+func (m *Master) SaveBinlogFiles(dir string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, f := range m.files {
+		if err := ioutil.WriteFile(filepath.Join(dir, f.name), f.data, 0644); nil != err {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func (m *Master) newBinlogFile(name string) {
+	f := &binlogFile{name: name}
+	f.data = append(f.data, binlog.FileMagic...)
+	m.files = append(m.files, f)
+	m.appendEvent(NewFormatDescriptionEvent(m.cfg.ServerVersion, uint32(time.Now().Unix()), m.cfg.Checksum))
+}
+
+func (m *Master) appendEvent(e *Event) {
+	f := m.files[len(m.files)-1]
+	ev := *e
+	if 0 == ev.Timestamp {
+		ev.Timestamp = uint32(time.Now().Unix())
+	}
+	size := eventHeaderLength + len(ev.Body)
+	if m.cfg.Checksum {
+		size += 4
+	}
+	f.data = append(f.data, ev.encode(m.cfg.ServerID, uint32(len(f.data)+size), m.cfg.Checksum)...)
+}
+
+func (m *Master) wakeup() {
+	close(m.notify)
+	m.notify = make(chan struct{})
+}
+
+func (m *Master) acceptLoop() {
+	defer m.wg.Done()
+
+	for {
+		conn, err := m.ln.Accept()
+		if nil != err {
+			return
+		}
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			conn.Close()
+			return
+		}
+		m.connID++
+		s := newSession(m, m.connID, conn)
+		m.sessions[s.id] = s
+		m.mu.Unlock()
+
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			if err := s.serve(); nil != err {
+				logrus.Debugf("Fake master session %d exit: %v", s.id, err)
+			}
+			m.mu.Lock()
+			delete(m.sessions, s.id)
+			m.mu.Unlock()
+			s.close()
+		}()
+	}
+}
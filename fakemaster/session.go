@@ -0,0 +1,327 @@
+package fakemaster
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/binlog"
+	"github.com/sryanyuan/binp/mconn"
+)
+
+var (
+	setRegexp          = regexp.MustCompile(`(?i)^SET\s+@(\w+)\s*=\s*(.+)$`)
+	selectRegexp       = regexp.MustCompile(`(?i)^SELECT\s+(@@global\.|@@|@)(\w+)$`)
+	showVariableRegexp = regexp.MustCompile(`(?i)^SHOW\s+(GLOBAL\s+|SESSION\s+)?VARIABLES\s+LIKE\s+'([^']*)'$`)
+)
+
+// session is a client connection of the master
+type session struct {
+	m    *Master
+	id   uint32
+	conn net.Conn
+	sc   *mconn.ServerConn
+	// vars are the user variables of the session
+	vars      map[string]string
+	quit      chan struct{}
+	closeOnce sync.Once
+}
+
+func newSession(m *Master, id uint32, conn net.Conn) *session {
+	return &session{
+		m:    m,
+		id:   id,
+		conn: conn,
+		vars: make(map[string]string),
+		quit: make(chan struct{}),
+	}
+}
+
+func (s *session) close() {
+	s.closeOnce.Do(func() {
+		close(s.quit)
+		s.conn.Close()
+	})
+}
+
+func (s *session) serve() error {
+	sc, err := mconn.NewServerConn(s.conn, &mconn.ServerConfig{
+		ServerVersion: s.m.cfg.ServerVersion,
+		ConnectionID:  s.id,
+		Username:      s.m.cfg.Username,
+		Password:      s.m.cfg.Password,
+	})
+	if nil != err {
+		return errors.Trace(err)
+	}
+	s.sc = sc
+
+	for {
+		data, err := sc.ReadCommand()
+		if nil != err {
+			return errors.Trace(err)
+		}
+
+		switch data[0] {
+		case mconn.ComQuit:
+			{
+				return nil
+			}
+		case mconn.ComPing:
+			{
+				err = sc.WriteOK(0, 0)
+			}
+		case mconn.ComQuery:
+			{
+				err = s.handleQuery(strings.TrimSpace(string(data[1:])))
+			}
+		case mconn.ComRegisterSlave:
+			{
+				var prs mconn.PacketRegisterSlave
+				if err = prs.Decode(data); nil != err {
+					return errors.Trace(err)
+				}
+				err = sc.WriteOK(0, 0)
+			}
+		case mconn.ComBinlogDump:
+			{
+				var pbd mconn.PacketBinlogDump
+				if err = pbd.Decode(data); nil != err {
+					return errors.Trace(err)
+				}
+				return errors.Trace(s.dump(pbd.BinlogFile, pbd.BinlogPos, pbd.Flags, nil))
+			}
+		case mconn.ComBinlogDumpGtid:
+			{
+				var pbd mconn.PacketBinlogDumpGtid
+				if err = pbd.Decode(data); nil != err {
+					return errors.Trace(err)
+				}
+				gset, err := mconn.DecodeMysqlGTIDSet(pbd.Data)
+				if nil != err {
+					return errors.Trace(err)
+				}
+				return errors.Trace(s.dump("", 4, pbd.Flags, gset))
+			}
+		default:
+			{
+				err = sc.WriteError(mconn.ErrCodeUnknownCommand, "08S01",
+					fmt.Sprintf("Unknown command %d", data[0]))
+			}
+		}
+		if nil != err {
+			return errors.Trace(err)
+		}
+	}
+}
+
+func (s *session) handleQuery(query string) error {
+	if matches := setRegexp.FindStringSubmatch(query); nil != matches {
+		s.vars[strings.ToLower(matches[1])] = s.evalExpr(strings.TrimSpace(matches[2]))
+		return errors.Trace(s.sc.WriteOK(0, 0))
+	}
+	if matches := selectRegexp.FindStringSubmatch(query); nil != matches {
+		var value interface{}
+		name := strings.ToLower(matches[2])
+		if "@" == matches[1] {
+			if v, ok := s.vars[name]; ok {
+				value = v
+			}
+		} else if v, ok := s.m.getVariable(name); ok {
+			value = v
+		}
+		return errors.Trace(s.sc.WriteResultSet([]string{matches[1] + matches[2]},
+			[][]interface{}{{value}}))
+	}
+	if matches := showVariableRegexp.FindStringSubmatch(query); nil != matches {
+		var rows [][]interface{}
+		if v, ok := s.m.getVariable(strings.ToLower(matches[2])); ok {
+			rows = append(rows, []interface{}{matches[2], v})
+		}
+		return errors.Trace(s.sc.WriteResultSet([]string{"Variable_name", "Value"}, rows))
+	}
+	return errors.Trace(s.sc.WriteError(mconn.ErrCodeUnknownError, "HY000",
+		fmt.Sprintf("Unsupported query %s", query)))
+}
+
+// evalExpr evaluates the value of SET statement, supports literals and global variables
+func (s *session) evalExpr(expr string) string {
+	if strings.HasPrefix(strings.ToLower(expr), "@@global.") {
+		v, _ := s.m.getVariable(strings.ToLower(expr[len("@@global."):]))
+		return v
+	}
+	if unquoted, err := strconv.Unquote(strings.Replace(expr, "'", "\"", -1)); nil == err {
+		return unquoted
+	}
+	return expr
+}
+
+// heartbeatPeriod returns the heartbeat period set by the slave, 0 if disabled
+func (s *session) heartbeatPeriod() time.Duration {
+	v, err := strconv.ParseInt(s.vars["master_heartbeat_period"], 10, 64)
+	if nil != err {
+		return 0
+	}
+	return time.Duration(v)
+}
+
+func (s *session) writeEvent(data []byte) error {
+	pkt := make([]byte, 5, 5+len(data))
+	pkt[4] = mconn.PacketHeaderOK
+	pkt = append(pkt, data...)
+	return errors.Trace(s.sc.WritePacket(pkt))
+}
+
+// writeArtificialEvent writes the event not stored in binlog files, like the fake rotate event
+func (s *session) writeArtificialEvent(e *Event, logPos uint32) error {
+	e.Flags |= binlog.LogEventArtificialFlag
+	return errors.Trace(s.writeEvent(e.encode(s.m.cfg.ServerID, logPos, s.m.cfg.Checksum)))
+}
+
+// dump streams binlog events from the position, if gset is not nil, transactions in
+// the set are skipped
+func (s *session) dump(name string, pos uint32, flags uint16, gset mconn.GTIDSet) error {
+	s.m.mu.Lock()
+	s.m.dumps++
+	index := -1
+	for i, f := range s.m.files {
+		if f.name == name || "" == name {
+			index = i
+			break
+		}
+	}
+	s.m.mu.Unlock()
+	if index < 0 {
+		return errors.Trace(s.sc.WriteError(mconn.ErrCodeMasterFatal, "HY000",
+			"Could not find first log file name in binary log index file"))
+	}
+	if pos < 4 {
+		pos = 4
+	}
+
+	// The fake rotate event tells the slave the binlog file
+	s.m.mu.Lock()
+	name = s.m.files[index].name
+	data := s.m.files[index].data
+	s.m.mu.Unlock()
+	if err := s.writeArtificialEvent(NewRotateEvent(name, uint64(pos)), 0); nil != err {
+		return errors.Trace(err)
+	}
+	// The format description event is sent first if the dump starts from the middle of the file
+	if pos > 4 {
+		if err := s.writeFormatDescription(data); nil != err {
+			return errors.Trace(err)
+		}
+	}
+
+	skipping := false
+	lastType := uint8(0)
+	for {
+		s.m.mu.Lock()
+		data = s.m.files[index].data
+		hasNext := index+1 < len(s.m.files)
+		notify := s.m.notify
+		s.m.mu.Unlock()
+
+		for int(pos) < len(data) {
+			size := binary.LittleEndian.Uint32(data[pos+9:])
+			ev := data[pos : pos+size]
+			pos += size
+			lastType = ev[4]
+
+			if nil != gset {
+				if binlog.GTIDEventType == lastType {
+					contained, err := s.containGTID(gset, ev)
+					if nil != err {
+						return errors.Trace(err)
+					}
+					skipping = contained
+				}
+				if skipping && binlog.RotateEventType != lastType &&
+					binlog.FormatDescriptionEventType != lastType {
+					continue
+				}
+			}
+			if err := s.writeEvent(ev); nil != err {
+				return errors.Trace(err)
+			}
+		}
+
+		if hasNext {
+			// Switch to the next file
+			s.m.mu.Lock()
+			index++
+			name = s.m.files[index].name
+			s.m.mu.Unlock()
+			if binlog.RotateEventType != lastType {
+				if err := s.writeArtificialEvent(NewRotateEvent(name, 4), 0); nil != err {
+					return errors.Trace(err)
+				}
+			}
+			pos = 4
+			lastType = 0
+			continue
+		}
+
+		if 0 != flags&mconn.BinlogDumpNonBlock {
+			return errors.Trace(s.sc.WriteEOF())
+		}
+
+		// Wait for new events
+		var heartbeat <-chan time.Time
+		if period := s.heartbeatPeriod(); period > 0 {
+			heartbeat = time.After(period)
+		}
+		select {
+		case <-notify:
+			{
+			}
+		case <-heartbeat:
+			{
+				if err := s.writeArtificialEvent(NewHeartbeatEvent(name), pos); nil != err {
+					return errors.Trace(err)
+				}
+			}
+		case <-s.quit:
+			{
+				return io.EOF
+			}
+		}
+	}
+}
+
+// writeFormatDescription sends the format description event of the binlog file, the log
+// position is 0 to tell the slave not to update the position
+func (s *session) writeFormatDescription(data []byte) error {
+	size := binary.LittleEndian.Uint32(data[4+9:])
+	ev := make([]byte, size)
+	copy(ev, data[4:4+size])
+	binary.LittleEndian.PutUint32(ev[13:], 0)
+	if s.m.cfg.Checksum {
+		fillChecksum(ev)
+	}
+	return errors.Trace(s.writeEvent(ev))
+}
+
+func (s *session) containGTID(gset mconn.GTIDSet, ev []byte) (bool, error) {
+	body := ev[eventHeaderLength:]
+	if s.m.cfg.Checksum {
+		body = body[:len(body)-4]
+	}
+	var e binlog.GTIDEvent
+	if err := e.Decode(body); nil != err {
+		return false, errors.Trace(err)
+	}
+	one, err := mconn.ParseMysqlGTIDSet(e.String())
+	if nil != err {
+		return false, errors.Trace(err)
+	}
+	return gset.Contain(one), nil
+}
@@ -0,0 +1,286 @@
+package mconn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// Auth plugins supported by default
+const (
+	CachingSha2PasswordPlugin = "caching_sha2_password"
+	Sha256PasswordPlugin      = "sha256_password"
+)
+
+// Auth packet headers
+const (
+	authMoreDataHeader      = 0x01
+	authSwitchRequestHeader = 0xfe
+)
+
+// caching_sha2_password status sent by AuthMoreData
+const (
+	cachingSha2RequestPublicKey    = 0x02
+	cachingSha2FastAuthSuccess     = 0x03
+	cachingSha2PerformFullAuth     = 0x04
+	sha256PasswordRequestPublicKey = 0x01
+)
+
+// AuthContext holds the information an auth plugin needs to compute the auth data
+type AuthContext struct {
+	Password string
+	// Seed is the scramble sent by server
+	Seed []byte
+	// Secure is true if the password can be sent in clear text, like a tls connection
+	Secure bool
+	// PublicKey is the rsa public key of the server, it is retrieved from the
+	// server if not specified
+	PublicKey *rsa.PublicKey
+}
+
+// AuthPlugin computes the auth data of a client authentication plugin
+type AuthPlugin interface {
+	// Name returns the plugin name used in handshake
+	Name() string
+	// Auth returns the initial auth response
+	Auth(ctx *AuthContext) ([]byte, error)
+	// MoreData handles the AuthMoreData packet payload without the header,
+	// returns nil if nothing need to be sent back
+	MoreData(ctx *AuthContext, data []byte) ([]byte, error)
+}
+
+var (
+	authPluginsMu sync.RWMutex
+	authPlugins   = make(map[string]AuthPlugin)
+)
+
+// RegisterAuthPlugin registers the auth plugin, the plugin with the same name will be replaced
+func RegisterAuthPlugin(p AuthPlugin) {
+	authPluginsMu.Lock()
+	authPlugins[p.Name()] = p
+	authPluginsMu.Unlock()
+}
+
+// GetAuthPlugin returns the auth plugin by name
+func GetAuthPlugin(name string) (AuthPlugin, bool) {
+	authPluginsMu.RLock()
+	p, ok := authPlugins[name]
+	authPluginsMu.RUnlock()
+	return p, ok
+}
+
+func init() {
+	RegisterAuthPlugin(nativePasswordPlugin{})
+	RegisterAuthPlugin(cachingSha2PasswordPlugin{})
+	RegisterAuthPlugin(sha256PasswordPlugin{})
+}
+
+// ParsePublicKey parses the PEM encoded rsa public key
+func ParsePublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if nil == block {
+		return nil, errors.New("invalid PEM public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if nil != err {
+		// Try PKCS1 format
+		pk, perr := x509.ParsePKCS1PublicKey(block.Bytes)
+		if nil != perr {
+			return nil, errors.Trace(err)
+		}
+		return pk, nil
+	}
+	pk, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.Errorf("public key type %T is not rsa", pub)
+	}
+	return pk, nil
+}
+
+// LoadPublicKey loads the PEM encoded rsa public key from file
+func LoadPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	pk, err := ParsePublicKey(data)
+	if nil != err {
+		return nil, errors.Annotatef(err, "load public key %s", path)
+	}
+	return pk, nil
+}
+
+// mysql_native_password: SHA1(password) XOR SHA1(seed + SHA1(SHA1(password)))
+func scrambleNativePassword(seed []byte, password string) []byte {
+	if "" == password {
+		return nil
+	}
+
+	s1 := sha1.New()
+	s1.Write([]byte(password))
+	s1hash := s1.Sum(nil)
+
+	s1.Reset()
+	s1.Write(s1hash)
+	shash := s1.Sum(nil)
+
+	s1.Reset()
+	s1.Write(seed)
+	s1.Write(shash)
+	phash := s1.Sum(nil)
+
+	for i := range phash {
+		phash[i] ^= s1hash[i]
+	}
+	return phash
+}
+
+// caching_sha2_password: SHA256(password) XOR SHA256(SHA256(SHA256(password)) + seed)
+func scrambleSha256Password(seed []byte, password string) []byte {
+	if "" == password {
+		return nil
+	}
+
+	s256 := sha256.New()
+	s256.Write([]byte(password))
+	m1 := s256.Sum(nil)
+
+	s256.Reset()
+	s256.Write(m1)
+	m2 := s256.Sum(nil)
+
+	s256.Reset()
+	s256.Write(m2)
+	s256.Write(seed)
+	m3 := s256.Sum(nil)
+
+	for i := range m1 {
+		m1[i] ^= m3[i]
+	}
+	return m1
+}
+
+// encryptPassword encrypts the null terminated password xor seed with the rsa public key
+func encryptPassword(ctx *AuthContext) ([]byte, error) {
+	plain := make([]byte, len(ctx.Password)+1)
+	copy(plain, ctx.Password)
+	if len(ctx.Seed) != 0 {
+		for i := range plain {
+			plain[i] ^= ctx.Seed[i%len(ctx.Seed)]
+		}
+	}
+	data, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, ctx.PublicKey, plain, nil)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	return data, nil
+}
+
+func clearPassword(password string) []byte {
+	return append([]byte(password), 0)
+}
+
+// isPublicKeyData returns true if the AuthMoreData is a PEM public key
+func isPublicKeyData(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("-----BEGIN"))
+}
+
+func encryptWithPublicKeyData(ctx *AuthContext, data []byte) ([]byte, error) {
+	pk, err := ParsePublicKey(data)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	ctx.PublicKey = pk
+	return encryptPassword(ctx)
+}
+
+type nativePasswordPlugin struct{}
+
+func (nativePasswordPlugin) Name() string {
+	return MySQLNativePasswordPlugin
+}
+
+func (nativePasswordPlugin) Auth(ctx *AuthContext) ([]byte, error) {
+	return scrambleNativePassword(ctx.Seed, ctx.Password), nil
+}
+
+func (nativePasswordPlugin) MoreData(ctx *AuthContext, data []byte) ([]byte, error) {
+	return nil, errors.Errorf("unexpected auth more data for %s", MySQLNativePasswordPlugin)
+}
+
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_caching_sha2_authentication_exchanges.html
+type cachingSha2PasswordPlugin struct{}
+
+func (cachingSha2PasswordPlugin) Name() string {
+	return CachingSha2PasswordPlugin
+}
+
+func (cachingSha2PasswordPlugin) Auth(ctx *AuthContext) ([]byte, error) {
+	return scrambleSha256Password(ctx.Seed, ctx.Password), nil
+}
+
+func (cachingSha2PasswordPlugin) MoreData(ctx *AuthContext, data []byte) ([]byte, error) {
+	if isPublicKeyData(data) {
+		return encryptWithPublicKeyData(ctx, data)
+	}
+	if len(data) != 1 {
+		return nil, ErrMalformPacket
+	}
+
+	switch data[0] {
+	case cachingSha2FastAuthSuccess:
+		{
+			// Wait for the OK packet
+			return nil, nil
+		}
+	case cachingSha2PerformFullAuth:
+		{
+			if ctx.Secure {
+				return clearPassword(ctx.Password), nil
+			}
+			if nil == ctx.PublicKey {
+				return []byte{cachingSha2RequestPublicKey}, nil
+			}
+			return encryptPassword(ctx)
+		}
+	default:
+		{
+			return nil, errors.Errorf("unknown caching_sha2_password status %v", data[0])
+		}
+	}
+}
+
+// https://dev.mysql.com/doc/internals/en/sha256.html
+type sha256PasswordPlugin struct{}
+
+func (sha256PasswordPlugin) Name() string {
+	return Sha256PasswordPlugin
+}
+
+func (sha256PasswordPlugin) Auth(ctx *AuthContext) ([]byte, error) {
+	if "" == ctx.Password {
+		return []byte{0}, nil
+	}
+	if ctx.Secure {
+		return clearPassword(ctx.Password), nil
+	}
+	if nil == ctx.PublicKey {
+		return []byte{sha256PasswordRequestPublicKey}, nil
+	}
+	return encryptPassword(ctx)
+}
+
+func (sha256PasswordPlugin) MoreData(ctx *AuthContext, data []byte) ([]byte, error) {
+	if !isPublicKeyData(data) {
+		return nil, ErrMalformPacket
+	}
+	return encryptWithPublicKeyData(ctx, data)
+}
@@ -0,0 +1,320 @@
+package mconn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+)
+
+var testSeed = []byte("0123456789abcdefghij")
+
+// scriptedServer accepts a connection and runs the script as a mysql server
+type scriptedServer struct {
+	t    *testing.T
+	ln   net.Listener
+	conn net.Conn
+	seq  uint8
+	done chan error
+}
+
+func newScriptedServer(t *testing.T, script func(s *scriptedServer) error) *scriptedServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	s := &scriptedServer{t: t, ln: ln, done: make(chan error, 1)}
+	go func() {
+		conn, err := ln.Accept()
+		if nil != err {
+			s.done <- err
+			return
+		}
+		defer conn.Close()
+		s.conn = conn
+		s.done <- script(s)
+	}()
+	return s
+}
+
+func (s *scriptedServer) dataSource(password string) *DataSource {
+	addr := s.ln.Addr().(*net.TCPAddr)
+	return &DataSource{
+		Host:     addr.IP.String(),
+		Port:     uint16(addr.Port),
+		Username: "root",
+		Password: password,
+	}
+}
+
+func (s *scriptedServer) wait() error {
+	err := <-s.done
+	s.ln.Close()
+	return err
+}
+
+func (s *scriptedServer) writePacket(payload []byte) error {
+	header := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), s.seq}
+	s.seq++
+	_, err := s.conn.Write(append(header, payload...))
+	return err
+}
+
+func (s *scriptedServer) readPacket() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(s.conn, header[:]); nil != err {
+		return nil, err
+	}
+	s.seq = header[3] + 1
+	payload := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+	if _, err := io.ReadFull(s.conn, payload); nil != err {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func (s *scriptedServer) writeHandshake(plugin string) error {
+	var buf bytes.Buffer
+	capability := uint32(clientProtocol41 | clientSecureConnection | clientLongPassword |
+		clientTransactions | clientLongFlag | clientPluginAuth | clientConnectWithDB | clientSSL)
+	buf.WriteByte(10)
+	buf.WriteString("8.0.21\x00")
+	binary.Write(&buf, binary.LittleEndian, uint32(1))
+	buf.Write(testSeed[:8])
+	buf.WriteByte(0)
+	binary.Write(&buf, binary.LittleEndian, uint16(capability))
+	buf.WriteByte(CharsetUtf8GeneralCI)
+	binary.Write(&buf, binary.LittleEndian, uint16(2))
+	binary.Write(&buf, binary.LittleEndian, uint16(capability>>16))
+	buf.WriteByte(byte(len(testSeed) + 1))
+	buf.Write(make([]byte, 10))
+	buf.Write(testSeed[8:])
+	buf.WriteByte(0)
+	buf.WriteString(plugin + "\x00")
+	return s.writePacket(buf.Bytes())
+}
+
+// readHandshakeResponse returns the plugin name and auth response
+func (s *scriptedServer) readHandshakeResponse() (string, []byte, error) {
+	data, err := s.readPacket()
+	if nil != err {
+		return "", nil, err
+	}
+	// capability + max packet size + charset + reserved
+	data = data[4+4+1+23:]
+	user := data[:bytes.IndexByte(data, 0)]
+	if string(user) != "root" {
+		return "", nil, fmt.Errorf("unexpected user %s", user)
+	}
+	data = data[len(user)+1:]
+	authLen := int(data[0])
+	auth := data[1 : 1+authLen]
+	data = data[1+authLen:]
+	plugin := data[:bytes.IndexByte(data, 0)]
+	return string(plugin), auth, nil
+}
+
+func (s *scriptedServer) writeOK() error {
+	return s.writePacket([]byte{PacketHeaderOK, 0, 0, 2, 0, 0, 0})
+}
+
+func (s *scriptedServer) writeErr(msg string) error {
+	payload := []byte{PacketHeaderERR, 0x15, 0x04, '#', '2', '8', '0', '0', '0'}
+	return s.writePacket(append(payload, msg...))
+}
+
+func (s *scriptedServer) expect(expect []byte) error {
+	data, err := s.readPacket()
+	if nil != err {
+		return err
+	}
+	if !bytes.Equal(data, expect) {
+		return fmt.Errorf("expect packet %v, but got %v", expect, data)
+	}
+	return nil
+}
+
+func (s *scriptedServer) sendPublicKeyAndCheck(key *rsa.PrivateKey, password string) error {
+	pubData, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if nil != err {
+		return err
+	}
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubData})
+	if err = s.writePacket(append([]byte{authMoreDataHeader}, pemData...)); nil != err {
+		return err
+	}
+	data, err := s.readPacket()
+	if nil != err {
+		return err
+	}
+	plain, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, key, data, nil)
+	if nil != err {
+		return err
+	}
+	for i := range plain {
+		plain[i] ^= testSeed[i%len(testSeed)]
+	}
+	if string(plain) != password+"\x00" {
+		return fmt.Errorf("unexpected decrypted password %q", plain)
+	}
+	return s.writeOK()
+}
+
+func testConnect(t *testing.T, password string, script func(s *scriptedServer) error) error {
+	return testConnectWithSSL(t, password, SSLOptions{}, script)
+}
+
+func testConnectWithSSL(t *testing.T, password string, ssl SSLOptions, script func(s *scriptedServer) error) error {
+	s := newScriptedServer(t, script)
+	var c Conn
+	ds := s.dataSource(password)
+	ds.SSLOptions = ssl
+	err := c.Connect(ds, "")
+	c.Close()
+	if serr := s.wait(); nil != serr {
+		t.Fatalf("server error: %v", serr)
+	}
+	return err
+}
+
+func TestAuthNativePassword(t *testing.T) {
+	err := testConnect(t, "secret", func(s *scriptedServer) error {
+		if err := s.writeHandshake(MySQLNativePasswordPlugin); nil != err {
+			return err
+		}
+		plugin, auth, err := s.readHandshakeResponse()
+		if nil != err {
+			return err
+		}
+		if plugin != MySQLNativePasswordPlugin ||
+			!bytes.Equal(auth, scrambleNativePassword(testSeed, "secret")) {
+			return fmt.Errorf("unexpected auth response %s %v", plugin, auth)
+		}
+		return s.writeOK()
+	})
+	if nil != err {
+		t.Error(err)
+	}
+}
+
+func TestAuthCachingSha2FastAuth(t *testing.T) {
+	err := testConnect(t, "secret", func(s *scriptedServer) error {
+		if err := s.writeHandshake(CachingSha2PasswordPlugin); nil != err {
+			return err
+		}
+		plugin, auth, err := s.readHandshakeResponse()
+		if nil != err {
+			return err
+		}
+		if plugin != CachingSha2PasswordPlugin ||
+			!bytes.Equal(auth, scrambleSha256Password(testSeed, "secret")) {
+			return fmt.Errorf("unexpected auth response %s %v", plugin, auth)
+		}
+		if err = s.writePacket([]byte{authMoreDataHeader, cachingSha2FastAuthSuccess}); nil != err {
+			return err
+		}
+		return s.writeOK()
+	})
+	if nil != err {
+		t.Error(err)
+	}
+}
+
+func TestAuthCachingSha2FullAuth(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if nil != err {
+		t.Fatal(err)
+	}
+	err = testConnect(t, "secret", func(s *scriptedServer) error {
+		if err := s.writeHandshake(CachingSha2PasswordPlugin); nil != err {
+			return err
+		}
+		if _, _, err := s.readHandshakeResponse(); nil != err {
+			return err
+		}
+		if err := s.writePacket([]byte{authMoreDataHeader, cachingSha2PerformFullAuth}); nil != err {
+			return err
+		}
+		// Client requests the public key
+		if err := s.expect([]byte{cachingSha2RequestPublicKey}); nil != err {
+			return err
+		}
+		return s.sendPublicKeyAndCheck(key, "secret")
+	})
+	if nil != err {
+		t.Error(err)
+	}
+}
+
+func TestAuthSha256Password(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if nil != err {
+		t.Fatal(err)
+	}
+	err = testConnect(t, "secret", func(s *scriptedServer) error {
+		if err := s.writeHandshake(Sha256PasswordPlugin); nil != err {
+			return err
+		}
+		plugin, auth, err := s.readHandshakeResponse()
+		if nil != err {
+			return err
+		}
+		// Client requests the public key
+		if plugin != Sha256PasswordPlugin ||
+			!bytes.Equal(auth, []byte{sha256PasswordRequestPublicKey}) {
+			return fmt.Errorf("unexpected auth response %s %v", plugin, auth)
+		}
+		return s.sendPublicKeyAndCheck(key, "secret")
+	})
+	if nil != err {
+		t.Error(err)
+	}
+}
+
+func TestAuthSwitch(t *testing.T) {
+	newSeed := []byte("jihgfedcba9876543210")
+	err := testConnect(t, "secret", func(s *scriptedServer) error {
+		if err := s.writeHandshake(CachingSha2PasswordPlugin); nil != err {
+			return err
+		}
+		if _, _, err := s.readHandshakeResponse(); nil != err {
+			return err
+		}
+		req := []byte{authSwitchRequestHeader}
+		req = append(req, MySQLNativePasswordPlugin+"\x00"...)
+		req = append(req, newSeed...)
+		req = append(req, 0)
+		if err := s.writePacket(req); nil != err {
+			return err
+		}
+		if err := s.expect(scrambleNativePassword(newSeed, "secret")); nil != err {
+			return err
+		}
+		return s.writeOK()
+	})
+	if nil != err {
+		t.Error(err)
+	}
+}
+
+func TestAuthDenied(t *testing.T) {
+	err := testConnect(t, "wrong", func(s *scriptedServer) error {
+		if err := s.writeHandshake(MySQLNativePasswordPlugin); nil != err {
+			return err
+		}
+		if _, _, err := s.readHandshakeResponse(); nil != err {
+			return err
+		}
+		return s.writeErr("Access denied for user 'root'")
+	})
+	if nil == err {
+		t.Error("connect should fail with access denied")
+	}
+}
@@ -7,7 +7,23 @@ func (c *Conn) Exec(command string, args ...interface{}) (*PacketOK, error) {
 	if len(args) == 0 {
 		return c.execCommandStr(command)
 	}
-	return nil, nil
+	return c.execStmt(command, args...)
+}
+
+// execStmt prepares the command and executes it with args, the statement is
+// closed with the result set if rows returned
+func (c *Conn) execStmt(command string, args ...interface{}) (*PacketOK, error) {
+	stmt, err := c.Prepare(command)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	pok, err := stmt.Exec(args...)
+	if nil != err || nil == pok || nil == pok.Results {
+		stmt.Close()
+		return pok, errors.Trace(err)
+	}
+	pok.Results.stmt = stmt
+	return pok, nil
 }
 
 func (c *Conn) sendCommandStr(str string) error {
@@ -0,0 +1,234 @@
+package mconn
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+
+	"github.com/juju/errors"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms of the protocol
+const (
+	CompressionNone = ""
+	CompressionZlib = "zlib"
+	CompressionZstd = "zstd"
+)
+
+const (
+	compressedHeaderSize = 7
+	// Payload less than minCompressLength is sent without compression
+	minCompressLength        = 50
+	defaultZstdCompressLevel = 3
+)
+
+// compressor reads and writes the compressed packets, every compressed packet contains
+// one or more normal packets
+// https://dev.mysql.com/doc/internals/en/compressed-packet-header.html
+type compressor struct {
+	alg   string
+	level int
+	r     io.Reader
+	w     io.Writer
+	// seq is the sequence of compressed packets, it is reset with the packet sequence
+	seq uint8
+	// buf holds the decompressed data not read
+	buf  []byte
+	zdec *zstd.Decoder
+	zenc *zstd.Encoder
+}
+
+func newCompressor(alg string, level int, r io.Reader, w io.Writer) (*compressor, error) {
+	p := &compressor{
+		alg:   alg,
+		level: level,
+		r:     r,
+		w:     w,
+	}
+
+	switch alg {
+	case CompressionZlib:
+		{
+			if 0 == p.level {
+				p.level = zlib.DefaultCompression
+			}
+		}
+	case CompressionZstd:
+		{
+			if 0 == p.level {
+				p.level = defaultZstdCompressLevel
+			}
+			var err error
+			if p.zdec, err = zstd.NewReader(nil); nil != err {
+				return nil, errors.Trace(err)
+			}
+			p.zenc, err = zstd.NewWriter(nil,
+				zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(p.level)))
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+		}
+	default:
+		{
+			return nil, errors.Errorf("unknown compression %s", alg)
+		}
+	}
+
+	return p, nil
+}
+
+func (p *compressor) close() {
+	if nil != p.zdec {
+		p.zdec.Close()
+	}
+	if nil != p.zenc {
+		p.zenc.Close()
+	}
+}
+
+func (p *compressor) resetSequence() {
+	p.seq = 0
+}
+
+// Read implements io.Reader, returns the decompressed stream
+func (p *compressor) Read(b []byte) (int, error) {
+	for 0 == len(p.buf) {
+		if err := p.readPacket(); nil != err {
+			return 0, err
+		}
+	}
+	n := copy(b, p.buf)
+	p.buf = p.buf[n:]
+	return n, nil
+}
+
+func (p *compressor) readPacket() error {
+	var header [compressedHeaderSize]byte
+	if _, err := io.ReadFull(p.r, header[:]); nil != err {
+		return errors.Annotatef(err, badConnErrDesc)
+	}
+	clen := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+	p.seq = header[3] + 1
+	ulen := int(uint32(header[4]) | uint32(header[5])<<8 | uint32(header[6])<<16)
+
+	data := make([]byte, clen)
+	if _, err := io.ReadFull(p.r, data); nil != err {
+		return errors.Annotatef(err, badConnErrDesc)
+	}
+	// Uncompressed length 0 means the payload is not compressed
+	if 0 == ulen {
+		p.buf = data
+		return nil
+	}
+
+	var err error
+	if p.buf, err = p.decompress(data, ulen); nil != err {
+		return errors.Trace(err)
+	}
+	if len(p.buf) != ulen {
+		return errors.Errorf("decompressed length %d, want %d", len(p.buf), ulen)
+	}
+	return nil
+}
+
+func (p *compressor) decompress(data []byte, ulen int) ([]byte, error) {
+	switch p.alg {
+	case CompressionZlib:
+		{
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			defer zr.Close()
+			buf := make([]byte, ulen)
+			if _, err = io.ReadFull(zr, buf); nil != err {
+				return nil, errors.Trace(err)
+			}
+			return buf, nil
+		}
+	case CompressionZstd:
+		{
+			buf, err := p.zdec.DecodeAll(data, make([]byte, 0, ulen))
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			return buf, nil
+		}
+	}
+	return nil, errors.Errorf("unknown compression %s", p.alg)
+}
+
+func (p *compressor) compress(data []byte) ([]byte, error) {
+	switch p.alg {
+	case CompressionZlib:
+		{
+			var buf bytes.Buffer
+			zw, err := zlib.NewWriterLevel(&buf, p.level)
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			if _, err = zw.Write(data); nil != err {
+				return nil, errors.Trace(err)
+			}
+			if err = zw.Close(); nil != err {
+				return nil, errors.Trace(err)
+			}
+			return buf.Bytes(), nil
+		}
+	case CompressionZstd:
+		{
+			return p.zenc.EncodeAll(data, nil), nil
+		}
+	}
+	return nil, errors.Errorf("unknown compression %s", p.alg)
+}
+
+// Write implements io.Writer, the data is sent as compressed packets
+func (p *compressor) Write(data []byte) (int, error) {
+	n := len(data)
+	for len(data) > 0 {
+		sz := len(data)
+		if sz > maxPayloadLength {
+			sz = maxPayloadLength
+		}
+		if err := p.writePacket(data[:sz], p.seq); nil != err {
+			return 0, errors.Trace(err)
+		}
+		p.seq++
+		data = data[sz:]
+	}
+	return n, nil
+}
+
+// writePacket writes the data as one compressed packet with the sequence
+func (p *compressor) writePacket(data []byte, seq uint8) error {
+	payload := data
+	ulen := 0
+	if len(data) >= minCompressLength {
+		cdata, err := p.compress(data)
+		if nil != err {
+			return errors.Trace(err)
+		}
+		// Send the raw data if it can't be compressed
+		if len(cdata) < len(data) {
+			payload = cdata
+			ulen = len(data)
+		}
+	}
+
+	pkt := make([]byte, compressedHeaderSize+len(payload))
+	clen := len(payload)
+	pkt[0] = byte(clen)
+	pkt[1] = byte(clen >> 8)
+	pkt[2] = byte(clen >> 16)
+	pkt[3] = seq
+	pkt[4] = byte(ulen)
+	pkt[5] = byte(ulen >> 8)
+	pkt[6] = byte(ulen >> 16)
+	copy(pkt[compressedHeaderSize:], payload)
+	if _, err := p.w.Write(pkt); nil != err {
+		return errors.Annotate(err, badConnErrDesc)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package mconn
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressor(t *testing.T) {
+	large := bytes.Repeat([]byte("binlog event payload "), 1024)
+	for _, alg := range []string{CompressionZlib, CompressionZstd} {
+		var buf bytes.Buffer
+		w, err := newCompressor(alg, 0, nil, &buf)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte("short")); nil != err {
+			t.Fatal(err)
+		}
+		if _, err = w.Write(large); nil != err {
+			t.Fatal(err)
+		}
+		w.close()
+		if buf.Len() >= len(large) {
+			t.Errorf("%s: data is not compressed, size %d", alg, buf.Len())
+		}
+
+		r, err := newCompressor(alg, 0, &buf, nil)
+		if nil != err {
+			t.Fatal(err)
+		}
+		data := make([]byte, len("short")+len(large))
+		for n := 0; n < len(data); {
+			rn, err := r.Read(data[n:])
+			if nil != err {
+				t.Fatal(err)
+			}
+			n += rn
+		}
+		r.close()
+		if string(data[:5]) != "short" || !bytes.Equal(data[5:], large) {
+			t.Errorf("%s: decompressed data mismatch", alg)
+		}
+		if r.seq != 2 {
+			t.Errorf("%s: compressed sequence should be 2, but got %d", alg, r.seq)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
@@ -45,6 +46,14 @@ func (i *HandshakeInfo) String() string {
 		i.ProtoVersion, i.ServerVersion, i.ConnectionID)
 }
 
+// Flavor returns the gtid flavor of the server
+func (i *HandshakeInfo) Flavor() string {
+	if strings.Contains(strings.ToUpper(i.ServerVersion), "MARIADB") {
+		return MariaDBFlavor
+	}
+	return MySQLFlavor
+}
+
 // Conn is a connection communicate with the mysql server
 type Conn struct {
 	ds          *DataSource
@@ -59,8 +68,11 @@ type Conn struct {
 	si          HandshakeInfo
 	rc          *ReplicationConfig
 	readTimeout time.Duration
-	// TODO: support tls
-	tlsConfig *tls.Config
+	tlsConfig   *tls.Config
+	// comp is the compressed packet reader and writer if compression is enabled
+	comp *compressor
+	// wmu serializes the packets written out of the request-response flow, like semi-sync acks
+	wmu sync.Mutex
 }
 
 // GetStatus returns the status of the connection
@@ -104,6 +116,10 @@ func (c *Conn) close() {
 		c.conn != nil {
 		c.conn.Close()
 		c.status = connStatusClosed
+		if nil != c.comp {
+			c.comp.close()
+			c.comp = nil
+		}
 	}
 }
 
@@ -116,8 +132,15 @@ func (c *Conn) Connect(ds *DataSource, database string) error {
 		return errors.New("already connected")
 	}
 
+	tlsConfig, err := ds.TLSConfig(ds.Host)
+	if nil != err {
+		c.mu.Unlock()
+		return errors.Trace(err)
+	}
+	c.tlsConfig = tlsConfig
+
 	// Create connection
-	conn, err := net.DialTimeout("tcp", ds.Address(), time.Second*10)
+	conn, err := ds.Dial(ds.Address())
 	if nil != err {
 		c.mu.Unlock()
 		return errors.Trace(err)
@@ -166,7 +189,7 @@ func (c *Conn) WritePacket(data []byte) error {
 		header.SetSequence(c.seq)
 		copy(data[:], header.ToSlice())
 
-		if n, err := c.conn.Write(data[:maxPayloadLength+4]); nil != err {
+		if n, err := c.writeRaw(data[:maxPayloadLength+4]); nil != err {
 			return errors.Annotate(err, badConnErrDesc)
 		} else if n != maxPayloadLength+4 {
 			return errors.Errorf("%s%s", badConnErrDesc, "send bytes not equal")
@@ -181,7 +204,7 @@ func (c *Conn) WritePacket(data []byte) error {
 	header.SetLength(dl)
 	header.SetSequence(c.seq)
 	copy(data[:], header.ToSlice())
-	if n, err := c.conn.Write(data[:]); nil != err {
+	if n, err := c.writeRaw(data[:]); nil != err {
 		return errors.Annotate(err, badConnErrDesc)
 	} else if n != dl+4 {
 		return errors.Errorf("%s%s", badConnErrDesc, "send bytes not equal")
@@ -192,6 +215,13 @@ func (c *Conn) WritePacket(data []byte) error {
 	return nil
 }
 
+func (c *Conn) writeRaw(data []byte) (int, error) {
+	if nil != c.comp {
+		return c.comp.Write(data)
+	}
+	return c.conn.Write(data)
+}
+
 // ReadPacket reads the full packet from mysql
 func (c *Conn) ReadPacket() ([]byte, error) {
 	var buf bytes.Buffer
@@ -242,4 +272,7 @@ func (c *Conn) readFullPacket(w io.Writer) error {
 
 func (c *Conn) resetSequence() {
 	c.seq = 0
+	if nil != c.comp {
+		c.comp.resetSequence()
+	}
 }
@@ -0,0 +1,75 @@
+package mconn
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const (
+	defaultConnectTimeout = 10
+)
+
+// DialFunc establishes the network connection to the mysql server, network is tcp or unix
+type DialFunc func(network, addr string, timeout time.Duration) (net.Conn, error)
+
+var (
+	dialersMu sync.RWMutex
+	dialers   = make(map[string]DialFunc)
+)
+
+// RegisterDialer registers a named dial function, data sources use it by the dialer option.
+// It is used to connect through tunnels like SOCKS or SSH, or to connect to test doubles
+func RegisterDialer(name string, fn DialFunc) {
+	dialersMu.Lock()
+	dialers[name] = fn
+	dialersMu.Unlock()
+}
+
+// GetDialer returns the registered dial function, returns nil if not found
+func GetDialer(name string) DialFunc {
+	dialersMu.RLock()
+	fn := dialers[name]
+	dialersMu.RUnlock()
+	return fn
+}
+
+// DialOptions is the network options of a mysql connection
+type DialOptions struct {
+	// Socket is the unix socket path, host and port are ignored if specified
+	Socket string `json:"socket" toml:"socket"`
+	// ConnectTimeout is the connect timeout in seconds, 10 seconds by default
+	ConnectTimeout int `json:"connect-timeout" toml:"connect-timeout"`
+	// Dialer is the name of the dial function registered by RegisterDialer
+	Dialer string `json:"dialer" toml:"dialer"`
+}
+
+// Network returns the network type, unix if the socket is specified
+func (o *DialOptions) Network() string {
+	if "" != o.Socket {
+		return "unix"
+	}
+	return "tcp"
+}
+
+// Timeout returns the connect timeout
+func (o *DialOptions) Timeout() time.Duration {
+	if o.ConnectTimeout <= 0 {
+		return defaultConnectTimeout * time.Second
+	}
+	return time.Duration(o.ConnectTimeout) * time.Second
+}
+
+// Dial connects to the address with the dial options
+func (o *DialOptions) Dial(addr string) (net.Conn, error) {
+	if "" != o.Dialer {
+		fn := GetDialer(o.Dialer)
+		if nil == fn {
+			return nil, errors.Errorf("dialer %s not registered", o.Dialer)
+		}
+		return fn(o.Network(), addr, o.Timeout())
+	}
+	return net.DialTimeout(o.Network(), addr, o.Timeout())
+}
@@ -0,0 +1,46 @@
+package mconn
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRegisteredDialer(t *testing.T) {
+	s := newScriptedServer(t, func(s *scriptedServer) error {
+		if err := s.writeHandshake(MySQLNativePasswordPlugin); nil != err {
+			return err
+		}
+		if _, _, err := s.readHandshakeResponse(); nil != err {
+			return err
+		}
+		return s.writeOK()
+	})
+
+	var dialed string
+	RegisterDialer("test", func(network, addr string, timeout time.Duration) (net.Conn, error) {
+		dialed = network + "://" + addr
+		return net.DialTimeout("tcp", s.ln.Addr().String(), timeout)
+	})
+	ds := s.dataSource("secret")
+	ds.Socket = "/tmp/mysql.sock"
+	ds.Dialer = "test"
+
+	var c Conn
+	err := c.Connect(ds, "")
+	c.Close()
+	if serr := s.wait(); nil != serr {
+		t.Fatalf("server error: %v", serr)
+	}
+	if nil != err {
+		t.Fatal(err)
+	}
+	if dialed != "unix:///tmp/mysql.sock" {
+		t.Errorf("unexpected dialed address %s", dialed)
+	}
+
+	ds.Dialer = "unknown"
+	if err = c.Connect(ds, ""); nil == err {
+		t.Error("connect with unknown dialer should fail")
+	}
+}
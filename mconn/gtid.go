@@ -0,0 +1,378 @@
+package mconn
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+	uuid "github.com/satori/go.uuid"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+// Flavors of the gtid set
+const (
+	MySQLFlavor   = "mysql"
+	MariaDBFlavor = "mariadb"
+)
+
+// ParseGTIDSet parses the text format of the gtid set by flavor
+func ParseGTIDSet(flavor string, str string) (GTIDSet, error) {
+	switch flavor {
+	case MySQLFlavor:
+		{
+			return ParseMysqlGTIDSet(str)
+		}
+	case MariaDBFlavor:
+		{
+			return ParseMariadbGTIDSet(str)
+		}
+	default:
+		{
+			return nil, errors.Errorf("unknown gtid flavor %s", flavor)
+		}
+	}
+}
+
+// GTIDSet is a set of executed transactions, slave can resume the replication from it
+type GTIDSet interface {
+	// String returns the text format of the set, it can be parsed again
+	String() string
+	// Encode returns the binary format of the set used by the dump command
+	Encode() []byte
+	// Update adds a single gtid into the set
+	Update(string) error
+	// Merge adds all gtids of another set into the set
+	Merge(GTIDSet) error
+	// Contain returns true if all gtids of another set are in the set
+	Contain(GTIDSet) bool
+	// Clone returns a deep copy of the set
+	Clone() GTIDSet
+}
+
+// Interval is a gno range [Start, Stop)
+type Interval struct {
+	Start int64
+	Stop  int64
+}
+
+func (i Interval) String() string {
+	if i.Stop == i.Start+1 {
+		return strconv.FormatInt(i.Start, 10)
+	}
+	return fmt.Sprintf("%d-%d", i.Start, i.Stop-1)
+}
+
+func parseInterval(str string) (Interval, error) {
+	var err error
+	var i Interval
+
+	parts := strings.Split(str, "-")
+	switch len(parts) {
+	case 1:
+		{
+			i.Start, err = strconv.ParseInt(parts[0], 10, 64)
+			if nil != err {
+				return i, errors.Trace(err)
+			}
+			i.Stop = i.Start + 1
+		}
+	case 2:
+		{
+			i.Start, err = strconv.ParseInt(parts[0], 10, 64)
+			if nil != err {
+				return i, errors.Trace(err)
+			}
+			i.Stop, err = strconv.ParseInt(parts[1], 10, 64)
+			if nil != err {
+				return i, errors.Trace(err)
+			}
+			i.Stop++
+		}
+	default:
+		{
+			return i, errors.Errorf("invalid interval format %s", str)
+		}
+	}
+
+	if i.Start < 1 || i.Stop <= i.Start {
+		return i, errors.Errorf("invalid interval %s", str)
+	}
+	return i, nil
+}
+
+// normalizeIntervals sorts the intervals and merges the overlapped ones
+func normalizeIntervals(its []Interval) []Interval {
+	if len(its) < 2 {
+		return its
+	}
+	sort.Slice(its, func(i, j int) bool {
+		if its[i].Start == its[j].Start {
+			return its[i].Stop < its[j].Stop
+		}
+		return its[i].Start < its[j].Start
+	})
+
+	merged := make([]Interval, 0, len(its))
+	merged = append(merged, its[0])
+	for _, v := range its[1:] {
+		last := &merged[len(merged)-1]
+		if v.Start <= last.Stop {
+			if v.Stop > last.Stop {
+				last.Stop = v.Stop
+			}
+			continue
+		}
+		merged = append(merged, v)
+	}
+	return merged
+}
+
+// UUIDSet holds all executed gno intervals of a server uuid
+type UUIDSet struct {
+	SID       uuid.UUID
+	Intervals []Interval
+}
+
+// ParseUUIDSet parses the text like 3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5:7
+func ParseUUIDSet(str string) (*UUIDSet, error) {
+	parts := strings.Split(strings.TrimSpace(str), ":")
+	if len(parts) < 2 {
+		return nil, errors.Errorf("invalid uuid set format %s", str)
+	}
+
+	var err error
+	s := &UUIDSet{}
+	s.SID, err = uuid.FromString(parts[0])
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	s.Intervals = make([]Interval, 0, len(parts)-1)
+	for _, v := range parts[1:] {
+		i, err := parseInterval(v)
+		if nil != err {
+			return nil, errors.Trace(err)
+		}
+		s.Intervals = append(s.Intervals, i)
+	}
+	s.Intervals = normalizeIntervals(s.Intervals)
+
+	return s, nil
+}
+
+// AddInterval adds the gno range into the set
+func (s *UUIDSet) AddInterval(its ...Interval) {
+	s.Intervals = normalizeIntervals(append(s.Intervals, its...))
+}
+
+// Contain returns true if all intervals of o are in the set
+func (s *UUIDSet) Contain(o *UUIDSet) bool {
+	if !bytes.Equal(s.SID.Bytes(), o.SID.Bytes()) {
+		return false
+	}
+	for _, oi := range o.Intervals {
+		found := false
+		for _, i := range s.Intervals {
+			if oi.Start >= i.Start && oi.Stop <= i.Stop {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *UUIDSet) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(s.SID.String())
+	for _, i := range s.Intervals {
+		buf.WriteString(":")
+		buf.WriteString(i.String())
+	}
+	return buf.String()
+}
+
+// MysqlGTIDSet is the gtid set of mysql, it is a server uuid to gno intervals map
+type MysqlGTIDSet struct {
+	Sets map[string]*UUIDSet
+}
+
+// NewMysqlGTIDSet creates an empty mysql gtid set
+func NewMysqlGTIDSet() *MysqlGTIDSet {
+	return &MysqlGTIDSet{Sets: make(map[string]*UUIDSet)}
+}
+
+// ParseMysqlGTIDSet parses the text format of mysql gtid set, the same as @@gtid_executed
+func ParseMysqlGTIDSet(str string) (*MysqlGTIDSet, error) {
+	s := NewMysqlGTIDSet()
+	str = strings.TrimSpace(str)
+	if "" == str {
+		return s, nil
+	}
+
+	for _, v := range strings.Split(str, ",") {
+		v = strings.TrimSpace(v)
+		if "" == v {
+			continue
+		}
+		us, err := ParseUUIDSet(v)
+		if nil != err {
+			return nil, errors.Trace(err)
+		}
+		s.addUUIDSet(us)
+	}
+	return s, nil
+}
+
+// DecodeMysqlGTIDSet decodes the binary format of mysql gtid set
+func DecodeMysqlGTIDSet(data []byte) (*MysqlGTIDSet, error) {
+	r := serialize.NewBinReader(data)
+	n, err := r.ReadUint64()
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+
+	s := NewMysqlGTIDSet()
+	for i := uint64(0); i < n; i++ {
+		sid, err := r.ReadBytes(16)
+		if nil != err {
+			return nil, errors.Trace(err)
+		}
+		us := &UUIDSet{}
+		us.SID, err = uuid.FromBytes(sid)
+		if nil != err {
+			return nil, errors.Trace(err)
+		}
+		cnt, err := r.ReadUint64()
+		if nil != err {
+			return nil, errors.Trace(err)
+		}
+		us.Intervals = make([]Interval, 0, cnt)
+		for j := uint64(0); j < cnt; j++ {
+			var it Interval
+			if it.Start, err = r.ReadInt64(); nil != err {
+				return nil, errors.Trace(err)
+			}
+			if it.Stop, err = r.ReadInt64(); nil != err {
+				return nil, errors.Trace(err)
+			}
+			us.Intervals = append(us.Intervals, it)
+		}
+		s.addUUIDSet(us)
+	}
+	r.End()
+
+	return s, nil
+}
+
+func (s *MysqlGTIDSet) addUUIDSet(us *UUIDSet) {
+	key := us.SID.String()
+	if v, ok := s.Sets[key]; ok {
+		v.AddInterval(us.Intervals...)
+		return
+	}
+	s.Sets[key] = us
+}
+
+func (s *MysqlGTIDSet) sortedKeys() []string {
+	keys := make([]string, 0, len(s.Sets))
+	for k := range s.Sets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String implements GTIDSet String
+func (s *MysqlGTIDSet) String() string {
+	keys := s.sortedKeys()
+	sets := make([]string, 0, len(keys))
+	for _, k := range keys {
+		sets = append(sets, s.Sets[k].String())
+	}
+	return strings.Join(sets, ",")
+}
+
+// Encode implements GTIDSet Encode
+// https://dev.mysql.com/doc/internals/en/com-binlog-dump-gtid.html
+func (s *MysqlGTIDSet) Encode() []byte {
+	w := serialize.NewBinWriter(nil)
+	if err := w.WriteUint64(uint64(len(s.Sets))); nil != err {
+		panic(err)
+	}
+	for _, k := range s.sortedKeys() {
+		us := s.Sets[k]
+		if err := w.WriteBytes(us.SID.Bytes()); nil != err {
+			panic(err)
+		}
+		if err := w.WriteUint64(uint64(len(us.Intervals))); nil != err {
+			panic(err)
+		}
+		for _, i := range us.Intervals {
+			if err := w.WriteInt64(i.Start); nil != err {
+				panic(err)
+			}
+			if err := w.WriteInt64(i.Stop); nil != err {
+				panic(err)
+			}
+		}
+	}
+	return w.Bytes()
+}
+
+// Update implements GTIDSet Update, the gtid is like uuid:gno
+func (s *MysqlGTIDSet) Update(gtid string) error {
+	us, err := ParseUUIDSet(gtid)
+	if nil != err {
+		return errors.Trace(err)
+	}
+	s.addUUIDSet(us)
+	return nil
+}
+
+// Merge implements GTIDSet Merge
+func (s *MysqlGTIDSet) Merge(o GTIDSet) error {
+	ms, ok := o.(*MysqlGTIDSet)
+	if !ok {
+		return errors.Errorf("can't merge %T into mysql gtid set", o)
+	}
+	for _, us := range ms.Clone().(*MysqlGTIDSet).Sets {
+		s.addUUIDSet(us)
+	}
+	return nil
+}
+
+// Contain implements GTIDSet Contain
+func (s *MysqlGTIDSet) Contain(o GTIDSet) bool {
+	ms, ok := o.(*MysqlGTIDSet)
+	if !ok {
+		return false
+	}
+	for k, ous := range ms.Sets {
+		us, ok := s.Sets[k]
+		if !ok {
+			return false
+		}
+		if !us.Contain(ous) {
+			return false
+		}
+	}
+	return true
+}
+
+// Clone implements GTIDSet Clone
+func (s *MysqlGTIDSet) Clone() GTIDSet {
+	c := NewMysqlGTIDSet()
+	for k, us := range s.Sets {
+		cus := &UUIDSet{SID: us.SID}
+		cus.Intervals = make([]Interval, len(us.Intervals))
+		copy(cus.Intervals, us.Intervals)
+		c.Sets[k] = cus
+	}
+	return c
+}
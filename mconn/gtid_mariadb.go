@@ -0,0 +1,159 @@
+package mconn
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// MariadbGTID is a mariadb gtid like domain-server-sequence
+type MariadbGTID struct {
+	DomainID       uint32
+	ServerID       uint32
+	SequenceNumber uint64
+}
+
+// ParseMariadbGTID parses the text like 0-1-100
+func ParseMariadbGTID(str string) (*MariadbGTID, error) {
+	parts := strings.Split(strings.TrimSpace(str), "-")
+	if len(parts) != 3 {
+		return nil, errors.Errorf("invalid mariadb gtid format %s", str)
+	}
+
+	domainID, err := strconv.ParseUint(parts[0], 10, 32)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	serverID, err := strconv.ParseUint(parts[1], 10, 32)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	seq, err := strconv.ParseUint(parts[2], 10, 64)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+
+	return &MariadbGTID{
+		DomainID:       uint32(domainID),
+		ServerID:       uint32(serverID),
+		SequenceNumber: seq,
+	}, nil
+}
+
+func (g *MariadbGTID) String() string {
+	return fmt.Sprintf("%d-%d-%d", g.DomainID, g.ServerID, g.SequenceNumber)
+}
+
+// MariadbGTIDSet is the gtid position of mariadb, it holds the last
+// gtid of every replication domain, the same as @@gtid_slave_pos
+type MariadbGTIDSet struct {
+	Sets map[uint32]*MariadbGTID
+}
+
+// NewMariadbGTIDSet creates an empty mariadb gtid set
+func NewMariadbGTIDSet() *MariadbGTIDSet {
+	return &MariadbGTIDSet{Sets: make(map[uint32]*MariadbGTID)}
+}
+
+// ParseMariadbGTIDSet parses the text like 0-1-100,1-2-200
+func ParseMariadbGTIDSet(str string) (*MariadbGTIDSet, error) {
+	s := NewMariadbGTIDSet()
+	str = strings.TrimSpace(str)
+	if "" == str {
+		return s, nil
+	}
+
+	for _, v := range strings.Split(str, ",") {
+		v = strings.TrimSpace(v)
+		if "" == v {
+			continue
+		}
+		g, err := ParseMariadbGTID(v)
+		if nil != err {
+			return nil, errors.Trace(err)
+		}
+		if _, ok := s.Sets[g.DomainID]; ok {
+			return nil, errors.Errorf("duplicate domain %d in mariadb gtid set %s", g.DomainID, str)
+		}
+		s.Sets[g.DomainID] = g
+	}
+	return s, nil
+}
+
+// String implements GTIDSet String
+func (s *MariadbGTIDSet) String() string {
+	domains := make([]int, 0, len(s.Sets))
+	for k := range s.Sets {
+		domains = append(domains, int(k))
+	}
+	sort.Ints(domains)
+
+	sets := make([]string, 0, len(domains))
+	for _, d := range domains {
+		sets = append(sets, s.Sets[uint32(d)].String())
+	}
+	return strings.Join(sets, ",")
+}
+
+// Encode implements GTIDSet Encode, mariadb uses the text format as @slave_connect_state
+func (s *MariadbGTIDSet) Encode() []byte {
+	return []byte(s.String())
+}
+
+// Update implements GTIDSet Update, the gtid replaces the position of its domain
+func (s *MariadbGTIDSet) Update(gtid string) error {
+	g, err := ParseMariadbGTID(gtid)
+	if nil != err {
+		return errors.Trace(err)
+	}
+	s.Sets[g.DomainID] = g
+	return nil
+}
+
+// Merge implements GTIDSet Merge, the greater sequence of each domain is kept
+func (s *MariadbGTIDSet) Merge(o GTIDSet) error {
+	ms, ok := o.(*MariadbGTIDSet)
+	if !ok {
+		return errors.Errorf("can't merge %T into mariadb gtid set", o)
+	}
+	for k, og := range ms.Sets {
+		g, ok := s.Sets[k]
+		if ok && g.SequenceNumber >= og.SequenceNumber {
+			continue
+		}
+		cg := *og
+		s.Sets[k] = &cg
+	}
+	return nil
+}
+
+// Contain implements GTIDSet Contain
+func (s *MariadbGTIDSet) Contain(o GTIDSet) bool {
+	ms, ok := o.(*MariadbGTIDSet)
+	if !ok {
+		return false
+	}
+	for k, og := range ms.Sets {
+		g, ok := s.Sets[k]
+		if !ok {
+			return false
+		}
+		if g.SequenceNumber < og.SequenceNumber {
+			return false
+		}
+	}
+	return true
+}
+
+// Clone implements GTIDSet Clone
+func (s *MariadbGTIDSet) Clone() GTIDSet {
+	c := NewMariadbGTIDSet()
+	for k, g := range s.Sets {
+		cg := *g
+		c.Sets[k] = &cg
+	}
+	return c
+}
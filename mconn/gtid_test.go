@@ -0,0 +1,81 @@
+package mconn
+
+import "testing"
+
+func TestMysqlGTIDSet(t *testing.T) {
+	s, err := ParseMysqlGTIDSet("3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5:7,\n3e11fa47-71ca-11e1-9e33-c80aa9429562:6")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if s.String() != "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-7" {
+		t.Errorf("unexpected gtid set %s", s.String())
+	}
+
+	if err = s.Update("3e11fa47-71ca-11e1-9e33-c80aa9429562:9"); nil != err {
+		t.Fatal(err)
+	}
+	o, err := ParseMysqlGTIDSet("5aa9c3b0-54a2-11e8-8f1b-0242ac110002:1-3")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if s.Contain(o) {
+		t.Errorf("%s should not contain %s", s, o)
+	}
+	if err = s.Merge(o); nil != err {
+		t.Fatal(err)
+	}
+	expect := "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-7:9,5aa9c3b0-54a2-11e8-8f1b-0242ac110002:1-3"
+	if s.String() != expect {
+		t.Errorf("merged gtid set should be %s, but got %s", expect, s.String())
+	}
+	if !s.Contain(o) {
+		t.Errorf("%s should contain %s", s, o)
+	}
+
+	d, err := DecodeMysqlGTIDSet(s.Encode())
+	if nil != err {
+		t.Fatal(err)
+	}
+	if d.String() != expect {
+		t.Errorf("decoded gtid set should be %s, but got %s", expect, d.String())
+	}
+
+	if _, err = ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:5-1"); nil == err {
+		t.Errorf("invalid interval should fail")
+	}
+}
+
+func TestMariadbGTIDSet(t *testing.T) {
+	s, err := ParseGTIDSet(MariaDBFlavor, "1-2-200, 0-1-100")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if s.String() != "0-1-100,1-2-200" {
+		t.Errorf("unexpected gtid set %s", s.String())
+	}
+
+	if err = s.Update("0-3-101"); nil != err {
+		t.Fatal(err)
+	}
+	o, err := ParseMariadbGTIDSet("0-1-99,2-1-5")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if s.Contain(o) {
+		t.Errorf("%s should not contain %s", s, o)
+	}
+	if err = s.Merge(o); nil != err {
+		t.Fatal(err)
+	}
+	expect := "0-3-101,1-2-200,2-1-5"
+	if s.String() != expect {
+		t.Errorf("merged gtid set should be %s, but got %s", expect, s.String())
+	}
+	if !s.Contain(o) {
+		t.Errorf("%s should contain %s", s, o)
+	}
+
+	if _, err = ParseMariadbGTIDSet("0-1-1,0-2-2"); nil == err {
+		t.Errorf("duplicate domain should fail")
+	}
+}
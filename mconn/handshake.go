@@ -1,6 +1,12 @@
 package mconn
 
-import "github.com/juju/errors"
+import (
+	"bufio"
+	"crypto/tls"
+	"strings"
+
+	"github.com/juju/errors"
+)
 
 func (c *Conn) handshake(username, password, database string) error {
 	handshake, err := c.readHandshake()
@@ -15,22 +21,78 @@ func (c *Conn) handshake(username, password, database string) error {
 		return errors.New("protocol only support secure connection")
 	}
 
-	// Send handshake response
-	var rsp PacketHandshakeResponse
-	rsp.Charset = CharsetUtf8GeneralCI
-	rsp.Username = username
-	rsp.Password = password
-	rsp.Database = database
 	capability := uint32(0)
 	capability |= clientProtocol41
 	capability |= clientSecureConnection
 	capability |= clientLongPassword
 	capability |= clientTransactions
 	capability |= clientLongFlag
+	capability |= clientPluginAuth
 	capability &= handshake.CapabilityFlags
+	compression := c.negotiateCompression(handshake.CapabilityFlags)
+	switch compression {
+	case CompressionZlib:
+		{
+			capability |= clientCompress
+		}
+	case CompressionZstd:
+		{
+			capability |= clientZstdCompression
+		}
+	}
+
+	// Switch to tls before sending the credentials
+	if nil != c.tlsConfig {
+		if 0 != (handshake.CapabilityFlags & clientSSL) {
+			capability |= clientSSL
+			if err = c.upgradeTLS(capability); nil != err {
+				return errors.Trace(err)
+			}
+		} else if SSLModePreferred != c.ds.Mode() {
+			return errors.New("tls is required but the server does not support it")
+		}
+	}
+
+	// Prepare the auth plugin, use mysql_native_password if the plugin is unknown
+	pluginName := handshake.AuthPluginName
+	if "" == pluginName {
+		pluginName = MySQLNativePasswordPlugin
+	}
+	plugin, ok := GetAuthPlugin(pluginName)
+	if !ok {
+		plugin, _ = GetAuthPlugin(MySQLNativePasswordPlugin)
+	}
+	authCtx := &AuthContext{
+		Password: password,
+		Seed:     handshake.AuthPluginDataPart,
+		Secure:   c.isSecure(),
+	}
+	if nil != c.ds && "" != c.ds.ServerPubKey {
+		if authCtx.PublicKey, err = LoadPublicKey(c.ds.ServerPubKey); nil != err {
+			return errors.Trace(err)
+		}
+	}
+	authData, err := plugin.Auth(authCtx)
+	if nil != err {
+		return errors.Trace(err)
+	}
+
+	// Send handshake response
+	var rsp PacketHandshakeResponse
+	rsp.Charset = CharsetUtf8GeneralCI
+	rsp.Username = username
+	rsp.AuthResponse = authData
+	rsp.AuthPluginName = plugin.Name()
+	if CompressionZstd == compression {
+		level := c.ds.CompressionLevel
+		if 0 == level {
+			level = defaultZstdCompressLevel
+		}
+		rsp.ZstdCompressionLevel = uint8(level)
+	}
+	rsp.Database = database
 	//capability = 0x000aa285
 	rsp.CapabilityFlags = capability
-	rsp.AuthPluginData = handshake.AuthPluginDataPart
 	rspData := rsp.Encode()
 	if err = c.WritePacket(rspData); nil != err {
 		return errors.Trace(err)
@@ -38,26 +100,16 @@ func (c *Conn) handshake(username, password, database string) error {
 	c.capability = capability
 
 	// Read server response
-	data, err := c.ReadPacket()
-	if nil != err {
+	if err = c.readAuthResult(plugin, authCtx); nil != err {
 		return errors.Trace(err)
 	}
-	switch data[0] {
-	case PacketHeaderOK:
-		{
-			if _, err = c.readPacketOK(data); nil != err {
-				return errors.Trace(err)
-			}
-			// Handshake done
-		}
-	case PacketHeaderERR:
-		{
-			perr, err := c.readPacketERR(data)
-			if nil != err {
-				return errors.Trace(err)
-			}
-			return errors.New(perr.ErrorMessage)
+
+	// Packets are compressed after the handshake
+	if CompressionNone != compression {
+		if c.comp, err = newCompressor(compression, c.ds.CompressionLevel, c.r, c.conn); nil != err {
+			return errors.Trace(err)
 		}
+		c.r = c.comp
 	}
 
 	// Update server info
@@ -68,6 +120,127 @@ func (c *Conn) handshake(username, password, database string) error {
 	return nil
 }
 
+// readAuthResult handles the auth exchanges until the server returns OK or ERR
+func (c *Conn) readAuthResult(plugin AuthPlugin, authCtx *AuthContext) error {
+	for {
+		data, err := c.ReadPacket()
+		if nil != err {
+			return errors.Trace(err)
+		}
+
+		var authData []byte
+		switch data[0] {
+		case PacketHeaderOK:
+			{
+				if _, err = c.readPacketOK(data); nil != err {
+					return errors.Trace(err)
+				}
+				// Handshake done
+				return nil
+			}
+		case PacketHeaderERR:
+			{
+				perr, err := c.readPacketERR(data)
+				if nil != err {
+					return errors.Trace(err)
+				}
+				return errors.New(perr.ErrorMessage)
+			}
+		case authSwitchRequestHeader:
+			{
+				var req PacketAuthSwitchRequest
+				if err = req.Decode(data); nil != err {
+					return errors.Trace(err)
+				}
+				var ok bool
+				if plugin, ok = GetAuthPlugin(req.PluginName); !ok {
+					return errors.Errorf("auth plugin %s is not supported", req.PluginName)
+				}
+				authCtx.Seed = req.AuthPluginData
+				if authData, err = plugin.Auth(authCtx); nil != err {
+					return errors.Trace(err)
+				}
+				// Auth switch response can't be empty
+				if nil == authData {
+					authData = []byte{}
+				}
+			}
+		case authMoreDataHeader:
+			{
+				if authData, err = plugin.MoreData(authCtx, data[1:]); nil != err {
+					return errors.Trace(err)
+				}
+			}
+		default:
+			{
+				return ErrMalformPacket
+			}
+		}
+
+		if nil == authData {
+			continue
+		}
+		// Auth data is sent as a raw packet
+		pkt := make([]byte, 4+len(authData))
+		copy(pkt[4:], authData)
+		if err = c.WritePacket(pkt); nil != err {
+			return errors.Trace(err)
+		}
+	}
+}
+
+// negotiateCompression returns the compression algorithm supported by both sides
+func (c *Conn) negotiateCompression(serverCapability uint32) string {
+	if nil == c.ds {
+		return CompressionNone
+	}
+	switch strings.ToLower(c.ds.Compression) {
+	case CompressionZstd:
+		{
+			if 0 != (serverCapability & clientZstdCompression) {
+				return CompressionZstd
+			}
+			if 0 != (serverCapability & clientCompress) {
+				return CompressionZlib
+			}
+		}
+	case CompressionZlib:
+		{
+			if 0 != (serverCapability & clientCompress) {
+				return CompressionZlib
+			}
+		}
+	}
+	return CompressionNone
+}
+
+// upgradeTLS sends the ssl request and switches the connection to tls
+func (c *Conn) upgradeTLS(capability uint32) error {
+	req := PacketSSLRequest{
+		CapabilityFlags: capability,
+		Charset:         CharsetUtf8GeneralCI,
+	}
+	if err := c.WritePacket(req.Encode()); nil != err {
+		return errors.Trace(err)
+	}
+	tlsConn := tls.Client(c.conn, c.tlsConfig)
+	if err := tlsConn.Handshake(); nil != err {
+		return errors.Annotate(err, "tls handshake")
+	}
+	// Server sends nothing before tls handshake, so the buffered reader is empty
+	c.conn = tlsConn
+	c.r = bufio.NewReader(c)
+	return nil
+}
+
+// isSecure returns true if the password can be sent in clear text
+func (c *Conn) isSecure() bool {
+	if _, ok := c.conn.(*tls.Conn); ok {
+		return true
+	}
+	return c.conn.RemoteAddr().Network() == "unix"
+}
+
 //
 func (c *Conn) readHandshake() (*PacketHandshake, error) {
 	payloadData, err := c.ReadPacket()
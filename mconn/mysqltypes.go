@@ -11,8 +11,12 @@ const (
 	clientLongFlag     = 0x00000004
 	// clientConnectWithDB can contains a database name in handshake response
 	clientConnectWithDB = 0x00000008
+	// clientCompress uses the zlib compression protocol
+	clientCompress = 0x00000020
 	// clientProtocol41 represents server supports the 4.1 protocol
 	clientProtocol41 = 0x00000200
+	// clientSSL switches to ssl after sending the capability flags
+	clientSSL = 0x00000800
 	// clientTransactions, server can send status flags in EOF_Packet.
 	clientTransactions = 0x00002000
 	// clientSecureConnection represents client supports Authentication::Native41
@@ -21,6 +25,8 @@ const (
 	clientPluginAuth = 0x00080000
 	// clientSessionTrace can contains session-state changes after OK packet if server set the flag
 	clientSessionTrace = 0x00800000
+	// clientZstdCompression uses the zstd compression protocol
+	clientZstdCompression = 0x04000000
 )
 
 const (
@@ -38,6 +44,28 @@ const (
 	comRegisterSlave = 0x15
 	// https://dev.mysql.com/doc/internals/en/com-binlog-dump.html
 	comBinlogDump = 0x12
+	// https://dev.mysql.com/doc/internals/en/com-binlog-dump-gtid.html
+	comBinlogDumpGtid = 0x1e
+	// https://dev.mysql.com/doc/internals/en/com-stmt-prepare.html
+	comStmtPrepare = 0x16
+	// https://dev.mysql.com/doc/internals/en/com-stmt-execute.html
+	comStmtExecute = 0x17
+	// https://dev.mysql.com/doc/internals/en/com-stmt-close.html
+	comStmtClose = 0x19
+)
+
+// semiSyncIndicator is the magic number of semi-sync packets
+const semiSyncIndicator = 0xef
+
+// Flags of binlog dump command
+const (
+	// BinlogDumpNonBlock makes the master send a EOF_Packet instead of blocking the connection
+	// if there is no more event to send
+	BinlogDumpNonBlock = 0x01
+	// BinlogThroughPosition means the dump starts from the binlog file and position
+	BinlogThroughPosition = 0x02
+	// BinlogThroughGtid means the dump starts from the gtid set
+	BinlogThroughGtid = 0x04
 )
 
 // Charset SELECT id, collation_name FROM information_schema.collations ORDER BY id;
@@ -143,7 +171,7 @@ func (i *LenencInt) Get() uint64 {
 
 // Set stores normal number in lenenc number format
 func (i *LenencInt) Set(v uint64) {
-	var buf [8]byte
+	var buf [9]byte
 	switch {
 	case v < 0xfb:
 		{
@@ -156,12 +184,12 @@ func (i *LenencInt) Set(v uint64) {
 		}
 	case v >= 1<<16 && v < 1<<24:
 		{
-			buf[1] = 0xfd
+			buf[0] = 0xfd
 			binary.LittleEndian.PutUint32(buf[1:], uint32(v))
 		}
 	case v >= 1<<24 && v <= (1<<64-1):
 		{
-			buf[1] = 0xfe
+			buf[0] = 0xfe
 			binary.LittleEndian.PutUint64(buf[1:], v)
 		}
 	}
@@ -188,6 +216,6 @@ func (s *LenencString) FromData(data []byte) int {
 		s.EOF = true
 		return parsed
 	}
-	s.Value = string(data[1 : 1+l])
+	s.Value = string(data[parsed : parsed+int(l)])
 	return parsed + int(l)
 }
@@ -1,8 +1,6 @@
 package mconn
 
 import (
-	"crypto/sha1"
-
 	"github.com/juju/errors"
 	"github.com/sryanyuan/binp/serialize"
 )
@@ -31,9 +29,9 @@ func (p *PacketHeader) GetLength() int {
 func (p *PacketHeader) SetLength(v int) {
 	data := p.ToSlice()
 	uv := uint32(v)
-	data[0] = byte(uv & 0x000000ff)
-	data[1] = byte(uv & 0x0000ff00)
-	data[2] = byte(uv & 0x00ff0000)
+	data[0] = byte(uv)
+	data[1] = byte(uv >> 8)
+	data[2] = byte(uv >> 16)
 }
 
 // GetSequence returns the header sequence
@@ -138,13 +136,13 @@ func (p *PacketHandshake) Decode(data []byte) error {
 	// auth plugin data part2
 	if (p.CapabilityFlags & clientSecureConnection) != 0 {
 		// auth plugin data part2 length is mutable. $len=MAX(13, length of auth-plugin-data - 8)
-		p2len := authPluginDataLen - 8
-		if p2len > 13 {
+		p2len := int(authPluginDataLen) - 8
+		if p2len < 13 {
 			p2len = 13
 		}
 		// mysql-5.7/sql/auth/sql_authentication.cc line 538, the 13th byte is '\0',
 		// so it is a null terminated string.so we read the data as a null terminated string.
-		authPluginDataPart, err = r.ReadBytes(int(p2len) - 1)
+		authPluginDataPart, err = r.ReadBytes(p2len - 1)
 		if nil != err {
 			return errors.Trace(err)
 		}
@@ -172,6 +170,70 @@ func (p *PacketHandshake) Decode(data []byte) error {
 	return nil
 }
 
+// Encode serialize the handshake packet, used by the server side
+func (p *PacketHandshake) Encode() []byte {
+	var err error
+	w := serialize.NewBinWriter(nil)
+
+	// Skip the payload length, auto fill by WritePacket
+	if err = w.WriteUint32(0); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint8(p.ProtocolVersion); nil != err {
+		panic(err)
+	}
+	if err = w.WriteStringWithTerm(p.ServerVersion); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint32(p.ConnectionID); nil != err {
+		panic(err)
+	}
+	// Auth plugin data part 1 and filter
+	if err = w.WriteBytes(p.AuthPluginDataPart[:8]); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint8(0); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint16(uint16(p.CapabilityFlags)); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint8(p.CharacterSet); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint16(p.StatusFlags); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint16(uint16(p.CapabilityFlags >> 16)); nil != err {
+		panic(err)
+	}
+	// auth plugin data len, including the terminal '\0'
+	if err = w.WriteUint8(uint8(len(p.AuthPluginDataPart) + 1)); nil != err {
+		panic(err)
+	}
+	reserved := [10]byte{}
+	if err = w.WriteBytes(reserved[:]); nil != err {
+		panic(err)
+	}
+	// auth plugin data part 2, at least 13 bytes with the terminal '\0'
+	part2 := make([]byte, 12)
+	copy(part2, p.AuthPluginDataPart[8:])
+	if len(p.AuthPluginDataPart) > 20 {
+		part2 = p.AuthPluginDataPart[8:]
+	}
+	if err = w.WriteBytes(part2); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint8(0); nil != err {
+		panic(err)
+	}
+	if err = w.WriteStringWithTerm(p.AuthPluginName); nil != err {
+		panic(err)
+	}
+
+	return w.Bytes()
+}
+
 // PacketHandshakeResponse responses the handshake packet to server
 // https://dev.mysql.com/doc/internals/en/connection-phase-packets.html#packet-Protocol::HandshakeResponse
 type PacketHandshakeResponse struct {
@@ -179,13 +241,14 @@ type PacketHandshakeResponse struct {
 	MaxPacketSize   uint32
 	Charset         uint8
 	// Reserved        [23]byte not used
-	Username           string // string[null]
-	Password           string
-	passEncoded        []byte
-	AuthResponseLength LenencInt
-	Database           string
-	// Decode part
-	AuthPluginData []byte
+	Username string // string[null]
+	// AuthResponse is the auth data computed by the auth plugin
+	AuthResponse []byte
+	Database     string
+	// AuthPluginName is the auth plugin of the auth response
+	AuthPluginName string
+	// ZstdCompressionLevel is sent if zstd compression is enabled
+	ZstdCompressionLevel uint8
 }
 
 func (p *PacketHandshakeResponse) esitimateSize() int {
@@ -202,47 +265,22 @@ func (p *PacketHandshakeResponse) esitimateSize() int {
 	sz += 23
 	// len(username) + 1 byte of null
 	sz += len(p.Username) + 1
-	// 1 byte of pass length + len(pass encoded)
-	sz += len(p.passEncoded) + 1
+	// 1 byte of auth response length + len(auth response)
+	sz += len(p.AuthResponse) + 1
 	// len(database) + 1 byte of null
 	if "" != p.Database {
 		sz += len(p.Database) + 1
 	}
 	// len client plugin auth + 1 byte of null
-	sz += len(MySQLNativePasswordPlugin) + 1
+	sz += len(p.AuthPluginName) + 1
+	// 1 byte of zstd compression level
+	sz++
 
 	return sz
 }
 
-func (p *PacketHandshakeResponse) encodePass(key []byte) []byte {
-	if "" == p.Password {
-		return nil
-	}
-	passBytes := []byte(p.Password)
-
-	s1 := sha1.New()
-	s1.Write(passBytes)
-	s1hash := s1.Sum(nil)
-
-	s1.Reset()
-	s1.Write(s1hash)
-	shash := s1.Sum(nil)
-
-	s1.Reset()
-	s1.Write(key)
-	s1.Write(shash)
-	phash := s1.Sum(nil)
-
-	for i := range phash {
-		phash[i] ^= s1hash[i]
-	}
-	return phash
-}
-
 // Encode serialize the handshake response
 func (p *PacketHandshakeResponse) Encode() []byte {
-	p.passEncoded = p.encodePass(p.AuthPluginData)
-
 	var err error
 	sz := p.esitimateSize()
 	data := make([]byte, sz)
@@ -269,7 +307,6 @@ func (p *PacketHandshakeResponse) Encode() []byte {
 	if err = w.WriteUint8(p.Charset); nil != err {
 		panic(err)
 	}
-	// TODO: tls/ssl
 	// 23bytes reserved
 	reserved := [23]byte{}
 	if err = w.WriteBytes(reserved[:]); nil != err {
@@ -279,28 +316,180 @@ func (p *PacketHandshakeResponse) Encode() []byte {
 	if err = w.WriteStringWithTerm(p.Username); nil != err {
 		panic(err)
 	}
-	// len + password
-	if nil == p.passEncoded {
-		if err = w.WriteUint8(0); nil != err {
+	// len + auth response
+	if err = w.WriteLenBytes(p.AuthResponse); nil != err {
+		panic(err)
+	}
+	// db name + null
+	if len(p.Database) != 0 {
+		if err = w.WriteStringWithTerm(p.Database); nil != err {
 			panic(err)
 		}
-	} else {
-		if err = w.WriteLenBytes(p.passEncoded); nil != err {
+	}
+	// client auth plugin + null
+	if 0 != (cpv & clientPluginAuth) {
+		if err = w.WriteStringWithTerm(p.AuthPluginName); nil != err {
 			panic(err)
 		}
 	}
-	// db name + null
-	if err = w.WriteStringWithTerm(p.Database); nil != err {
+	// zstd compression level
+	if 0 != (cpv & clientZstdCompression) {
+		if err = w.WriteUint8(p.ZstdCompressionLevel); nil != err {
+			panic(err)
+		}
+	}
+
+	return w.Bytes()
+}
+
+// Decode decodes the handshake response, used by the server side
+func (p *PacketHandshakeResponse) Decode(data []byte) error {
+	var err error
+	r := serialize.NewBinReader(data)
+
+	if p.CapabilityFlags, err = r.ReadUint32(); nil != err {
+		return errors.Trace(err)
+	}
+	if 0 == (p.CapabilityFlags & clientProtocol41) {
+		return errors.New("handshake response 320 is not supported")
+	}
+	if p.MaxPacketSize, err = r.ReadUint32(); nil != err {
+		return errors.Trace(err)
+	}
+	if p.Charset, err = r.ReadUint8(); nil != err {
+		return errors.Trace(err)
+	}
+	// 23bytes reserved
+	if _, err = r.ReadBytes(23); nil != err {
+		return errors.Trace(err)
+	}
+	if p.Username, err = r.ReadStringUntilTerm(); nil != err {
+		return errors.Trace(err)
+	}
+	if 0 != (p.CapabilityFlags & clientSecureConnection) {
+		l, err := r.ReadUint8()
+		if nil != err {
+			return errors.Trace(err)
+		}
+		if p.AuthResponse, err = r.ReadBytes(int(l)); nil != err {
+			return errors.Trace(err)
+		}
+	} else {
+		auth, err := r.ReadBytesUntilTerm()
+		if nil != err {
+			return errors.Trace(err)
+		}
+		p.AuthResponse = auth
+	}
+	if 0 != (p.CapabilityFlags&clientConnectWithDB) && !r.Empty() {
+		if p.Database, err = r.ReadStringUntilTerm(); nil != err {
+			return errors.Trace(err)
+		}
+	}
+	if 0 != (p.CapabilityFlags&clientPluginAuth) && !r.Empty() {
+		if p.AuthPluginName, err = r.ReadStringUntilTerm(); nil != err {
+			return errors.Trace(err)
+		}
+	}
+	r.End()
+
+	return nil
+}
+
+// PacketSemiSyncAck acknowledges the binlog position to the semi-sync master
+type PacketSemiSyncAck struct {
+	Position uint64
+	Filename string
+}
+
+// Encode serialize the semi-sync ack
+func (p *PacketSemiSyncAck) Encode() []byte {
+	var err error
+	data := make([]byte, 4+1+8+len(p.Filename))
+	w := serialize.NewBinWriter(data)
+
+	// Skip the payload length, auto fill by WritePacket
+	if err = w.WriteUint32(0); nil != err {
 		panic(err)
 	}
-	// client auth plugin
-	if err = w.WriteBytes([]byte(MySQLNativePasswordPlugin)); nil != err {
+	if err = w.WriteUint8(semiSyncIndicator); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint64(p.Position); nil != err {
+		panic(err)
+	}
+	if err = w.WriteEOFString(p.Filename); nil != err {
 		panic(err)
 	}
 
 	return w.Bytes()
 }
 
+// PacketSSLRequest asks the server to switch to ssl, it is the truncated handshake response
+// https://dev.mysql.com/doc/internals/en/connection-phase-packets.html#packet-Protocol::SSLRequest
+type PacketSSLRequest struct {
+	CapabilityFlags uint32
+	MaxPacketSize   uint32
+	Charset         uint8
+}
+
+// Encode serialize the ssl request
+func (p *PacketSSLRequest) Encode() []byte {
+	var err error
+	data := make([]byte, 4+4+4+1+23)
+	w := serialize.NewBinWriter(data)
+
+	// Skip the payload length, auto fill by WritePacket
+	if err = w.WriteUint32(0); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint32(p.CapabilityFlags | clientProtocol41 | clientSSL); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint32(p.MaxPacketSize); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint8(p.Charset); nil != err {
+		panic(err)
+	}
+	reserved := [23]byte{}
+	if err = w.WriteBytes(reserved[:]); nil != err {
+		panic(err)
+	}
+
+	return w.Bytes()
+}
+
+// PacketAuthSwitchRequest asks the client to authenticate with another auth plugin
+// https://dev.mysql.com/doc/internals/en/connection-phase-packets.html#packet-Protocol::AuthSwitchRequest
+type PacketAuthSwitchRequest struct {
+	PluginName     string
+	AuthPluginData []byte
+}
+
+// Decode decodes binary data to auth switch request
+func (p *PacketAuthSwitchRequest) Decode(data []byte) error {
+	var err error
+	r := serialize.NewBinReader(data)
+
+	// Header 0xfe
+	if _, err = r.ReadUint8(); nil != err {
+		return errors.Trace(err)
+	}
+	p.PluginName, err = r.ReadStringUntilTerm()
+	if nil != err {
+		return errors.Trace(err)
+	}
+	// The plugin data is terminated by '\0'
+	p.AuthPluginData = r.LeftBytes()
+	if l := len(p.AuthPluginData); l > 0 && p.AuthPluginData[l-1] == 0 {
+		p.AuthPluginData = p.AuthPluginData[:l-1]
+	}
+	r.End()
+
+	return nil
+}
+
 // Deprecated version
 /*// Encode serialize the handshake response
 func (p *PacketHandshakeResponse) Encode() []byte {
@@ -379,6 +568,10 @@ func (p *PacketOK) Decode(data []byte) error {
 	var err error
 	r := serialize.NewBinReader(data)
 
+	p.Header, err = r.ReadUint8()
+	if nil != err {
+		return errors.Trace(err)
+	}
 	// Check the ok packet is a eof packet
 	if p.Header == PacketHeaderEOF && len(data) < 9 {
 		p.EOF = true
@@ -419,6 +612,34 @@ func (p *PacketOK) Decode(data []byte) error {
 	return nil
 }
 
+// Encode serialize the ok packet, used by the server side
+func (p *PacketOK) Encode() []byte {
+	var err error
+	w := serialize.NewBinWriter(nil)
+
+	// Skip the payload length, auto fill by WritePacket
+	if err = w.WriteUint32(0); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint8(PacketHeaderOK); nil != err {
+		panic(err)
+	}
+	if err = w.WriteLenencInt(p.AffectedRows); nil != err {
+		panic(err)
+	}
+	if err = w.WriteLenencInt(p.LastInsertID); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint16(p.StatusFlags); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint16(p.Warnings); nil != err {
+		panic(err)
+	}
+
+	return w.Bytes()
+}
+
 // PacketErr parses mysql OK_Packet
 // https://dev.mysql.com/doc/internals/en/packet-ERR_Packet.html
 type PacketErr struct {
@@ -474,6 +695,35 @@ func (p *PacketErr) Decode(data []byte) error {
 	return nil
 }
 
+// Encode serialize the err packet, used by the server side
+func (p *PacketErr) Encode() []byte {
+	var err error
+	w := serialize.NewBinWriter(nil)
+
+	// Skip the payload length, auto fill by WritePacket
+	if err = w.WriteUint32(0); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint8(PacketHeaderERR); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint16(p.ErrorCode); nil != err {
+		panic(err)
+	}
+	state := p.State
+	if 5 != len(state) {
+		state = "HY000"
+	}
+	if err = w.WriteEOFString("#" + state); nil != err {
+		panic(err)
+	}
+	if err = w.WriteEOFString(p.ErrorMessage); nil != err {
+		panic(err)
+	}
+
+	return w.Bytes()
+}
+
 // PacketComStr is used to send the server a text-based query that is executed immediately
 type PacketComStr struct {
 	command string
@@ -498,6 +748,47 @@ func (p *PacketComStr) Encode() ([]byte, error) {
 	return w.Bytes(), nil
 }
 
+// PacketStmtPrepareOK is the first packet of the COM_STMT_PREPARE response
+// https://dev.mysql.com/doc/internals/en/com-stmt-prepare-response.html
+type PacketStmtPrepareOK struct {
+	StatementID uint32
+	ColumnCount uint16
+	ParamCount  uint16
+	Warnings    uint16
+}
+
+// Decode decodes binary data to mysql packet
+func (p *PacketStmtPrepareOK) Decode(data []byte) error {
+	r := serialize.NewBinReader(data)
+	header, err := r.ReadUint8()
+	if nil != err {
+		return errors.Trace(err)
+	}
+	if header != PacketHeaderOK {
+		return errors.New("not a stmt prepare ok packet")
+	}
+	if p.StatementID, err = r.ReadUint32(); nil != err {
+		return errors.Trace(err)
+	}
+	if p.ColumnCount, err = r.ReadUint16(); nil != err {
+		return errors.Trace(err)
+	}
+	if p.ParamCount, err = r.ReadUint16(); nil != err {
+		return errors.Trace(err)
+	}
+	// Reserved filler
+	if _, err = r.ReadUint8(); nil != err {
+		return errors.Trace(err)
+	}
+	if r.Empty() {
+		return nil
+	}
+	if p.Warnings, err = r.ReadUint16(); nil != err {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
 // PacketEOF represents the eof of packets
 type PacketEOF struct {
 	warnings uint16
@@ -536,6 +827,28 @@ func (p *PacketEOF) Decode(data []byte) error {
 	return nil*/
 }
 
+// Encode serialize the eof packet, used by the server side
+func (p *PacketEOF) Encode() []byte {
+	var err error
+	w := serialize.NewBinWriter(nil)
+
+	// Skip the payload length, auto fill by WritePacket
+	if err = w.WriteUint32(0); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint8(PacketHeaderEOF); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint16(p.warnings); nil != err {
+		panic(err)
+	}
+	if err = w.WriteUint16(p.status); nil != err {
+		panic(err)
+	}
+
+	return w.Bytes()
+}
+
 // PacketRegisterSlave register slave to master
 // https://dev.mysql.com/doc/internals/en/com-register-slave.html
 type PacketRegisterSlave struct {
@@ -617,6 +930,40 @@ func (p *PacketRegisterSlave) Encode() ([]byte, error) {
 	return data, nil*/
 }
 
+// Decode decodes the command packet, used by the server side
+func (p *PacketRegisterSlave) Decode(data []byte) error {
+	var err error
+	r := serialize.NewBinReader(data)
+
+	if _, err = r.ReadUint8(); nil != err {
+		return errors.Trace(err)
+	}
+	if p.ServerID, err = r.ReadUint32(); nil != err {
+		return errors.Trace(err)
+	}
+	if p.Hostname, err = r.ReadLenString(); nil != err {
+		return errors.Trace(err)
+	}
+	if p.User, err = r.ReadLenString(); nil != err {
+		return errors.Trace(err)
+	}
+	if p.Password, err = r.ReadLenString(); nil != err {
+		return errors.Trace(err)
+	}
+	if p.Port, err = r.ReadUint16(); nil != err {
+		return errors.Trace(err)
+	}
+	if p.Rank, err = r.ReadUint32(); nil != err {
+		return errors.Trace(err)
+	}
+	if p.MasterID, err = r.ReadUint32(); nil != err {
+		return errors.Trace(err)
+	}
+	r.End()
+
+	return nil
+}
+
 // PacketBinlogDump to enable replication
 type PacketBinlogDump struct {
 	BinlogPos  uint32
@@ -653,6 +1000,121 @@ func (p *PacketBinlogDump) Encode() ([]byte, error) {
 	return w.Bytes(), nil
 }
 
+// Decode decodes the command packet, used by the server side
+func (p *PacketBinlogDump) Decode(data []byte) error {
+	var err error
+	r := serialize.NewBinReader(data)
+
+	if _, err = r.ReadUint8(); nil != err {
+		return errors.Trace(err)
+	}
+	if p.BinlogPos, err = r.ReadUint32(); nil != err {
+		return errors.Trace(err)
+	}
+	if p.Flags, err = r.ReadUint16(); nil != err {
+		return errors.Trace(err)
+	}
+	if p.ServerID, err = r.ReadUint32(); nil != err {
+		return errors.Trace(err)
+	}
+	if p.BinlogFile, err = r.ReadEOFString(); nil != err {
+		return errors.Trace(err)
+	}
+	r.End()
+
+	return nil
+}
+
+// PacketBinlogDumpGtid to enable replication with the gtid set
+// https://dev.mysql.com/doc/internals/en/com-binlog-dump-gtid.html
+type PacketBinlogDumpGtid struct {
+	Flags      uint16
+	ServerID   uint32
+	BinlogFile string
+	BinlogPos  uint64
+	// Data is the encoded gtid set, only sent if BinlogThroughGtid flag is set
+	Data []byte
+}
+
+// Encode encodes the packet to binary data
+func (p *PacketBinlogDumpGtid) Encode() ([]byte, error) {
+	l := 4 + 1 + 2 + 4 + 4 + len(p.BinlogFile) + 8
+	if p.Flags&BinlogThroughGtid != 0 {
+		l += 4 + len(p.Data)
+	}
+	data := make([]byte, l)
+	w := serialize.NewBinWriter(data)
+
+	if err := w.WriteUint32(0); nil != err {
+		return nil, errors.Trace(err)
+	}
+	if err := w.WriteUint8(comBinlogDumpGtid); nil != err {
+		return nil, errors.Trace(err)
+	}
+	if err := w.WriteUint16(p.Flags); nil != err {
+		return nil, errors.Trace(err)
+	}
+	if err := w.WriteUint32(p.ServerID); nil != err {
+		return nil, errors.Trace(err)
+	}
+	if err := w.WriteUint32(uint32(len(p.BinlogFile))); nil != err {
+		return nil, errors.Trace(err)
+	}
+	if err := w.WriteEOFString(p.BinlogFile); nil != err {
+		return nil, errors.Trace(err)
+	}
+	if err := w.WriteUint64(p.BinlogPos); nil != err {
+		return nil, errors.Trace(err)
+	}
+	if p.Flags&BinlogThroughGtid != 0 {
+		if err := w.WriteUint32(uint32(len(p.Data))); nil != err {
+			return nil, errors.Trace(err)
+		}
+		if err := w.WriteBytes(p.Data); nil != err {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	return w.Bytes(), nil
+}
+
+// Decode decodes the command packet, used by the server side
+func (p *PacketBinlogDumpGtid) Decode(data []byte) error {
+	var err error
+	r := serialize.NewBinReader(data)
+
+	if _, err = r.ReadUint8(); nil != err {
+		return errors.Trace(err)
+	}
+	if p.Flags, err = r.ReadUint16(); nil != err {
+		return errors.Trace(err)
+	}
+	if p.ServerID, err = r.ReadUint32(); nil != err {
+		return errors.Trace(err)
+	}
+	l, err := r.ReadUint32()
+	if nil != err {
+		return errors.Trace(err)
+	}
+	if p.BinlogFile, err = r.ReadStringWithLen(int(l)); nil != err {
+		return errors.Trace(err)
+	}
+	if p.BinlogPos, err = r.ReadUint64(); nil != err {
+		return errors.Trace(err)
+	}
+	if p.Flags&BinlogThroughGtid != 0 {
+		if l, err = r.ReadUint32(); nil != err {
+			return errors.Trace(err)
+		}
+		if p.Data, err = r.ReadBytes(int(l)); nil != err {
+			return errors.Trace(err)
+		}
+	}
+	r.End()
+
+	return nil
+}
+
 // Deprecated version
 /*// Encode encodes the packet to binary data
 func (p *PacketBinlogDump) Encode() ([]byte, error) {
@@ -3,6 +3,7 @@ package mconn
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/juju/errors"
 )
@@ -13,13 +14,39 @@ type DataSource struct {
 	Port     uint16 `json:"port" toml:"port"`
 	Username string `json:"username" toml:"username"`
 	Password string `json:"password" toml:"password"`
+	// ServerPubKey is the PEM file of the server rsa public key used by sha256 auth plugins,
+	// the key is retrieved from server if not specified
+	ServerPubKey string `json:"server-pub-key" toml:"server-pub-key"`
+	// Compression is the protocol compression algorithm, zlib or zstd. If the server does
+	// not support zstd, zlib is used, and the connection is uncompressed if neither is supported
+	Compression string `json:"compression" toml:"compression"`
+	// CompressionLevel is the level of the compression algorithm, 0 uses the default level
+	CompressionLevel int `json:"compression-level" toml:"compression-level"`
+	SSLOptions
+	DialOptions
 }
 
-// Address returns the address of the data source
+// Address returns the address of the data source, returns the socket path if using unix socket
 func (s *DataSource) Address() string {
+	if "" != s.Socket {
+		return s.Socket
+	}
 	return fmt.Sprintf("%s:%d", s.Host, s.Port)
 }
 
+// ToDBConfig returns the database/sql connection config of the data source
+func (s *DataSource) ToDBConfig() *DBConfig {
+	return &DBConfig{
+		Type:        "mysql",
+		Host:        s.Host,
+		Port:        s.Port,
+		Username:    s.Username,
+		Password:    s.Password,
+		SSLOptions:  s.SSLOptions,
+		DialOptions: s.DialOptions,
+	}
+}
+
 // DBConfig is the connection information to db server
 type DBConfig struct {
 	Type     string `json:"type" toml:"type"`
@@ -28,15 +55,107 @@ type DBConfig struct {
 	Username string `json:"username" toml:"username"`
 	Password string `json:"password" toml:"password"`
 	Charset  string `json:"charset" toml:"charset"`
+	SSLOptions
+	DialOptions
 }
 
 // ReplicationConfig specify the master information
 type ReplicationConfig struct {
 	SlaveID uint32 `json:"slave-id" toml:"slave-id"`
 	//Pos             Position `json:"position" toml:"position"`
+	// EnableGtid dumps binlog by the executed gtid set instead of the file and position
 	EnableGtid      bool `json:"enable-gtid" toml:"enable-gtid"`
 	EventBufferSize int  `json:"event-buffer-size" toml:"event-buffer-size"`
 	KeepAlivePeriod int  `json:"keepalive-period" toml:"keepalive-period"`
+	// Mariadb gtid replication options, see @slave_gtid_strict_mode and @slave_gtid_ignore_duplicates
+	MariadbGtidStrictMode       bool `json:"mariadb-gtid-strict-mode" toml:"mariadb-gtid-strict-mode"`
+	MariadbGtidIgnoreDuplicates bool `json:"mariadb-gtid-ignore-duplicates" toml:"mariadb-gtid-ignore-duplicates"`
+	// SemiSync makes the slave a semi-sync replica if the master enables semi-sync
+	SemiSync bool `json:"semi-sync" toml:"semi-sync"`
+	// SemiSyncAckPolicy decides when the event is acknowledged, see SemiSyncAckPolicy*
+	SemiSyncAckPolicy string `json:"semi-sync-ack-policy" toml:"semi-sync-ack-policy"`
+	// NonBlock makes the dump stop at the current end of binlog instead of waiting for new events
+	NonBlock bool `json:"non-block" toml:"non-block"`
+	// Stop conditions of the dump, the replication stops once any of them is reached
+	StopCondition
+	// RelayLog persists events to local files before they are consumed
+	RelayLog RelayLogConfig `json:"relay-log" toml:"relay-log"`
+	// ChecksumPolicy decides how events from the master with mismatched checksum are handled,
+	// see ChecksumPolicy*. Corrupted relay log events always fail the replication
+	ChecksumPolicy string `json:"checksum-policy" toml:"checksum-policy"`
+}
+
+// RelayLogConfig is the config of the relay log. Relay log files left by the last run are
+// recovered on start, events after the consumed point are read from them and the dump
+// resumes after the last complete transaction. They are removed if the consumed point is
+// not found in them, then the replication restarts from the consumed point
+type RelayLogConfig struct {
+	// Dir is the directory of relay log files, the relay log is disabled if empty
+	Dir string `json:"dir" toml:"dir"`
+	// BaseName is the base name of relay log files and the index file, relay-bin by default
+	BaseName string `json:"base-name" toml:"base-name"`
+	// MaxFileSize rotates the relay log file once its size reaches the limit in MB, 100 by default
+	MaxFileSize int `json:"max-file-size" toml:"max-file-size"`
+	// Consumed relay log files are purged once their total size exceeds MaxTotalSize in MB or
+	// they are older than MaxAge hours, they are purged at once if both are 0
+	MaxTotalSize int `json:"max-total-size" toml:"max-total-size"`
+	MaxAge       int `json:"max-age" toml:"max-age"`
+}
+
+// IsEnabled returns true if the relay log is enabled
+func (c *RelayLogConfig) IsEnabled() bool {
+	return "" != c.Dir
+}
+
+// StopCondition is the end of the binlog dump
+type StopCondition struct {
+	// StopFile and StopPos stop the dump after the event ends at or beyond the position
+	StopFile string `json:"stop-file" toml:"stop-file"`
+	StopPos  uint32 `json:"stop-pos" toml:"stop-pos"`
+	// StopGtid stops the dump after the executed gtid set contains the gtid set
+	StopGtid string `json:"stop-gtid" toml:"stop-gtid"`
+	// StopTimestamp stops the dump before the first transaction logged after the unix timestamp
+	StopTimestamp uint32 `json:"stop-timestamp" toml:"stop-timestamp"`
+}
+
+// IsEmpty returns true if no stop condition is set
+func (c *StopCondition) IsEmpty() bool {
+	return "" == c.StopFile && "" == c.StopGtid && 0 == c.StopTimestamp
+}
+
+// Semi-sync ack policies
+const (
+	// SemiSyncAckPolicyCommit acks after the transaction is committed to destinations, it is the default policy
+	SemiSyncAckPolicyCommit = "commit"
+	// SemiSyncAckPolicyRelay acks after the event is written and synced to the relay log
+	SemiSyncAckPolicyRelay = "relay"
+)
+
+// GetSemiSyncAckPolicy returns the semi-sync ack policy, SemiSyncAckPolicyCommit by default
+func (c *ReplicationConfig) GetSemiSyncAckPolicy() string {
+	if "" == c.SemiSyncAckPolicy {
+		return SemiSyncAckPolicyCommit
+	}
+	return strings.ToLower(c.SemiSyncAckPolicy)
+}
+
+// Checksum policies
+const (
+	// ChecksumPolicyFail stops the replication with the error, it is the default policy
+	ChecksumPolicyFail = "fail"
+	// ChecksumPolicySkip logs and skips the corrupted event
+	ChecksumPolicySkip = "skip"
+	// ChecksumPolicyReconnect dumps the binlog again from the last point, the replication
+	// fails if the event is still corrupted, that is the binlog of the master is corrupted
+	ChecksumPolicyReconnect = "reconnect"
+)
+
+// GetChecksumPolicy returns the checksum policy, ChecksumPolicyFail by default
+func (c *ReplicationConfig) GetChecksumPolicy() string {
+	if "" == c.ChecksumPolicy {
+		return ChecksumPolicyFail
+	}
+	return strings.ToLower(c.ChecksumPolicy)
 }
 
 // Position represents a binlog replication position, slave can
@@ -44,7 +163,8 @@ type ReplicationConfig struct {
 type ReplicationPoint struct {
 	Filename string
 	Offset   uint32
-	Gtid     string
+	// Gtid is the text format of the executed gtid set
+	Gtid string
 }
 
 // RegisterSlave register the connection as a slave connection
@@ -89,7 +209,18 @@ func (c *Conn) StartDumpBinlog(pos ReplicationPoint) error {
 	var err error
 
 	if c.rc.EnableGtid {
-		return errors.New("Gtid replication not support now")
+		if c.si.Flavor() == MariaDBFlavor {
+			// Mariadb dumps binlog from the connect state, the position is ignored
+			if err = c.setMariadbConnectState(pos); nil != err {
+				return errors.Trace(err)
+			}
+			pos = ReplicationPoint{Offset: 4}
+		} else {
+			if err = c.sendBinlogDumpGtidCommand(pos); nil != err {
+				return errors.Trace(err)
+			}
+			return nil
+		}
 	}
 
 	if err = c.sendBinlogDumpCommand(pos); nil != err {
@@ -106,11 +237,94 @@ func (c *Conn) sendBinlogDumpCommand(pos ReplicationPoint) error {
 	pbd.BinlogPos = pos.Offset
 	pbd.BinlogFile = pos.Filename
 	pbd.ServerID = uint32(c.rc.SlaveID)
-	// Just one flag:
-	// Description
-	// 0x01 BINLOG_DUMP_NON_BLOCK
-	// if there is no more event to send send a EOF_Packet instead of blocking the connection
-	pbd.Flags = 0
+	pbd.Flags = c.dumpFlags()
+	data, err := pbd.Encode()
+	if nil != err {
+		return errors.Trace(err)
+	}
+
+	if err = c.WritePacket(data); nil != err {
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+func (c *Conn) dumpFlags() uint16 {
+	if c.rc.NonBlock {
+		return BinlogDumpNonBlock
+	}
+	return 0
+}
+
+// SemiSyncAck acknowledges the master that the events before the point are received,
+// it is safe to be called while the binlog is being read
+// https://dev.mysql.com/doc/internals/en/semi-sync-ack-packet.html
+func (c *Conn) SemiSyncAck(pos ReplicationPoint) error {
+	var ack PacketSemiSyncAck
+	ack.Position = uint64(pos.Offset)
+	ack.Filename = pos.Filename
+	data := ack.Encode()
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	// The ack packet always starts with sequence 0 and must not change
+	// the sequence of the dump stream
+	var header PacketHeader
+	header.SetLength(len(data) - 4)
+	header.SetSequence(0)
+	copy(data, header.ToSlice())
+	if nil != c.comp {
+		return errors.Trace(c.comp.writePacket(data, 0))
+	}
+	if _, err := c.conn.Write(data); nil != err {
+		return errors.Annotate(err, badConnErrDesc)
+	}
+	return nil
+}
+
+// https://mariadb.com/kb/en/gtid/#using-global-transaction-ids
+func (c *Conn) setMariadbConnectState(pos ReplicationPoint) error {
+	gset, err := ParseMariadbGTIDSet(pos.Gtid)
+	if nil != err {
+		return errors.Trace(err)
+	}
+	if _, err = c.Exec(fmt.Sprintf("SET @slave_connect_state = '%s'", gset.String())); nil != err {
+		return errors.Trace(err)
+	}
+	if _, err = c.Exec(fmt.Sprintf("SET @slave_gtid_strict_mode = %d",
+		boolToInt(c.rc.MariadbGtidStrictMode))); nil != err {
+		return errors.Trace(err)
+	}
+	if _, err = c.Exec(fmt.Sprintf("SET @slave_gtid_ignore_duplicates = %d",
+		boolToInt(c.rc.MariadbGtidIgnoreDuplicates))); nil != err {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+func boolToInt(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func (c *Conn) sendBinlogDumpGtidCommand(pos ReplicationPoint) error {
+	gset, err := ParseMysqlGTIDSet(pos.Gtid)
+	if nil != err {
+		return errors.Trace(err)
+	}
+
+	c.resetSequence()
+
+	var pbd PacketBinlogDumpGtid
+	pbd.ServerID = uint32(c.rc.SlaveID)
+	// Master will find the first binlog which contains the gtid not in the set,
+	// the binlog file and position are ignored
+	pbd.Flags = BinlogThroughGtid | c.dumpFlags()
+	pbd.BinlogPos = 4
+	pbd.Data = gset.Encode()
 	data, err := pbd.Encode()
 	if nil != err {
 		return errors.Trace(err)
@@ -5,6 +5,7 @@ import (
 	"io"
 
 	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/serialize"
 )
 
 // http://dev.mysql.com/doc/internals/en/status-flags.html
@@ -48,6 +49,8 @@ type ResultSet struct {
 	binary    bool
 	parseTime bool
 	moreRows  bool
+	// stmt is the prepared statement created by Exec with args
+	stmt *Stmt
 }
 
 // Columns get the column count
@@ -82,9 +85,12 @@ func (s *ResultSet) GetAtString(i int) (string, error) {
 	return "", ErrWrongFieldType
 }
 
-// Close close the result set
+// Close close the result set, the prepared statement of the result set is also closed
 func (s *ResultSet) Close() error {
 	if s.conn == nil {
+		if nil != s.stmt {
+			return errors.Trace(s.closeStmt())
+		}
 		return ErrInvalidConn
 	}
 	// Read the last eof packet
@@ -96,7 +102,16 @@ func (s *ResultSet) Close() error {
 	// All rows need to be skipped
 	s.conn = nil
 
-	return nil
+	return errors.Trace(s.closeStmt())
+}
+
+func (s *ResultSet) closeStmt() error {
+	if nil == s.stmt {
+		return nil
+	}
+	err := s.stmt.Close()
+	s.stmt = nil
+	return errors.Trace(err)
 }
 
 // Next get the next row data
@@ -152,7 +167,7 @@ func (s *ResultSet) readRowText() error {
 	s.datas = make([]interface{}, 0, s.columnCnt)
 	for i := 0; i < s.columnCnt; i++ {
 		// Check null
-		if rsp[0] == fieldTypeHeaderNull {
+		if rsp[pos] == fieldTypeHeaderNull {
 			s.datas = append(s.datas, nil)
 			pos++
 			continue
@@ -182,7 +197,61 @@ func (s *ResultSet) readRowText() error {
 	return nil
 }
 
+// https://dev.mysql.com/doc/internals/en/binary-protocol-resultset-row.html
 func (s *ResultSet) readRowBinary() error {
+	rsp, err := s.conn.ReadPacket()
+	if nil != err {
+		return errors.Trace(err)
+	}
+
+	// Got eof?
+	if rsp[0] == PacketHeaderEOF && len(rsp) == 5 {
+		var peof PacketEOF
+		if err = peof.Decode(rsp); nil != err {
+			return errors.Trace(err)
+		}
+		if peof.status&statusMoreResultsExists != 0 {
+			s.moreRows = true
+			if err = s.discardResults(); nil != err {
+				return errors.Trace(err)
+			}
+		}
+		s.moreRows = false
+		s.conn = nil
+		return io.EOF
+	}
+	if rsp[0] == PacketHeaderERR {
+		s.moreRows = false
+		s.conn = nil
+		var perr PacketErr
+		if err := perr.Decode(rsp); nil != err {
+			return errors.Trace(err)
+		}
+		return errors.Trace(perr.toError())
+	}
+	if rsp[0] != PacketHeaderOK {
+		return ErrMalformPacket
+	}
+
+	// The null bitmap has an offset of 2 bits
+	bitmapLen := (s.columnCnt + 7 + 2) / 8
+	if len(rsp) < 1+bitmapLen {
+		return ErrMalformPacket
+	}
+	bitmap := rsp[1 : 1+bitmapLen]
+	r := serialize.NewBinReader(rsp[1+bitmapLen:])
+	s.datas = make([]interface{}, s.columnCnt)
+	for i := 0; i < s.columnCnt; i++ {
+		bit := i + 2
+		if bitmap[bit/8]&(1<<uint(bit%8)) != 0 {
+			continue
+		}
+		if s.datas[i], err = readBinaryValue(r, &s.columns[i], s.parseTime, s.conn.loc); nil != err {
+			return errors.Annotatef(err, "reading column %v", s.columns[i].fieldName)
+		}
+	}
+	r.End()
+
 	return nil
 }
 
@@ -297,98 +366,119 @@ func (c *Conn) readResultSet(data []byte, options *responseOptions) (*PacketOK,
 }
 
 func (c *Conn) readResultColumns(rs *ResultSet) error {
-	rs.columns = make([]Field, 0, rs.columnCnt)
+	columns, err := c.readColumnDefinitions(rs.columnCnt)
+	if nil != err {
+		return errors.Trace(err)
+	}
+	rs.columns = columns
+	return nil
+}
+
+// readColumnDefinitions reads the column definitions until the EOF packet
+func (c *Conn) readColumnDefinitions(cnt int) ([]Field, error) {
+	columns := make([]Field, 0, cnt)
 
 	for {
 		rsp, err := c.ReadPacket()
 		if nil != err {
-			return errors.Trace(err)
+			return nil, errors.Trace(err)
 		}
 
 		if rsp[0] == PacketHeaderEOF && len(rsp) == 5 {
 			// https://dev.mysql.com/doc/internals/en/packet-EOF_Packet.html
 			// We just support protocol 41, so the eof packet is always 5 bytes length
-			if len(rs.columns) == rs.columnCnt {
-				return nil
+			if len(columns) == cnt {
+				return columns, nil
 			}
-			return errors.Errorf("columns count %v, but receive %v columns", rs.columnCnt, len(rs.columns))
+			return nil, errors.Errorf("columns count %v, but receive %v columns", cnt, len(columns))
 		}
 
-		// Read columns
-		// https://dev.mysql.com/doc/internals/en/com-query-response.html#packet-ProtocolText::Resultset
-		// catalog [lenenc_str]
-		var column Field
-		var ls LenencString
-		var ptr int
-		offset := ls.FromData(rsp)
-		if ls.EOF {
-			return errors.New("eof when parsing category")
-		}
-		ptr += offset
-		// schema [lenenc_str]
-		offset = ls.FromData(rsp[ptr:])
-		if ls.EOF {
-			return errors.New("eof when parsing schema")
-		}
-		column.schemaName = ls.Value
-		ptr += offset
-		// table [lenenc_str]
-		offset = ls.FromData(rsp[ptr:])
-		if ls.EOF {
-			return errors.New("eof when parsing table")
-		}
-		column.tableName = ls.Value
-		ptr += offset
-		// org_table [lenenc_str]
-		offset = ls.FromData(rsp[ptr:])
-		if ls.EOF {
-			return errors.New("eof when parsing org_table")
-		}
-		ptr += offset
-		// name [lenenc_str]
-		offset = ls.FromData(rsp[ptr:])
-		if ls.EOF {
-			return errors.New("eof when parsing name")
-		}
-		column.fieldName = ls.Value
-		ptr += offset
-		// org_name [lenenc_str]
-		offset = ls.FromData(rsp[ptr:])
-		if ls.EOF {
-			return errors.New("eof when parsing org_name")
-		}
-		ptr += offset
-		// fixed-length fields, always 0x0c
-		var ln LenencInt
-		offset = ln.FromData(rsp[ptr:])
-		if ln.EOF {
-			return errors.New("eof when parsing length of fixed-length fields")
-		}
-		if 0x0c != ln.Value {
-			return errors.Errorf("invalid length of fixed-length fields %v", ln.Value)
+		column, err := decodeColumnDefinition(rsp)
+		if nil != err {
+			return nil, errors.Trace(err)
 		}
-		ptr += offset
-		// charset [int2]
-		column.characterSet = binary.LittleEndian.Uint16(rsp[ptr:])
-		ptr += 2
-		// column length
-		column.columnLength = binary.LittleEndian.Uint32(rsp[ptr:])
-		ptr += 4
-		// type
-		column.fieldType = rsp[ptr]
-		ptr++
-		// flags
-		column.flags = binary.LittleEndian.Uint16(rsp[ptr:])
-		ptr += 2
-		// decimals
-		column.demicals = rsp[ptr]
-		ptr++
-		// filler 0x00 0x00
-		// skip following data
-		// 2              filler [00] [00]
-		// if command was COM_FIELD_LIST {
-		// lenenc_int     length of default-values
-		// string[$len]   default values
-		rs.columns = append(rs.columns, column)
+		columns = append(columns, column)
+	}
+}
+
+// decodeColumnDefinition decodes the Protocol::ColumnDefinition41 packet
+// https://dev.mysql.com/doc/internals/en/com-query-response.html#packet-Protocol::ColumnDefinition41
+func decodeColumnDefinition(rsp []byte) (Field, error) {
+	// catalog [lenenc_str]
+	var column Field
+	var ls LenencString
+	var ptr int
+	offset := ls.FromData(rsp)
+	if ls.EOF {
+		return column, errors.New("eof when parsing category")
+	}
+	ptr += offset
+	// schema [lenenc_str]
+	offset = ls.FromData(rsp[ptr:])
+	if ls.EOF {
+		return column, errors.New("eof when parsing schema")
+	}
+	column.schemaName = ls.Value
+	ptr += offset
+	// table [lenenc_str]
+	offset = ls.FromData(rsp[ptr:])
+	if ls.EOF {
+		return column, errors.New("eof when parsing table")
+	}
+	column.tableName = ls.Value
+	ptr += offset
+	// org_table [lenenc_str]
+	offset = ls.FromData(rsp[ptr:])
+	if ls.EOF {
+		return column, errors.New("eof when parsing org_table")
+	}
+	ptr += offset
+	// name [lenenc_str]
+	offset = ls.FromData(rsp[ptr:])
+	if ls.EOF {
+		return column, errors.New("eof when parsing name")
+	}
+	column.fieldName = ls.Value
+	ptr += offset
+	// org_name [lenenc_str]
+	offset = ls.FromData(rsp[ptr:])
+	if ls.EOF {
+		return column, errors.New("eof when parsing org_name")
+	}
+	ptr += offset
+	// fixed-length fields, always 0x0c
+	var ln LenencInt
+	offset = ln.FromData(rsp[ptr:])
+	if ln.EOF {
+		return column, errors.New("eof when parsing length of fixed-length fields")
+	}
+	if 0x0c != ln.Value {
+		return column, errors.Errorf("invalid length of fixed-length fields %v", ln.Value)
+	}
+	ptr += offset
+	if len(rsp) < ptr+0x0c {
+		return column, errors.New("eof when parsing fixed-length fields")
 	}
+	// charset [int2]
+	column.characterSet = binary.LittleEndian.Uint16(rsp[ptr:])
+	ptr += 2
+	// column length
+	column.columnLength = binary.LittleEndian.Uint32(rsp[ptr:])
+	ptr += 4
+	// type
+	column.fieldType = rsp[ptr]
+	ptr++
+	// flags
+	column.flags = binary.LittleEndian.Uint16(rsp[ptr:])
+	ptr += 2
+	// decimals
+	column.demicals = rsp[ptr]
+	ptr++
+	// filler 0x00 0x00
+	// skip following data
+	// 2              filler [00] [00]
+	// if command was COM_FIELD_LIST {
+	// lenenc_int     length of default-values
+	// string[$len]   default values
+	return column, nil
 }
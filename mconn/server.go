@@ -0,0 +1,249 @@
+package mconn
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"net"
+
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+const (
+	defaultServerVersion = "5.7.30-binp"
+	// serverCapability is the capability flags supported by the server side
+	serverCapability = clientLongPassword | clientLongFlag | clientConnectWithDB |
+		clientProtocol41 | clientTransactions | clientSecureConnection | clientPluginAuth
+	// statusAutocommit is the status flags of the server responses
+	statusAutocommit = 0x0002
+)
+
+// Mysql error codes used by the server side
+const (
+	ErrCodeAccessDenied   = 1045
+	ErrCodeUnknownCommand = 1047
+	ErrCodeUnknownError   = 1105
+	ErrCodeMasterFatal    = 1236
+)
+
+// Commands of the server side, the first byte of the command packet
+const (
+	ComQuit           = 0x01
+	ComQuery          = comQuery
+	ComPing           = 0x0e
+	ComRegisterSlave  = comRegisterSlave
+	ComBinlogDump     = comBinlogDump
+	ComBinlogDumpGtid = comBinlogDumpGtid
+)
+
+// ServerConfig is the config of the server side connection
+type ServerConfig struct {
+	ServerVersion string
+	ConnectionID  uint32
+	// Username and Password are the account accepted by mysql_native_password,
+	// any user is accepted if Username is empty
+	Username string
+	Password string
+}
+
+// ServerConn is the server side of a mysql connection, it is used to implement
+// servers speaking the mysql protocol, like the fake master and the binlog server
+type ServerConn struct {
+	Conn
+	user string
+	db   string
+}
+
+// NewServerConn handshakes with the client on the connection
+func NewServerConn(conn net.Conn, cfg *ServerConfig) (*ServerConn, error) {
+	c := &ServerConn{}
+	c.conn = conn
+	c.r = bufio.NewReader(&c.Conn)
+	c.status = connStatusConnected
+	c.capability = serverCapability
+	c.resetSequence()
+
+	if err := c.handshake(cfg); nil != err {
+		c.Close()
+		return nil, errors.Trace(err)
+	}
+	return c, nil
+}
+
+// User returns the user name of the client
+func (c *ServerConn) User() string {
+	return c.user
+}
+
+// Database returns the database of the client specified by handshake
+func (c *ServerConn) Database() string {
+	return c.db
+}
+
+// RemoteAddr returns the address of the client
+func (c *ServerConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *ServerConn) handshake(cfg *ServerConfig) error {
+	seed := make([]byte, 20)
+	if _, err := rand.Read(seed); nil != err {
+		return errors.Trace(err)
+	}
+	// The seed must not contain '\0'
+	for i := range seed {
+		seed[i] = seed[i]%94 + 33
+	}
+
+	var ph PacketHandshake
+	ph.ProtocolVersion = 10
+	ph.ServerVersion = cfg.ServerVersion
+	if "" == ph.ServerVersion {
+		ph.ServerVersion = defaultServerVersion
+	}
+	ph.ConnectionID = cfg.ConnectionID
+	ph.AuthPluginDataPart = seed
+	ph.CapabilityFlags = serverCapability
+	ph.CharacterSet = CharsetUtf8GeneralCI
+	ph.StatusFlags = statusAutocommit
+	ph.AuthPluginName = MySQLNativePasswordPlugin
+	if err := c.WritePacket(ph.Encode()); nil != err {
+		return errors.Trace(err)
+	}
+
+	data, err := c.ReadPacket()
+	if nil != err {
+		return errors.Trace(err)
+	}
+	var rsp PacketHandshakeResponse
+	if err = rsp.Decode(data); nil != err {
+		return errors.Trace(err)
+	}
+	c.user = rsp.Username
+	c.db = rsp.Database
+
+	auth := rsp.AuthResponse
+	if 0 != (rsp.CapabilityFlags&clientPluginAuth) &&
+		"" != rsp.AuthPluginName && MySQLNativePasswordPlugin != rsp.AuthPluginName {
+		// Switch to the native password plugin
+		req := make([]byte, 4, 4+1+len(MySQLNativePasswordPlugin)+1+len(seed)+1)
+		req = append(req, authSwitchRequestHeader)
+		req = append(req, MySQLNativePasswordPlugin...)
+		req = append(req, 0)
+		req = append(req, seed...)
+		req = append(req, 0)
+		if err = c.WritePacket(req); nil != err {
+			return errors.Trace(err)
+		}
+		if auth, err = c.ReadPacket(); nil != err {
+			return errors.Trace(err)
+		}
+	}
+
+	if "" != cfg.Username {
+		if rsp.Username != cfg.Username ||
+			!bytes.Equal(auth, scrambleNativePassword(seed, cfg.Password)) {
+			msg := fmt.Sprintf("Access denied for user '%s'", rsp.Username)
+			c.WriteError(ErrCodeAccessDenied, "28000", msg)
+			return errors.New(msg)
+		}
+	}
+
+	return errors.Trace(c.WriteOK(0, 0))
+}
+
+// ReadCommand reads the next command packet of the client, the first byte is the command
+func (c *ServerConn) ReadCommand() ([]byte, error) {
+	c.resetSequence()
+	data, err := c.ReadPacket()
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	return data, nil
+}
+
+// WriteOK writes the ok packet
+func (c *ServerConn) WriteOK(affectedRows uint64, lastInsertID uint64) error {
+	pok := PacketOK{
+		AffectedRows: affectedRows,
+		LastInsertID: lastInsertID,
+		StatusFlags:  statusAutocommit,
+	}
+	return errors.Trace(c.WritePacket(pok.Encode()))
+}
+
+// WriteError writes the err packet, state is the sql state with 5 characters
+func (c *ServerConn) WriteError(code uint16, state string, msg string) error {
+	perr := PacketErr{
+		ErrorCode:    code,
+		State:        state,
+		ErrorMessage: msg,
+	}
+	return errors.Trace(c.WritePacket(perr.Encode()))
+}
+
+// WriteEOF writes the eof packet
+func (c *ServerConn) WriteEOF() error {
+	peof := PacketEOF{status: statusAutocommit}
+	return errors.Trace(c.WritePacket(peof.Encode()))
+}
+
+// WriteResultSet writes the text result set, all columns are strings and nil values are NULL
+// https://dev.mysql.com/doc/internals/en/com-query-response.html
+func (c *ServerConn) WriteResultSet(columns []string, rows [][]interface{}) error {
+	w := serialize.NewBinWriter(nil)
+	w.WriteUint32(0)
+	w.WriteLenencInt(uint64(len(columns)))
+	if err := c.WritePacket(w.Bytes()); nil != err {
+		return errors.Trace(err)
+	}
+
+	for _, name := range columns {
+		if err := c.WritePacket(encodeColumnDefinition(name)); nil != err {
+			return errors.Trace(err)
+		}
+	}
+	if err := c.WriteEOF(); nil != err {
+		return errors.Trace(err)
+	}
+
+	for _, row := range rows {
+		w = serialize.NewBinWriter(nil)
+		w.WriteUint32(0)
+		for _, v := range row {
+			if nil == v {
+				w.WriteUint8(fieldTypeHeaderNull)
+				continue
+			}
+			w.WriteLenencString(fmt.Sprint(v))
+		}
+		if err := c.WritePacket(w.Bytes()); nil != err {
+			return errors.Trace(err)
+		}
+	}
+
+	return errors.Trace(c.WriteEOF())
+}
+
+// encodeColumnDefinition encodes the Protocol::ColumnDefinition41 of a varchar column
+func encodeColumnDefinition(name string) []byte {
+	w := serialize.NewBinWriter(nil)
+	// Skip the payload length, auto fill by WritePacket
+	w.WriteUint32(0)
+	// catalog, schema, table, org_table, name, org_name
+	for _, v := range []string{"def", "", "", "", name, name} {
+		w.WriteLenencString(v)
+	}
+	// length of fixed-length fields
+	w.WriteLenencInt(0x0c)
+	w.WriteUint16(CharsetUtf8GeneralCI)
+	w.WriteUint32(1024)
+	w.WriteUint8(FieldTypeVarString)
+	// flags, decimals and filler
+	w.WriteUint16(0)
+	w.WriteUint8(0)
+	w.WriteUint16(0)
+	return w.Bytes()
+}
@@ -0,0 +1,526 @@
+package mconn
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+const (
+	// fieldFlagUnsigned is the unsigned flag of column definition
+	fieldFlagUnsigned = 0x20
+	// paramFlagUnsigned is the unsigned flag of the parameter type
+	paramFlagUnsigned = 0x80
+	// cursorTypeNoCursor executes the statement without cursor
+	cursorTypeNoCursor = 0x00
+)
+
+// Stmt is a prepared statement on the connection
+type Stmt struct {
+	conn     *Conn
+	id       uint32
+	paramCnt int
+	params   []Field
+	columns  []Field
+}
+
+// Prepare creates a prepared statement
+// https://dev.mysql.com/doc/internals/en/com-stmt-prepare.html
+func (c *Conn) Prepare(query string) (*Stmt, error) {
+	data := make([]byte, 4, 4+1+len(query))
+	data = append(data, comStmtPrepare)
+	data = append(data, query...)
+	c.resetSequence()
+	if err := c.WritePacket(data); nil != err {
+		return nil, errors.Trace(err)
+	}
+
+	rsp, err := c.ReadPacket()
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	if rsp[0] == PacketHeaderERR {
+		perr, err := c.readPacketERR(rsp)
+		if nil != err {
+			return nil, errors.Trace(err)
+		}
+		return nil, errors.Trace(perr.toError())
+	}
+
+	var pok PacketStmtPrepareOK
+	if err = pok.Decode(rsp); nil != err {
+		return nil, errors.Trace(err)
+	}
+	stmt := &Stmt{
+		conn:     c,
+		id:       pok.StatementID,
+		paramCnt: int(pok.ParamCount),
+	}
+	if pok.ParamCount > 0 {
+		if stmt.params, err = c.readColumnDefinitions(int(pok.ParamCount)); nil != err {
+			return nil, errors.Trace(err)
+		}
+	}
+	if pok.ColumnCount > 0 {
+		if stmt.columns, err = c.readColumnDefinitions(int(pok.ColumnCount)); nil != err {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	return stmt, nil
+}
+
+// ParamCount returns the count of the statement parameters
+func (s *Stmt) ParamCount() int {
+	return s.paramCnt
+}
+
+// Exec executes the statement with args, the result set must be closed before
+// the next command
+// https://dev.mysql.com/doc/internals/en/com-stmt-execute.html
+func (s *Stmt) Exec(args ...interface{}) (*PacketOK, error) {
+	if len(args) != s.paramCnt {
+		return nil, errors.Errorf("statement needs %d args, but got %d", s.paramCnt, len(args))
+	}
+
+	data, err := s.encodeExecute(args)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	s.conn.resetSequence()
+	if err = s.conn.WritePacket(data); nil != err {
+		return nil, errors.Trace(err)
+	}
+
+	return s.conn.readResponse(&responseOptions{binary: true})
+}
+
+// Close deallocates the statement, server sends no response
+// https://dev.mysql.com/doc/internals/en/com-stmt-close.html
+func (s *Stmt) Close() error {
+	if nil == s.conn {
+		return ErrInvalidConn
+	}
+	data := make([]byte, 4, 4+1+4)
+	data = append(data, comStmtClose,
+		byte(s.id), byte(s.id>>8), byte(s.id>>16), byte(s.id>>24))
+	s.conn.resetSequence()
+	err := s.conn.WritePacket(data)
+	s.conn = nil
+	return errors.Trace(err)
+}
+
+func (s *Stmt) encodeExecute(args []interface{}) ([]byte, error) {
+	var err error
+	w := serialize.NewBinWriter(nil)
+
+	// Skip the payload length, auto fill by WritePacket
+	if err = w.WriteUint32(0); nil != err {
+		return nil, errors.Trace(err)
+	}
+	if err = w.WriteUint8(comStmtExecute); nil != err {
+		return nil, errors.Trace(err)
+	}
+	if err = w.WriteUint32(s.id); nil != err {
+		return nil, errors.Trace(err)
+	}
+	if err = w.WriteUint8(cursorTypeNoCursor); nil != err {
+		return nil, errors.Trace(err)
+	}
+	// Iteration count, always 1
+	if err = w.WriteUint32(1); nil != err {
+		return nil, errors.Trace(err)
+	}
+	if 0 == len(args) {
+		return w.Bytes(), nil
+	}
+
+	nullBitmap := make([]byte, (len(args)+7)/8)
+	types := make([]byte, 0, len(args)*2)
+	values := serialize.NewBinWriter(nil)
+	for i, arg := range args {
+		tp, flag, err := writeBinaryParam(values, arg)
+		if nil != err {
+			return nil, errors.Annotatef(err, "encoding arg %d", i)
+		}
+		if FieldTypeNull == tp {
+			nullBitmap[i/8] |= 1 << uint(i%8)
+		}
+		types = append(types, tp, flag)
+	}
+	if err = w.WriteBytes(nullBitmap); nil != err {
+		return nil, errors.Trace(err)
+	}
+	// New params bound flag, always send the types
+	if err = w.WriteUint8(1); nil != err {
+		return nil, errors.Trace(err)
+	}
+	if err = w.WriteBytes(types); nil != err {
+		return nil, errors.Trace(err)
+	}
+	if err = w.WriteBytes(values.Bytes()); nil != err {
+		return nil, errors.Trace(err)
+	}
+
+	return w.Bytes(), nil
+}
+
+// writeBinaryParam writes the binary value of the arg, returns the field type and flag
+// https://dev.mysql.com/doc/internals/en/binary-protocol-value.html
+func writeBinaryParam(w *serialize.BinWriter, arg interface{}) (byte, byte, error) {
+	var err error
+	tp := byte(FieldTypeNull)
+	flag := byte(0)
+
+	switch v := arg.(type) {
+	case nil:
+		{
+			return tp, flag, nil
+		}
+	case bool:
+		{
+			tp = FieldTypeTiny
+			var b uint8
+			if v {
+				b = 1
+			}
+			err = w.WriteUint8(b)
+		}
+	case int:
+		{
+			tp = FieldTypeLongLong
+			err = w.WriteInt64(int64(v))
+		}
+	case int8:
+		{
+			tp = FieldTypeTiny
+			err = w.WriteInt8(v)
+		}
+	case int16:
+		{
+			tp = FieldTypeShort
+			err = w.WriteInt16(v)
+		}
+	case int32:
+		{
+			tp = FieldTypeLong
+			err = w.WriteInt32(v)
+		}
+	case int64:
+		{
+			tp = FieldTypeLongLong
+			err = w.WriteInt64(v)
+		}
+	case uint:
+		{
+			tp, flag = FieldTypeLongLong, paramFlagUnsigned
+			err = w.WriteUint64(uint64(v))
+		}
+	case uint8:
+		{
+			tp, flag = FieldTypeTiny, paramFlagUnsigned
+			err = w.WriteUint8(v)
+		}
+	case uint16:
+		{
+			tp, flag = FieldTypeShort, paramFlagUnsigned
+			err = w.WriteUint16(v)
+		}
+	case uint32:
+		{
+			tp, flag = FieldTypeLong, paramFlagUnsigned
+			err = w.WriteUint32(v)
+		}
+	case uint64:
+		{
+			tp, flag = FieldTypeLongLong, paramFlagUnsigned
+			err = w.WriteUint64(v)
+		}
+	case float32:
+		{
+			tp = FieldTypeFloat
+			err = w.WriteUint32(math.Float32bits(v))
+		}
+	case float64:
+		{
+			tp = FieldTypeDouble
+			err = w.WriteUint64(math.Float64bits(v))
+		}
+	case string:
+		{
+			tp = FieldTypeString
+			err = w.WriteLenencString(v)
+		}
+	case []byte:
+		{
+			if nil == v {
+				return tp, flag, nil
+			}
+			tp = FieldTypeBlob
+			err = w.WriteLenencBytes(v)
+		}
+	case json.RawMessage:
+		{
+			tp = FieldTypeString
+			err = w.WriteLenencBytes(v)
+		}
+	case time.Time:
+		{
+			tp = FieldTypeDateTime
+			err = writeBinaryDateTime(w, v)
+		}
+	case time.Duration:
+		{
+			tp = FieldTypeTime
+			err = writeBinaryTime(w, v)
+		}
+	case driver.Valuer:
+		{
+			dv, verr := v.Value()
+			if nil != verr {
+				return tp, flag, errors.Trace(verr)
+			}
+			return writeBinaryParam(w, dv)
+		}
+	default:
+		{
+			return tp, flag, errors.Errorf("unsupported arg type %T", arg)
+		}
+	}
+
+	if nil != err {
+		return tp, flag, errors.Trace(err)
+	}
+	return tp, flag, nil
+}
+
+func writeBinaryDateTime(w *serialize.BinWriter, t time.Time) error {
+	var data []byte
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+	micro := t.Nanosecond() / 1000
+
+	switch {
+	case t.IsZero():
+		{
+			data = []byte{0}
+		}
+	case 0 != micro:
+		{
+			data = []byte{11, byte(year), byte(year >> 8), byte(month), byte(day),
+				byte(hour), byte(min), byte(sec),
+				byte(micro), byte(micro >> 8), byte(micro >> 16), byte(micro >> 24)}
+		}
+	case 0 != hour || 0 != min || 0 != sec:
+		{
+			data = []byte{7, byte(year), byte(year >> 8), byte(month), byte(day),
+				byte(hour), byte(min), byte(sec)}
+		}
+	default:
+		{
+			data = []byte{4, byte(year), byte(year >> 8), byte(month), byte(day)}
+		}
+	}
+	return errors.Trace(w.WriteBytes(data))
+}
+
+func writeBinaryTime(w *serialize.BinWriter, d time.Duration) error {
+	if 0 == d {
+		return errors.Trace(w.WriteUint8(0))
+	}
+
+	var neg byte
+	if d < 0 {
+		neg = 1
+		d = -d
+	}
+	days := uint32(d / (24 * time.Hour))
+	d -= time.Duration(days) * 24 * time.Hour
+	hour := byte(d / time.Hour)
+	d -= time.Duration(hour) * time.Hour
+	min := byte(d / time.Minute)
+	d -= time.Duration(min) * time.Minute
+	sec := byte(d / time.Second)
+	d -= time.Duration(sec) * time.Second
+	micro := uint32(d / time.Microsecond)
+
+	data := []byte{8, neg, byte(days), byte(days >> 8), byte(days >> 16), byte(days >> 24),
+		hour, min, sec}
+	if 0 != micro {
+		data[0] = 12
+		data = append(data, byte(micro), byte(micro>>8), byte(micro>>16), byte(micro>>24))
+	}
+	return errors.Trace(w.WriteBytes(data))
+}
+
+// readBinaryValue reads the binary value of the column
+// https://dev.mysql.com/doc/internals/en/binary-protocol-value.html
+func readBinaryValue(r *serialize.BinReader, f *Field, parseTime bool, loc *time.Location) (interface{}, error) {
+	unsigned := 0 != (f.flags & fieldFlagUnsigned)
+
+	switch f.fieldType {
+	case FieldTypeNull:
+		{
+			return nil, nil
+		}
+	case FieldTypeTiny:
+		{
+			v, err := r.ReadUint8()
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			if unsigned {
+				return uint64(v), nil
+			}
+			return int64(int8(v)), nil
+		}
+	case FieldTypeShort, FieldTypeYear:
+		{
+			v, err := r.ReadUint16()
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			if unsigned {
+				return uint64(v), nil
+			}
+			return int64(int16(v)), nil
+		}
+	case FieldTypeInt24, FieldTypeLong:
+		{
+			v, err := r.ReadUint32()
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			if unsigned {
+				return uint64(v), nil
+			}
+			return int64(int32(v)), nil
+		}
+	case FieldTypeLongLong:
+		{
+			v, err := r.ReadUint64()
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			if unsigned {
+				return v, nil
+			}
+			return int64(v), nil
+		}
+	case FieldTypeFloat:
+		{
+			v, err := r.ReadUint32()
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			return math.Float32frombits(v), nil
+		}
+	case FieldTypeDouble:
+		{
+			v, err := r.ReadUint64()
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			return math.Float64frombits(v), nil
+		}
+	case FieldTypeDate, FieldTypeNewDate, FieldTypeDateTime, FieldTypeTimestamp:
+		{
+			return readBinaryDateTime(r, f.fieldType, parseTime, loc)
+		}
+	case FieldTypeTime:
+		{
+			return readBinaryTime(r)
+		}
+	case FieldTypeDecimal, FieldTypeNewDecimal, FieldTypeVarChar, FieldTypeBit,
+		FieldTypeEnum, FieldTypeSet, FieldTypeTinyBlob, FieldTypeMediumBlob,
+		FieldTypeLongBlob, FieldTypeBlob, FieldTypeVarString, FieldTypeString,
+		FieldTypeGeometry, FieldTypeJSON:
+		{
+			v, err := r.ReadLenencString()
+			if nil != err {
+				return nil, errors.Trace(err)
+			}
+			return v, nil
+		}
+	}
+
+	return nil, errors.Errorf("unsupported field type %d", f.fieldType)
+}
+
+func readBinaryDateTime(r *serialize.BinReader, tp byte, parseTime bool, loc *time.Location) (interface{}, error) {
+	l, err := r.ReadUint8()
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	data, err := r.ReadBytes(int(l))
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+
+	var year, month, day, hour, min, sec, micro int
+	if l >= 4 {
+		year = int(data[0]) | int(data[1])<<8
+		month = int(data[2])
+		day = int(data[3])
+	}
+	if l >= 7 {
+		hour, min, sec = int(data[4]), int(data[5]), int(data[6])
+	}
+	if l >= 11 {
+		micro = int(data[7]) | int(data[8])<<8 | int(data[9])<<16 | int(data[10])<<24
+	}
+
+	if parseTime {
+		if 0 == l {
+			return time.Time{}, nil
+		}
+		if nil == loc {
+			loc = time.UTC
+		}
+		return time.Date(year, time.Month(month), day, hour, min, sec, micro*1000, loc), nil
+	}
+
+	str := fmt.Sprintf("%04d-%02d-%02d", year, month, day)
+	if tp == FieldTypeDate || tp == FieldTypeNewDate {
+		return str, nil
+	}
+	str += fmt.Sprintf(" %02d:%02d:%02d", hour, min, sec)
+	if l >= 11 {
+		str += fmt.Sprintf(".%06d", micro)
+	}
+	return str, nil
+}
+
+func readBinaryTime(r *serialize.BinReader) (interface{}, error) {
+	l, err := r.ReadUint8()
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	data, err := r.ReadBytes(int(l))
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	if 0 == l {
+		return "00:00:00", nil
+	}
+	if l < 8 {
+		return nil, ErrMalformPacket
+	}
+
+	sign := ""
+	if 1 == data[0] {
+		sign = "-"
+	}
+	days := int(data[1]) | int(data[2])<<8 | int(data[3])<<16 | int(data[4])<<24
+	str := fmt.Sprintf("%s%02d:%02d:%02d", sign, days*24+int(data[5]), data[6], data[7])
+	if l >= 12 {
+		micro := int(data[8]) | int(data[9])<<8 | int(data[10])<<16 | int(data[11])<<24
+		str += fmt.Sprintf(".%06d", micro)
+	}
+	return str, nil
+}
@@ -0,0 +1,113 @@
+package mconn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+)
+
+func testColumnDefinition(name string, tp byte, flags uint16) []byte {
+	var buf bytes.Buffer
+	for _, s := range []string{"def", "test", "t", "t", name, name} {
+		buf.WriteByte(byte(len(s)))
+		buf.WriteString(s)
+	}
+	buf.WriteByte(0x0c)
+	binary.Write(&buf, binary.LittleEndian, uint16(CharsetUtf8GeneralCI))
+	binary.Write(&buf, binary.LittleEndian, uint32(11))
+	buf.WriteByte(tp)
+	binary.Write(&buf, binary.LittleEndian, flags)
+	buf.Write([]byte{0, 0, 0})
+	return buf.Bytes()
+}
+
+func TestStmtExec(t *testing.T) {
+	eof := []byte{PacketHeaderEOF, 0, 0, 2, 0}
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+
+	s := newScriptedServer(t, func(s *scriptedServer) error {
+		if err := s.writeHandshake(MySQLNativePasswordPlugin); nil != err {
+			return err
+		}
+		if _, _, err := s.readHandshakeResponse(); nil != err {
+			return err
+		}
+		if err := s.writeOK(); nil != err {
+			return err
+		}
+
+		query := "SELECT id, name, ts FROM t WHERE id > ? AND name = ? AND ts = ?"
+		if err := s.expect(append([]byte{comStmtPrepare}, query...)); nil != err {
+			return err
+		}
+		s.writePacket([]byte{PacketHeaderOK, 1, 0, 0, 0, 3, 0, 3, 0, 0, 0, 0})
+		for i := 0; i < 3; i++ {
+			s.writePacket(testColumnDefinition("?", FieldTypeVarString, 0))
+		}
+		s.writePacket(eof)
+		s.writePacket(testColumnDefinition("id", FieldTypeLongLong, fieldFlagUnsigned))
+		s.writePacket(testColumnDefinition("name", FieldTypeVarString, 0))
+		s.writePacket(testColumnDefinition("ts", FieldTypeDateTime, 0))
+		s.writePacket(eof)
+
+		// Execute with args (uint64(10), "a", ts)
+		expect := []byte{comStmtExecute, 1, 0, 0, 0, 0, 1, 0, 0, 0,
+			0, 1, FieldTypeLongLong, paramFlagUnsigned, FieldTypeString, 0, FieldTypeDateTime, 0,
+			10, 0, 0, 0, 0, 0, 0, 0, 1, 'a',
+			11, 0xe4, 0x07, 1, 2, 3, 4, 5, 6, 0, 0, 0}
+		if err := s.expect(expect); nil != err {
+			return err
+		}
+		s.writePacket([]byte{3})
+		s.writePacket(testColumnDefinition("id", FieldTypeLongLong, fieldFlagUnsigned))
+		s.writePacket(testColumnDefinition("name", FieldTypeVarString, 0))
+		s.writePacket(testColumnDefinition("ts", FieldTypeDateTime, 0))
+		s.writePacket(eof)
+		// name is null
+		s.writePacket([]byte{PacketHeaderOK, 0x08, 11, 0, 0, 0, 0, 0, 0, 0,
+			7, 0xe4, 0x07, 1, 2, 3, 4, 5})
+		s.writePacket(eof)
+
+		return s.expect([]byte{comStmtClose, 1, 0, 0, 0})
+	})
+
+	var c Conn
+	if err := c.Connect(s.dataSource("secret"), ""); nil != err {
+		t.Fatal(err)
+	}
+	pok, err := c.Exec("SELECT id, name, ts FROM t WHERE id > ? AND name = ? AND ts = ?",
+		uint64(10), "a", ts)
+	if nil != err {
+		t.Fatal(err)
+	}
+	rs := pok.Results
+	if nil == rs {
+		t.Fatal("result set expected")
+	}
+	if err = rs.Next(); nil != err {
+		t.Fatal(err)
+	}
+	expect := []interface{}{uint64(11), nil, "2020-01-02 03:04:05"}
+	for i, v := range expect {
+		got, err := rs.GetAt(i)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if got != v {
+			t.Errorf("column %d expect %v, but got %v", i, v, got)
+		}
+	}
+	if err = rs.Next(); io.EOF != err {
+		t.Errorf("expect eof, but got %v", err)
+	}
+	if err = rs.Close(); nil != err {
+		t.Error(err)
+	}
+	c.Close()
+
+	if err = s.wait(); nil != err {
+		t.Fatalf("server error: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package mconn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// SSL modes, the same as the --ssl-mode option of mysql client
+const (
+	// SSLModeDisabled uses the plaintext connection
+	SSLModeDisabled = "disabled"
+	// SSLModePreferred uses tls if the server supports it, otherwise uses the plaintext connection
+	SSLModePreferred = "preferred"
+	// SSLModeRequired requires tls but does not verify the server certificate
+	SSLModeRequired = "required"
+	// SSLModeVerifyCA requires tls and verifies the server certificate against the CA
+	SSLModeVerifyCA = "verify-ca"
+	// SSLModeVerifyIdentity likes SSLModeVerifyCA and also verifies the server host name
+	SSLModeVerifyIdentity = "verify-identity"
+)
+
+// SSLOptions is the tls options of a mysql connection
+type SSLOptions struct {
+	// SSLMode is one of the SSLMode*, tls is disabled if empty
+	SSLMode string `json:"ssl-mode" toml:"ssl-mode"`
+	// SSLCA is the PEM file of the CA certificates
+	SSLCA string `json:"ssl-ca" toml:"ssl-ca"`
+	// SSLCert and SSLKey are the PEM files of the client certificate
+	SSLCert string `json:"ssl-cert" toml:"ssl-cert"`
+	SSLKey  string `json:"ssl-key" toml:"ssl-key"`
+	// SSLServerName is the host name used to verify the server certificate,
+	// the connected host is used if empty
+	SSLServerName string `json:"ssl-server-name" toml:"ssl-server-name"`
+}
+
+// Mode returns the normalized ssl mode
+func (o *SSLOptions) Mode() string {
+	mode := strings.ToLower(o.SSLMode)
+	if "" == mode {
+		return SSLModeDisabled
+	}
+	// Like mysql client, required mode verifies the CA if it is specified
+	if SSLModeRequired == mode && "" != o.SSLCA {
+		return SSLModeVerifyCA
+	}
+	return mode
+}
+
+// TLSConfig creates the tls config connecting to the host, returns nil if tls is disabled
+func (o *SSLOptions) TLSConfig(host string) (*tls.Config, error) {
+	mode := o.Mode()
+	switch mode {
+	case SSLModeDisabled:
+		{
+			return nil, nil
+		}
+	case SSLModePreferred, SSLModeRequired, SSLModeVerifyCA, SSLModeVerifyIdentity:
+		{
+
+		}
+	default:
+		{
+			return nil, errors.Errorf("unknown ssl mode %s", o.SSLMode)
+		}
+	}
+
+	cfg := &tls.Config{}
+	if "" != o.SSLCert || "" != o.SSLKey {
+		cert, err := tls.LoadX509KeyPair(o.SSLCert, o.SSLKey)
+		if nil != err {
+			return nil, errors.Annotate(err, "load client certificate")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if "" != o.SSLCA {
+		data, err := ioutil.ReadFile(o.SSLCA)
+		if nil != err {
+			return nil, errors.Annotate(err, "load ca")
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(data) {
+			return nil, errors.Errorf("no valid certificate in ca %s", o.SSLCA)
+		}
+	}
+
+	switch mode {
+	case SSLModePreferred, SSLModeRequired:
+		{
+			cfg.InsecureSkipVerify = true
+		}
+	case SSLModeVerifyCA:
+		{
+			// Verify the certificate chain without the host name
+			cfg.InsecureSkipVerify = true
+			roots := cfg.RootCAs
+			cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+				return verifyCertificateChain(rawCerts, roots)
+			}
+		}
+	case SSLModeVerifyIdentity:
+		{
+			cfg.ServerName = o.SSLServerName
+			if "" == cfg.ServerName {
+				cfg.ServerName = host
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+func verifyCertificateChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return errors.New("server has no certificate")
+	}
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if nil != err {
+			return errors.Trace(err)
+		}
+		certs = append(certs, cert)
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(opts); nil != err {
+		return errors.Trace(err)
+	}
+	return nil
+}
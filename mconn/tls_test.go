@@ -0,0 +1,84 @@
+package mconn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if nil != err {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mysql"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestTLSUpgrade(t *testing.T) {
+	cert := newTestCertificate(t)
+	ssl := SSLOptions{SSLMode: SSLModeRequired}
+	err := testConnectWithSSL(t, "secret", ssl, func(s *scriptedServer) error {
+		if err := s.writeHandshake(Sha256PasswordPlugin); nil != err {
+			return err
+		}
+		data, err := s.readPacket()
+		if nil != err {
+			return err
+		}
+		if len(data) != 32 || 0 == (data[1]&(clientSSL>>8)) {
+			return fmt.Errorf("expect ssl request, but got %v", data)
+		}
+		tlsConn := tls.Server(s.conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+		if err = tlsConn.Handshake(); nil != err {
+			return err
+		}
+		s.conn = tlsConn
+		// Password is sent in clear text over tls
+		plugin, auth, err := s.readHandshakeResponse()
+		if nil != err {
+			return err
+		}
+		if plugin != Sha256PasswordPlugin || string(auth) != "secret\x00" {
+			return fmt.Errorf("unexpected auth response %s %v", plugin, auth)
+		}
+		return s.writeOK()
+	})
+	if nil != err {
+		t.Error(err)
+	}
+}
+
+func TestSSLOptions(t *testing.T) {
+	if cfg, err := (&SSLOptions{}).TLSConfig("localhost"); nil != err || nil != cfg {
+		t.Errorf("tls should be disabled by default")
+	}
+	if _, err := (&SSLOptions{SSLMode: "unknown"}).TLSConfig("localhost"); nil == err {
+		t.Errorf("unknown ssl mode should fail")
+	}
+	cfg, err := (&SSLOptions{SSLMode: SSLModeVerifyIdentity}).TLSConfig("db.local")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if cfg.InsecureSkipVerify || cfg.ServerName != "db.local" {
+		t.Errorf("verify-identity should verify the host name")
+	}
+}
@@ -238,7 +238,7 @@ func (r *BinReader) ReadLenencInt() (uint64, error) {
 	case flag == 0xfe:
 		{
 			// We need read the next 8 bytes
-			num, err = r.next(3)
+			num, err = r.next(8)
 			if nil != err {
 				return 0, errors.Trace(err)
 			}
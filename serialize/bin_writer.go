@@ -163,6 +163,63 @@ func (w *BinWriter) WriteLenBytes(data []byte) error {
 	return nil
 }
 
+// WriteLenencInt writes the length encoded integer
+// https://dev.mysql.com/doc/internals/en/integer.html#length-encoded-integer
+func (w *BinWriter) WriteLenencInt(v uint64) error {
+	var err error
+
+	switch {
+	case v < 0xfb:
+		{
+			err = w.WriteUint8(uint8(v))
+		}
+	case v < 1<<16:
+		{
+			if err = w.WriteUint8(0xfc); nil == err {
+				err = w.WriteUint16(uint16(v))
+			}
+		}
+	case v < 1<<24:
+		{
+			if err = w.WriteUint8(0xfd); nil == err {
+				err = w.WriteBytes([]byte{byte(v), byte(v >> 8), byte(v >> 16)})
+			}
+		}
+	default:
+		{
+			if err = w.WriteUint8(0xfe); nil == err {
+				err = w.WriteUint64(v)
+			}
+		}
+	}
+	if nil != err {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// WriteLenencBytes writes byte slice with length encoded integer as prefix
+func (w *BinWriter) WriteLenencBytes(data []byte) error {
+	if err := w.WriteLenencInt(uint64(len(data))); nil != err {
+		return errors.Trace(err)
+	}
+	if err := w.WriteBytes(data); nil != err {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// WriteLenencString writes a string with length encoded integer as prefix
+func (w *BinWriter) WriteLenencString(s string) error {
+	if err := w.WriteLenencInt(uint64(len(s))); nil != err {
+		return errors.Trace(err)
+	}
+	if err := w.WriteEOFString(s); nil != err {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
 // WriteBytes write bytes to the buffer
 func (w *BinWriter) WriteBytes(data []byte) error {
 	_, err := w.buf.Write(data)
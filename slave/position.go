@@ -1 +1,109 @@
 package slave
+
+import (
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/binlog"
+	"github.com/sryanyuan/binp/mconn"
+)
+
+// PointTracker tracks the replication point of a binlog stream. A gtid is
+// merged into the executed set only after its transaction is committed, so
+// the tracked point can always be used to resume the replication
+type PointTracker struct {
+	point       mconn.ReplicationPoint
+	gset        mconn.GTIDSet
+	pendingGTID string
+	txn         txnTracker
+}
+
+// NewPointTracker creates a tracker starts at the point, if the gtid flavor
+// is not empty, the point's gtid must be a valid gtid set of the flavor
+func NewPointTracker(point mconn.ReplicationPoint, flavor string) (*PointTracker, error) {
+	t := &PointTracker{point: point}
+	if "" != flavor {
+		gset, err := mconn.ParseGTIDSet(flavor, point.Gtid)
+		if nil != err {
+			return nil, errors.Trace(err)
+		}
+		t.gset = gset
+		t.point.Gtid = gset.String()
+	}
+	return t, nil
+}
+
+// Point returns the current replication point
+func (t *PointTracker) Point() mconn.ReplicationPoint {
+	return t.point
+}
+
+// GTIDSet returns a copy of the executed gtid set, returns nil if gtid is not enabled
+func (t *PointTracker) GTIDSet() mconn.GTIDSet {
+	if nil == t.gset {
+		return nil
+	}
+	return t.gset.Clone()
+}
+
+// OnEvent updates the replication point with the binlog event
+func (t *PointTracker) OnEvent(event *binlog.Event) error {
+	if event.Header.LogPos > 0 {
+		t.point.Offset = event.Header.LogPos
+	}
+
+	switch event.Header.EventType {
+	case binlog.RotateEventType:
+		{
+			evt := event.Payload.Rotate
+			t.point.Filename = evt.NextName
+			t.point.Offset = uint32(evt.Position)
+		}
+	case binlog.GTIDEventType:
+		{
+			t.pendingGTID = event.Payload.GTID.String()
+		}
+	case binlog.MariadbGTIDEventType:
+		{
+			t.pendingGTID = event.Payload.MariadbGTID.String()
+		}
+	}
+
+	// The prepared XA transaction is committed to the gtid set like mysql
+	if t.txn.onEvent(event) {
+		return t.commitGTID()
+	}
+	return nil
+}
+
+// openGTID returns the gtid of the event group not ended yet, it's empty if gtid is not enabled
+func (t *PointTracker) openGTID() string {
+	if nil == t.gset {
+		return ""
+	}
+	return t.pendingGTID
+}
+
+// resume moves to the master point after the transactions of the gtids
+func (t *PointTracker) resume(point mconn.ReplicationPoint, gtids []string) error {
+	t.point.Filename = point.Filename
+	t.point.Offset = point.Offset
+	for _, gtid := range gtids {
+		t.pendingGTID = gtid
+		if err := t.commitGTID(); nil != err {
+			return errors.Trace(err)
+		}
+	}
+	t.pendingGTID = ""
+	return nil
+}
+
+func (t *PointTracker) commitGTID() error {
+	if nil == t.gset || "" == t.pendingGTID {
+		return nil
+	}
+	if err := t.gset.Update(t.pendingGTID); nil != err {
+		return errors.Trace(err)
+	}
+	t.pendingGTID = ""
+	t.point.Gtid = t.gset.String()
+	return nil
+}
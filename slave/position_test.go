@@ -0,0 +1,134 @@
+package slave
+
+import (
+	"testing"
+
+	"github.com/sryanyuan/binp/binlog"
+	"github.com/sryanyuan/binp/mconn"
+)
+
+const testSID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+func gtidEvent(gno int64) *binlog.Event {
+	e := &binlog.Event{Header: binlog.EventHeader{EventType: binlog.GTIDEventType}}
+	e.Payload.GTID = &binlog.GTIDEvent{
+		SID: []byte{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62},
+		GNO: gno,
+	}
+	return e
+}
+
+func mariadbGTIDEvent(seq uint64, flags uint8) *binlog.Event {
+	e := &binlog.Event{Header: binlog.EventHeader{EventType: binlog.MariadbGTIDEventType}}
+	e.Payload.MariadbGTID = &binlog.MariadbGTIDEvent{ServerID: 1, SequenceNumber: seq, Flags: flags}
+	return e
+}
+
+func queryEvent(query string) *binlog.Event {
+	e := &binlog.Event{Header: binlog.EventHeader{EventType: binlog.QueryEventType}}
+	e.Payload.Query = &binlog.QueryEvent{Query: query}
+	return e
+}
+
+func typedEvent(tp uint8) *binlog.Event {
+	return &binlog.Event{Header: binlog.EventHeader{EventType: tp}}
+}
+
+func TestPointTrackerTransactions(t *testing.T) {
+	cases := []struct {
+		name   string
+		flavor string
+		events []*binlog.Event
+		// gtids is the executed set after each event
+		gtids []string
+	}{
+		{
+			name:   "xa",
+			flavor: mconn.MySQLFlavor,
+			events: []*binlog.Event{
+				gtidEvent(1),
+				queryEvent("XA START X'31',X'',1"),
+				typedEvent(binlog.TableMapEventType),
+				typedEvent(binlog.WriteRowsEventV2Type),
+				queryEvent("XA END X'31',X'',1"),
+				typedEvent(binlog.XAPrepareLogEventType),
+				gtidEvent(2),
+				queryEvent("XA COMMIT X'31',X'',1"),
+			},
+			gtids: []string{"", "", "", "", "", ":1", ":1", ":1-2"},
+		},
+		{
+			name:   "mixed",
+			flavor: mconn.MySQLFlavor,
+			events: []*binlog.Event{
+				gtidEvent(1),
+				queryEvent("BEGIN"),
+				queryEvent("INSERT INTO t VALUES (NOW())"),
+				typedEvent(binlog.TableMapEventType),
+				typedEvent(binlog.WriteRowsEventV2Type),
+				typedEvent(binlog.XidEventType),
+				gtidEvent(2),
+				queryEvent("CREATE TABLE t2 (id INT)"),
+			},
+			gtids: []string{"", "", "", "", "", ":1", ":1", ":1-2"},
+		},
+		{
+			name:   "mariadb",
+			flavor: mconn.MariaDBFlavor,
+			events: []*binlog.Event{
+				mariadbGTIDEvent(1, 0),
+				queryEvent("INSERT INTO t VALUES (NOW())"),
+				queryEvent("COMMIT"),
+				mariadbGTIDEvent(2, binlog.MariadbGTIDFlagStandalone),
+				queryEvent("CREATE TABLE t2 (id INT)"),
+			},
+			gtids: []string{"", "", "0-1-1", "0-1-1", "0-1-2"},
+		},
+	}
+	for _, c := range cases {
+		tracker, err := NewPointTracker(mconn.ReplicationPoint{}, c.flavor)
+		if nil != err {
+			t.Fatal(err)
+		}
+		for i, e := range c.events {
+			if err = tracker.OnEvent(e); nil != err {
+				t.Fatalf("%s: event %d: %v", c.name, i, err)
+			}
+			want := c.gtids[i]
+			if mconn.MySQLFlavor == c.flavor && "" != want {
+				want = testSID + want
+			}
+			if gtid := tracker.Point().Gtid; want != gtid {
+				t.Errorf("%s: event %d: unexpected gtid set %s, want %s", c.name, i, gtid, want)
+			}
+		}
+	}
+}
+
+func TestStopCheckerXATransaction(t *testing.T) {
+	c, err := newStopChecker(mconn.StopCondition{StopFile: "binlog.000001", StopPos: 100}, "")
+	if nil != err {
+		t.Fatal(err)
+	}
+	tracker, _ := NewPointTracker(mconn.ReplicationPoint{Filename: "binlog.000001"}, "")
+	events := []*binlog.Event{
+		typedEvent(binlog.AnonymousGtidEventType),
+		queryEvent("XA START X'31',X'',1"),
+		typedEvent(binlog.TableMapEventType),
+		typedEvent(binlog.WriteRowsEventV2Type),
+		queryEvent("XA END X'31',X'',1"),
+		typedEvent(binlog.XAPrepareLogEventType),
+	}
+	for i, e := range events {
+		e.Header.LogPos = uint32(100 + i)
+		if c.before(e) {
+			t.Fatalf("event %d is stopped before", i)
+		}
+		if err = tracker.OnEvent(e); nil != err {
+			t.Fatal(err)
+		}
+		if stop := c.after(tracker); stop != (len(events)-1 == i) {
+			t.Errorf("event %d: unexpected stop %v", i, stop)
+		}
+	}
+}
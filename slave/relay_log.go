@@ -0,0 +1,664 @@
+package slave
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sryanyuan/binp/binlog"
+	"github.com/sryanyuan/binp/mconn"
+	"github.com/sryanyuan/binp/serialize"
+)
+
+const (
+	defaultRelayLogBaseName    = "relay-bin"
+	defaultRelayLogMaxFileSize = 100
+	relayLogIndexSuffix        = ".index"
+	eventHeaderLength          = 19
+)
+
+// relayLogSizeUnit is the unit of relay log size limits, a variable for tests
+var relayLogSizeUnit int64 = 1 << 20
+
+// relayLogFile is a relay log file listed in the index file
+type relayLogFile struct {
+	seq   int
+	name  string
+	size  int64
+	ctime time.Time
+}
+
+// relayLog persists binlog events to rotating local files in binlog format, the
+// relay log reader tails the files and delivers events to the consumer
+type relayLog struct {
+	cfg         mconn.RelayLogConfig
+	maxFileSize int64
+	mu          sync.Mutex
+	files       []*relayLogFile
+	f           *os.File
+	// format is the last format description event of the master with zero log
+	// position, it is written at the beginning of each relay log file
+	format   []byte
+	checksum uint8
+	serverID uint32
+	// point is the master point after the last written event
+	point mconn.ReplicationPoint
+	// pending are events received before the first format description event
+	pending [][]byte
+	// consumed is the sequence of the relay log file being read
+	consumed int
+	// startSeq and startOffset are where the reader starts, recovered is true if the
+	// relay log is recovered from the last run, then the dump resumes from point with
+	// gtids of the transactions relayed but not consumed
+	startSeq    int
+	startOffset int64
+	recovered   bool
+	gtids       []string
+	finished    bool
+	// notify is closed and renewed once the relay log changes
+	notify chan struct{}
+}
+
+// newRelayLog creates the relay log starts at the consumed point, files left by the last
+// run are recovered if the point is in them, otherwise they are removed
+func newRelayLog(cfg *mconn.RelayLogConfig, point mconn.ReplicationPoint) (*relayLog, error) {
+	l := &relayLog{
+		cfg:      *cfg,
+		point:    point,
+		startSeq: 1,
+		notify:   make(chan struct{}),
+	}
+	if "" == l.cfg.BaseName {
+		l.cfg.BaseName = defaultRelayLogBaseName
+	}
+	if 0 == l.cfg.MaxFileSize {
+		l.cfg.MaxFileSize = defaultRelayLogMaxFileSize
+	}
+	l.maxFileSize = int64(l.cfg.MaxFileSize) * relayLogSizeUnit
+
+	if err := os.MkdirAll(l.cfg.Dir, 0755); nil != err {
+		return nil, errors.Trace(err)
+	}
+	if err := l.recover(point); nil != err {
+		return nil, errors.Trace(err)
+	}
+	return l, nil
+}
+
+func (l *relayLog) indexPath() string {
+	return filepath.Join(l.cfg.Dir, l.cfg.BaseName+relayLogIndexSuffix)
+}
+
+func (l *relayLog) filePath(name string) string {
+	return filepath.Join(l.cfg.Dir, name)
+}
+
+// readIndex returns the names of relay log files listed in the index file, returns
+// false if the index file doesn't exist
+func (l *relayLog) readIndex() ([]string, bool, error) {
+	f, err := os.Open(l.indexPath())
+	if nil != err {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, errors.Trace(err)
+	}
+	defer f.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if "" == name {
+			continue
+		}
+		names = append(names, filepath.Base(name))
+	}
+	if err = scanner.Err(); nil != err {
+		return nil, false, errors.Trace(err)
+	}
+	return names, true, nil
+}
+
+// reset removes the relay log files listed in the index file
+func (l *relayLog) reset() error {
+	names, ok, err := l.readIndex()
+	if nil != err || !ok {
+		return errors.Trace(err)
+	}
+	for _, name := range names {
+		if err = os.Remove(l.filePath(name)); nil != err && !os.IsNotExist(err) {
+			return errors.Trace(err)
+		}
+		logrus.Infof("Remove relay log %s", name)
+	}
+	return errors.Trace(os.Remove(l.indexPath()))
+}
+
+// recover loads the relay log files left by the last run. The reader resumes after the
+// consumed point, and events after the last complete transaction are truncated as the
+// dump resumes after the transaction. Files are removed if the point is not found
+func (l *relayLog) recover(point mconn.ReplicationPoint) error {
+	names, ok, err := l.readIndex()
+	if nil != err || !ok {
+		return errors.Trace(err)
+	}
+	if ok, err = l.load(names, point); nil != err {
+		return errors.Trace(err)
+	}
+	if ok {
+		logrus.Infof("Recover relay log, read from %s.%06d:%d, relayed to %v:%v",
+			l.cfg.BaseName, l.startSeq, l.startOffset, l.point.Filename, l.point.Offset)
+		return nil
+	}
+	logrus.Warnf("Consumed point %v:%v(%v) is not found in the relay log, fetch from the master",
+		point.Filename, point.Offset, point.Gtid)
+	l.files = nil
+	return errors.Trace(l.reset())
+}
+
+// load scans the relay log files for the consumed point and the end of the last
+// complete transaction after it, returns false if any of them is not found
+func (l *relayLog) load(names []string, point mconn.ReplicationPoint) (bool, error) {
+	if "" == point.Filename || 0 == len(names) {
+		return false, nil
+	}
+	files := make([]*relayLogFile, 0, len(names))
+	for _, name := range names {
+		rf := &relayLogFile{name: name}
+		seq, err := strconv.Atoi(strings.TrimPrefix(filepath.Ext(name), "."))
+		if nil != err {
+			return false, errors.Errorf("invalid relay log name %s", name)
+		}
+		rf.seq = seq
+		fi, err := os.Stat(l.filePath(name))
+		if nil != err {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return false, errors.Trace(err)
+		}
+		rf.size = fi.Size()
+		rf.ctime = fi.ModTime()
+		files = append(files, rf)
+	}
+
+	// Points are tracked the same as the consumer, unparsed events are not delivered
+	parser := binlog.NewParser()
+	tracker, err := NewPointTracker(mconn.ReplicationPoint{}, "")
+	if nil != err {
+		return false, errors.Trace(err)
+	}
+	var (
+		txn         txnTracker
+		boundary    = true
+		found       bool
+		format      *binlog.Event
+		pendingGTID string
+		gtids       []string
+	)
+	// The end of the last complete transaction
+	var (
+		endIndex  = -1
+		endOffset int64
+		endPoint  mconn.ReplicationPoint
+		endFormat *binlog.Event
+	)
+	for i, rf := range files {
+		r, err := binlog.NewFileReader(l.filePath(rf.name), parser)
+		if nil != err {
+			return false, errors.Trace(err)
+		}
+		for {
+			event, err := r.Next()
+			if nil != err {
+				if io.EOF == err || io.ErrUnexpectedEOF == err {
+					break
+				}
+				r.Close()
+				return false, errors.Annotatef(err, "read relay log %s", rf.name)
+			}
+			for _, ev := range event.Flatten() {
+				if !ev.Payload.Parsed {
+					continue
+				}
+				if err = tracker.OnEvent(ev); nil != err {
+					r.Close()
+					return false, errors.Trace(err)
+				}
+				switch ev.Header.EventType {
+				case binlog.FormatDescriptionEventType:
+					{
+						format = ev
+					}
+				case binlog.GTIDEventType:
+					{
+						pendingGTID = ev.Payload.GTID.String()
+					}
+				case binlog.AnonymousGtidEventType:
+					{
+						pendingGTID = ""
+					}
+				case binlog.MariadbGTIDEventType:
+					{
+						pendingGTID = ev.Payload.MariadbGTID.String()
+					}
+				}
+				switch ev.Header.EventType {
+				case binlog.XidEventType, binlog.XAPrepareLogEventType, binlog.QueryEventType,
+					binlog.GTIDEventType, binlog.AnonymousGtidEventType, binlog.MariadbGTIDEventType:
+					{
+						boundary = txn.onEvent(ev)
+						if boundary && found && "" != pendingGTID {
+							gtids = append(gtids, pendingGTID)
+						}
+						if boundary {
+							pendingGTID = ""
+						}
+					}
+				}
+			}
+			if !found {
+				if p := tracker.Point(); p.Filename == point.Filename && p.Offset == point.Offset {
+					found = true
+					l.startSeq = rf.seq
+					l.startOffset = r.NextOffset()
+				}
+			}
+			if found && boundary {
+				endIndex = i
+				endOffset = r.NextOffset()
+				endPoint = tracker.Point()
+				endFormat = format
+			}
+		}
+		r.Close()
+	}
+	if endIndex < 0 || nil == endFormat {
+		return false, nil
+	}
+
+	// Truncate the incomplete transaction and the torn event at the end
+	for _, rf := range files[endIndex+1:] {
+		if err = os.Remove(l.filePath(rf.name)); nil != err && !os.IsNotExist(err) {
+			return false, errors.Trace(err)
+		}
+		logrus.Infof("Remove incomplete relay log %s", rf.name)
+	}
+	files = files[:endIndex+1]
+	if rf := files[endIndex]; rf.size > endOffset {
+		if err = os.Truncate(l.filePath(rf.name), endOffset); nil != err {
+			return false, errors.Trace(err)
+		}
+		logrus.Infof("Truncate relay log %s from %d to %d", rf.name, rf.size, endOffset)
+		rf.size = endOffset
+	}
+
+	// New events are written to the next file
+	l.files = files
+	l.setFormat(endFormat)
+	l.point = endPoint
+	l.gtids = gtids
+	l.consumed = l.startSeq
+	l.recovered = true
+	if err = l.writeIndex(); nil != err {
+		return false, errors.Trace(err)
+	}
+	return true, errors.Trace(l.purge())
+}
+
+// start returns the relay log file and the offset the reader starts from
+func (l *relayLog) start() (int, int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.startSeq, l.startOffset
+}
+
+// resume moves the dump point of the tracker to the end of the recovered relay log
+func (l *relayLog) resume(t *PointTracker) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.recovered {
+		return nil
+	}
+	return errors.Trace(t.resume(l.point, l.gtids))
+}
+
+func (l *relayLog) writeIndex() error {
+	var b strings.Builder
+	for _, f := range l.files {
+		b.WriteString(f.name)
+		b.WriteByte('\n')
+	}
+	tmp := l.indexPath() + ".tmp"
+	f, err := os.Create(tmp)
+	if nil != err {
+		return errors.Trace(err)
+	}
+	if _, err = io.WriteString(f, b.String()); nil == err {
+		err = f.Sync()
+	}
+	f.Close()
+	if nil != err {
+		return errors.Trace(err)
+	}
+	return errors.Trace(os.Rename(tmp, l.indexPath()))
+}
+
+// write appends the event to the relay log, point is the master point after the event
+func (l *relayLog) write(event *binlog.Event, point mconn.ReplicationPoint) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if binlog.FormatDescriptionEventType == event.Header.EventType {
+		l.setFormat(event)
+	}
+	if nil == l.format {
+		// The checksum of events is unknown before the format description event
+		l.pending = append(l.pending, event.Data)
+		l.point = point
+		return nil
+	}
+	if nil == l.f || l.files[len(l.files)-1].size >= l.maxFileSize {
+		if err := l.rotate(); nil != err {
+			return errors.Trace(err)
+		}
+	}
+	for _, data := range l.pending {
+		if err := l.writeData(data); nil != err {
+			return errors.Trace(err)
+		}
+	}
+	l.pending = nil
+	if err := l.writeData(event.Data); nil != err {
+		return errors.Trace(err)
+	}
+	l.point = point
+	l.wakeup()
+	return nil
+}
+
+func (l *relayLog) setFormat(event *binlog.Event) {
+	l.checksum = binlog.FormatDescriptionChecksum(event.Data)
+	l.serverID = event.Header.ServerID
+	body := event.Data[eventHeaderLength:]
+	if binlog.ChecksumAlgCRC32 == l.checksum {
+		body = body[:len(body)-4]
+	}
+	header := event.Header
+	header.LogPos = 0
+	l.format = header.Encode(body, l.checksum)
+}
+
+// rotate switches to a new relay log file, the file starts with the format description
+// event and a rotate event of the master point, so the reader can resume from the file
+func (l *relayLog) rotate() error {
+	if nil != l.f {
+		if err := l.f.Sync(); nil != err {
+			return errors.Trace(err)
+		}
+		l.f.Close()
+		l.f = nil
+	}
+
+	rf := &relayLogFile{seq: 1, ctime: time.Now()}
+	if 0 != len(l.files) {
+		rf.seq = l.files[len(l.files)-1].seq + 1
+	}
+	rf.name = fmt.Sprintf("%s.%06d", l.cfg.BaseName, rf.seq)
+	f, err := os.OpenFile(l.filePath(rf.name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if nil != err {
+		return errors.Trace(err)
+	}
+	l.f = f
+	l.files = append(l.files, rf)
+	if err = l.writeIndex(); nil != err {
+		return errors.Trace(err)
+	}
+	logrus.Infof("Rotate relay log to %s", rf.name)
+
+	if err = l.writeData(binlog.FileMagic); nil != err {
+		return errors.Trace(err)
+	}
+	if err = l.writeData(l.format); nil != err {
+		return errors.Trace(err)
+	}
+	if "" != l.point.Filename {
+		w := serialize.NewBinWriter(nil)
+		w.WriteUint64(uint64(l.point.Offset))
+		w.WriteEOFString(l.point.Filename)
+		header := binlog.EventHeader{
+			EventType: binlog.RotateEventType,
+			ServerID:  l.serverID,
+			Flags:     binlog.LogEventArtificialFlag | binlog.LogEventRelayLogFlag,
+		}
+		if err = l.writeData(header.Encode(w.Bytes(), l.checksum)); nil != err {
+			return errors.Trace(err)
+		}
+	}
+	return errors.Trace(l.purge())
+}
+
+func (l *relayLog) writeData(data []byte) error {
+	if _, err := l.f.Write(data); nil != err {
+		return errors.Trace(err)
+	}
+	l.files[len(l.files)-1].size += int64(len(data))
+	return nil
+}
+
+// sync commits the relay log file to the storage
+func (l *relayLog) sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if nil == l.f {
+		return nil
+	}
+	return errors.Trace(l.f.Sync())
+}
+
+// finish marks the end of the relay log, the reader stops at the end
+func (l *relayLog) finish() {
+	l.mu.Lock()
+	l.finished = true
+	l.wakeup()
+	l.mu.Unlock()
+}
+
+func (l *relayLog) wakeup() {
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// open returns the path of the relay log file, returns false if the file is not created
+func (l *relayLog) open(seq int) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, f := range l.files {
+		if f.seq == seq {
+			return l.filePath(f.name), true
+		}
+	}
+	return "", false
+}
+
+// state returns the state of the relay log for the reader of the file, the notify
+// channel is closed once the state changes
+func (l *relayLog) state(seq int) (hasNext bool, finished bool, notify <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	hasNext = 0 != len(l.files) && l.files[len(l.files)-1].seq > seq
+	return hasNext, l.finished, l.notify
+}
+
+// consume marks the files before the file of seq consumed, they are purged by retention
+func (l *relayLog) consume(seq int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.consumed = seq
+	return errors.Trace(l.purge())
+}
+
+// purge removes consumed files out of the retention
+func (l *relayLog) purge() error {
+	var consumedSize int64
+	consumed := 0
+	for _, f := range l.files {
+		if f.seq >= l.consumed {
+			break
+		}
+		consumedSize += f.size
+		consumed++
+	}
+
+	purged := 0
+	for _, f := range l.files[:consumed] {
+		expired := 0 == l.cfg.MaxTotalSize && 0 == l.cfg.MaxAge
+		if l.cfg.MaxAge > 0 && time.Since(f.ctime) > time.Duration(l.cfg.MaxAge)*time.Hour {
+			expired = true
+		}
+		if l.cfg.MaxTotalSize > 0 && consumedSize > int64(l.cfg.MaxTotalSize)*relayLogSizeUnit {
+			expired = true
+		}
+		if !expired {
+			break
+		}
+		if err := os.Remove(l.filePath(f.name)); nil != err && !os.IsNotExist(err) {
+			return errors.Trace(err)
+		}
+		logrus.Infof("Purge relay log %s", f.name)
+		consumedSize -= f.size
+		purged++
+	}
+	if 0 == purged {
+		return nil
+	}
+	l.files = l.files[purged:]
+	return errors.Trace(l.writeIndex())
+}
+
+// close closes the relay log file
+func (l *relayLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if nil != l.f {
+		l.f.Sync()
+		l.f.Close()
+		l.f = nil
+	}
+}
+
+// readRelayLog reads events from relay log files and delivers them to the consumer
+func (s *Slave) readRelayLog() {
+	defer s.wg.Done()
+
+	parser := binlog.NewParser()
+	parser.SetSyncRule(s.srule)
+	seq, offset := s.relay.start()
+	for ; ; seq++ {
+		err := s.readRelayLogFile(parser, seq, offset)
+		offset = 0
+		if nil == err {
+			continue
+		}
+		if io.EOF == err {
+			// All events are consumed
+			select {
+			case s.eq.eventCh <- nil:
+			case <-s.cancelCtx.Done():
+			}
+		} else if ErrUserClosed != err {
+			if binlog.IsChecksumError(err) {
+				atomic.AddInt64(&s.checksumErrors, 1)
+			}
+			s.pushQueueError(errors.Trace(err))
+		}
+		return
+	}
+}
+
+// readRelayLogFile reads events of the relay log file from the offset if it is not 0,
+// returns nil if the next file is created after all events are read, returns io.EOF
+// at the end of the relay log
+func (s *Slave) readRelayLogFile(parser *binlog.Parser, seq int, offset int64) error {
+	var r *binlog.FileReader
+	for nil == r {
+		_, finished, notify := s.relay.state(seq)
+		name, ok := s.relay.open(seq)
+		if ok {
+			var err error
+			if r, err = binlog.NewFileReader(name, parser); nil != err {
+				return errors.Trace(err)
+			}
+			break
+		}
+		if finished {
+			return io.EOF
+		}
+		select {
+		case <-notify:
+		case <-s.cancelCtx.Done():
+			{
+				return ErrUserClosed
+			}
+		}
+	}
+	defer r.Close()
+	if err := s.relay.consume(seq); nil != err {
+		return errors.Trace(err)
+	}
+	if offset > 0 {
+		if err := r.SeekEvent(offset); nil != err {
+			return errors.Annotatef(err, "seek relay log %s", r.Name())
+		}
+	}
+
+	for {
+		// The state is got before reading, events written later wake up the reader
+		hasNext, finished, notify := s.relay.state(seq)
+		event, err := r.Next()
+		if nil == err {
+			for _, ev := range event.Flatten() {
+				if !ev.Payload.Parsed {
+					continue
+				}
+				select {
+				case s.eq.eventCh <- ev:
+				case <-s.cancelCtx.Done():
+					{
+						return ErrUserClosed
+					}
+				}
+			}
+			continue
+		}
+		if io.EOF != err && io.ErrUnexpectedEOF != err {
+			return errors.Trace(err)
+		}
+		if hasNext {
+			if io.ErrUnexpectedEOF == err {
+				return errors.Errorf("incomplete event at the end of relay log %s", r.Name())
+			}
+			return nil
+		}
+		if finished {
+			return io.EOF
+		}
+		select {
+		case <-notify:
+		case <-s.cancelCtx.Done():
+			{
+				return ErrUserClosed
+			}
+		}
+	}
+}
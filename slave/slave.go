@@ -37,6 +37,12 @@ var (
 	ErrUserClosed = errors.New("User closed")
 )
 
+// Retry settings, variables for tests to shorten the failover
+var (
+	retryInterval          = time.Second
+	switchMasterRetryTimes = defaultSwitchMasterRetryTimes
+)
+
 // MasterStatus is status of master
 type MasterStatus struct {
 	Version string                 `json:"version"`
@@ -53,13 +59,29 @@ type Slave struct {
 	dsi               int64
 	rc                *mconn.ReplicationConfig
 	status            int64
-	currentRplPoint   mconn.ReplicationPoint
+	startPoint        mconn.ReplicationPoint
+	tracker           *PointTracker
+	stop              *stopChecker
+	eof               int32
 	eq                *eventQueue
+	relay             *relayLog
+	srule             rule.ISyncRule
+	connMu            sync.Mutex
 	conn              *mconn.Conn
 	si                mconn.HandshakeInfo
 	mariaDB           bool
 	parser            *binlog.Parser
 	lastHeartbeatTime uint32
+	checksumErrors    int64
+	// corruptPoint is the point reconnected from due to the corrupted event
+	corruptPoint *mconn.ReplicationPoint
+	// groupEvents counts the handled events of the open gtid event group
+	groupEvents int
+	// The master resends the whole open event group after reconnect in gtid mode,
+	// resentEvents of the group resentGTID are skipped as they are handled
+	resentGTID   string
+	resentEvents int
+	resending    bool
 }
 
 // NewSlave creates a new slave
@@ -68,6 +90,7 @@ func NewSlave(dss []mconn.DataSource, rc *mconn.ReplicationConfig, srule rule.IS
 	// Create parser
 	sl.parser = binlog.NewParser()
 	sl.parser.SetSyncRule(srule)
+	sl.srule = srule
 	sl.cancelCtx, sl.cancelFn = context.WithCancel(context.Background())
 	sl.rc = rc
 	sl.dss = dss
@@ -94,17 +117,46 @@ func (s *Slave) Start(pos mconn.ReplicationPoint) error {
 		return errors.New("Empty data source")
 	}
 
-	s.currentRplPoint = pos
+	if pos.Offset < 4 {
+		// MySQL binlog events is started at position 4 as a Format_desc event
+		pos.Offset = 4
+	}
+	if err := s.checkSemiSyncAckPolicy(); nil != err {
+		return errors.Trace(err)
+	}
+	switch s.rc.GetChecksumPolicy() {
+	case mconn.ChecksumPolicyFail, mconn.ChecksumPolicySkip, mconn.ChecksumPolicyReconnect:
+	default:
+		{
+			return errors.Errorf("Unsupported checksum policy %s", s.rc.ChecksumPolicy)
+		}
+	}
+
+	s.startPoint = pos
 	logrus.Infof("Start sync from %v:%v(%v)",
-		s.currentRplPoint.Filename, s.currentRplPoint.Offset, s.currentRplPoint.Gtid)
+		pos.Filename, pos.Offset, pos.Gtid)
+	if s.rc.RelayLog.IsEnabled() {
+		relay, err := newRelayLog(&s.rc.RelayLog, pos)
+		if nil != err {
+			return errors.Annotate(err, "Create relay log failed")
+		}
+		s.relay = relay
+	}
 	err := s.prepare()
 	if nil != err {
+		if nil != s.relay {
+			s.relay.close()
+		}
 		return errors.Trace(err)
 	}
 	atomic.StoreInt64(&s.status, slaveStatusRunning)
 
 	s.wg.Add(1)
 	go s.pumpBinlog()
+	if nil != s.relay {
+		s.wg.Add(1)
+		go s.readRelayLog()
+	}
 
 	return nil
 }
@@ -122,17 +174,28 @@ func (s *Slave) Stop() {
 	// Close the connection
 	s.conn.Close()
 	s.wg.Wait()
+	if nil != s.relay {
+		s.relay.close()
+	}
 }
 
-// Next gets the binlog event until a binlog comes or context timeout
+// Next gets the binlog event until a binlog comes or context timeout,
+// io.EOF is returned if the dump reaches the end in non-block mode or the stop condition
 func (s *Slave) Next(ctx context.Context) (*binlog.Event, error) {
 	if atomic.LoadInt64(&s.status) != slaveStatusRunning {
 		return nil, errors.New("slave not running")
 	}
+	if 1 == atomic.LoadInt32(&s.eof) {
+		return nil, io.EOF
+	}
 
 	select {
 	case ev := <-s.eq.eventCh:
 		{
+			if nil == ev {
+				atomic.StoreInt32(&s.eof, 1)
+				return nil, io.EOF
+			}
 			return ev, nil
 		}
 	case err := <-s.eq.errorCh:
@@ -160,18 +223,120 @@ func (s *Slave) pushQueueEvent(event *binlog.Event) {
 	s.eq.eventCh <- event
 }
 
-func (s *Slave) prepare() error {
-	if s.currentRplPoint.Offset < 4 {
-		// MySQL binlog events is started at position 4 as a Format_desc event
-		s.currentRplPoint.Offset = 4
+// pushQueueEOF ends the binlog stream, the connection is closed
+func (s *Slave) pushQueueEOF() {
+	pos := s.tracker.Point()
+	logrus.Infof("Binlog dump ends at %v:%v(%v)", pos.Filename, pos.Offset, pos.Gtid)
+	s.connMu.Lock()
+	s.conn.Close()
+	s.connMu.Unlock()
+	if nil != s.relay {
+		// The relay log reader ends the stream after all events are read
+		s.relay.finish()
+		return
+	}
+	s.eq.eventCh <- nil
+}
+
+// handleEvent tracks and delivers the parsed event, returns true if the stop condition is
+// reached. Inner events of the compressed transaction are tracked and delivered one by one,
+// but the relay log keeps the compressed event to be the same as the binlog
+func (s *Slave) handleEvent(event *binlog.Event) (bool, error) {
+	events := event.Flatten()
+	for i, ev := range events {
+		// Inner events may be filtered by the sync rule
+		if ev.Payload.Parsed {
+			if nil != s.stop && s.stop.before(ev) {
+				return true, nil
+			}
+			if err := s.onBinlogPumped(ev); nil != err {
+				return false, errors.Trace(err)
+			}
+			if nil == s.relay {
+				s.pushQueueEvent(ev)
+			}
+		}
+		if nil != s.relay && i == len(events)-1 {
+			if err := s.writeRelayLog(event, s.tracker.Point()); nil != err {
+				return false, errors.Trace(err)
+			}
+		}
+		if ev.Payload.Parsed && nil != s.stop && s.stop.after(s.tracker) {
+			return true, nil
+		}
 	}
+	return false, nil
+}
 
+// skipEvent handles the event not parsed, it is not delivered to the consumer but
+// still written to the relay log to keep the relay log the same as the binlog
+func (s *Slave) skipEvent(event *binlog.Event) error {
+	pos := s.tracker.Point()
+	if event.Header.LogPos > 0 {
+		pos.Offset = event.Header.LogPos
+	}
+	if nil != s.relay {
+		return errors.Trace(s.writeRelayLog(event, pos))
+	}
+	if event.NeedAck {
+		// Nothing to persist, ack the skipped event directly
+		if err := s.SemiSyncAck(pos); nil != err {
+			logrus.Errorf("Semi-sync ack error: %v", err)
+		}
+	}
+	return nil
+}
+
+// writeRelayLog writes the event to the relay log, the event is acknowledged after it is synced
+func (s *Slave) writeRelayLog(event *binlog.Event, point mconn.ReplicationPoint) error {
+	// Heartbeats are not persisted
+	if binlog.HeartbeatEventType == event.Header.EventType {
+		return nil
+	}
+	if err := s.relay.write(event, point); nil != err {
+		return errors.Annotate(err, "Write relay log failed")
+	}
+	if event.NeedAck {
+		if err := s.relay.sync(); nil != err {
+			return errors.Annotate(err, "Sync relay log failed")
+		}
+		if err := s.SemiSyncAck(point); nil != err {
+			logrus.Errorf("Semi-sync ack error: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *Slave) prepare() error {
 	if err := s.registerSlave(); nil != err {
 		return errors.Trace(err)
 	}
 
+	// The gtid flavor is known after connected, so the tracker is created here.
+	// On retry the tracker is kept to resume from the last point
+	if nil == s.tracker {
+		tracker, err := NewPointTracker(s.startPoint, s.GTIDFlavor())
+		if nil != err {
+			return errors.Trace(err)
+		}
+		if nil != s.relay {
+			// The dump resumes after the events left in the relay log
+			if err = s.relay.resume(tracker); nil != err {
+				return errors.Trace(err)
+			}
+		}
+		s.tracker = tracker
+	}
+	if nil == s.stop && !s.rc.StopCondition.IsEmpty() {
+		stop, err := newStopChecker(s.rc.StopCondition, s.GTIDFlavor())
+		if nil != err {
+			return errors.Trace(err)
+		}
+		s.stop = stop
+	}
+
 	// Send dump binlog command
-	if err := s.conn.StartDumpBinlog(s.currentRplPoint); nil != err {
+	if err := s.conn.StartDumpBinlog(s.tracker.Point()); nil != err {
 		return errors.Trace(err)
 	}
 
@@ -224,10 +389,99 @@ func (s *Slave) enableBinlogHeartbeat() error {
 	return nil
 }
 
+// checkSemiSyncAckPolicy checks the semi-sync ack policy works with the relay log, events
+// are acknowledged by the consumer with the commit policy, so the relay log is not allowed
+func (s *Slave) checkSemiSyncAckPolicy() error {
+	if !s.rc.SemiSync {
+		return nil
+	}
+	switch s.rc.GetSemiSyncAckPolicy() {
+	case mconn.SemiSyncAckPolicyCommit:
+		{
+			if s.rc.RelayLog.IsEnabled() {
+				return errors.New("Semi-sync ack policy commit is not supported with relay log")
+			}
+		}
+	case mconn.SemiSyncAckPolicyRelay:
+		{
+			if !s.rc.RelayLog.IsEnabled() {
+				return errors.New("Semi-sync ack policy relay requires relay log")
+			}
+		}
+	default:
+		{
+			return errors.Errorf("Unsupported semi-sync ack policy %s", s.rc.SemiSyncAckPolicy)
+		}
+	}
+	return nil
+}
+
+func (s *Slave) enableSemiSync() error {
+	s.parser.SetSemiSync(false)
+	if !s.rc.SemiSync {
+		return nil
+	}
+
+	// Check the master enables semi-sync
+	rows, err := s.conn.Exec("SHOW VARIABLES LIKE 'rpl_semi_sync_master_enabled'")
+	if nil != err {
+		return errors.Trace(err)
+	}
+	enabled := false
+	if err = rows.Results.Next(); nil == err {
+		value, err := rows.Results.GetAtString(1)
+		if nil != err {
+			rows.Results.Close()
+			return errors.Trace(err)
+		}
+		enabled = strings.EqualFold(value, "ON")
+	} else if err != io.EOF {
+		rows.Results.Close()
+		return errors.Trace(err)
+	}
+	rows.Results.Close()
+	if !enabled {
+		logrus.Warnf("Semi-sync is not enabled by master, replicate asynchronously")
+		return nil
+	}
+
+	if _, err = s.conn.Exec("SET @rpl_semi_sync_slave = 1"); nil != err {
+		return errors.Trace(err)
+	}
+	s.parser.SetSemiSync(true)
+	logrus.Infof("Semi-sync replication enabled")
+	return nil
+}
+
+// SemiSyncAck acknowledges the master that the events before the point are persisted
+func (s *Slave) SemiSyncAck(point mconn.ReplicationPoint) error {
+	s.connMu.Lock()
+	conn := s.conn
+	s.connMu.Unlock()
+	if nil == conn {
+		return errors.New("slave not connected")
+	}
+	if err := conn.SemiSyncAck(point); nil != err {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
 func (s *Slave) nextDataSource() {
 	atomic.AddInt64(&s.dsi, 1)
 }
 
+// GTIDFlavor returns the gtid flavor of the master, returns empty string if gtid is not enabled
+func (s *Slave) GTIDFlavor() string {
+	if !s.rc.EnableGtid {
+		return ""
+	}
+	if s.mariaDB {
+		return mconn.MariaDBFlavor
+	}
+	return mconn.MySQLFlavor
+}
+
 // GetDataSourceIndex get the current data source index used by replication replication
 func (s *Slave) GetDataSourceIndex() int {
 	return int(atomic.LoadInt64(&s.dsi)) % len(s.dss)
@@ -252,19 +506,20 @@ func (s *Slave) registerSlave() error {
 
 	// Connect to mysql
 	ds := s.getDataSource()
-	s.conn = &mconn.Conn{}
-	err = s.conn.Connect(ds, "")
+	conn := &mconn.Conn{}
+	err = conn.Connect(ds, "")
 	if nil != err {
 		return errors.Trace(err)
 	}
+	s.connMu.Lock()
+	s.conn = conn
+	s.connMu.Unlock()
 	s.conn.GetHandshakeInfo(&s.si)
 	logrus.Infof("Connect to mysql %s success", ds.Address())
 	logrus.Infof("Master status: %v", &s.si)
 
 	// Is mariadb ?
-	if strings.Contains(strings.ToUpper(s.si.ServerVersion), "MARIADB") {
-		s.mariaDB = true
-	}
+	s.mariaDB = s.si.Flavor() == mconn.MariaDBFlavor
 
 	// Set keepalive period
 	if s.rc.KeepAlivePeriod != 0 {
@@ -287,6 +542,11 @@ func (s *Slave) registerSlave() error {
 		return errors.Trace(err)
 	}
 
+	// Enable semi-sync
+	if err = s.enableSemiSync(); nil != err {
+		return errors.Trace(err)
+	}
+
 	// If is mariadb, enable gtid
 	// https://github.com/alibaba/canal/wiki/BinlogChange(MariaDB5&10)
 	if s.mariaDB {
@@ -304,24 +564,15 @@ func (s *Slave) registerSlave() error {
 }
 
 func (s *Slave) onBinlogPumped(event *binlog.Event) error {
-	if event.Header.LogPos > 0 {
-		s.currentRplPoint.Offset = event.Header.LogPos
+	if err := s.tracker.OnEvent(event); nil != err {
+		return errors.Trace(err)
 	}
 
 	switch event.Header.EventType {
 	case binlog.RotateEventType:
 		{
-			evt := event.Payload.Rotate
-			// If using position replication, update the replication position
-			s.currentRplPoint.Filename = evt.NextName
-			s.currentRplPoint.Offset = uint32(evt.Position)
-			logrus.Infof("Rotate to %v:%v(%v)", s.currentRplPoint.Filename, s.currentRplPoint.Offset, s.currentRplPoint.Gtid)
-		}
-	case binlog.WriteRowsEventV0Type, binlog.WriteRowsEventV1Type, binlog.WriteRowsEventV2Type,
-		binlog.UpdateRowsEventV0Type, binlog.UpdateRowsEventV1Type, binlog.UpdateRowsEventV2Type,
-		binlog.DeleteRowsEventV0Type, binlog.DeleteRowsEventV1Type, binlog.DeleteRowsEventV2Type:
-		{
-			s.currentRplPoint.Offset = event.Header.LogPos
+			pos := s.tracker.Point()
+			logrus.Infof("Rotate to %v:%v(%v)", pos.Filename, pos.Offset, pos.Gtid)
 		}
 	case binlog.HeartbeatEventType:
 		{
@@ -348,8 +599,9 @@ func (s *Slave) pumpBinlog() {
 				return
 			}
 			// If retry success
+			pos := s.tracker.Point()
 			logrus.Infof("Retry sync at point %s:%d(%s) success",
-				s.currentRplPoint.Filename, s.currentRplPoint.Offset, s.currentRplPoint.Gtid)
+				pos.Filename, pos.Offset, pos.Gtid)
 			continue
 		}
 
@@ -367,26 +619,54 @@ func (s *Slave) pumpBinlog() {
 			}
 		case mconn.PacketHeaderEOF:
 			{
-				// Ignore ?
+				// Master has sent all events in non-block mode
+				if s.rc.NonBlock {
+					s.pushQueueEOF()
+					return
+				}
 				continue
 			}
 		case mconn.PacketHeaderOK:
 			{
 				// Parse the binlog event
 				event, err := s.parser.Parse(data)
+				if nil != err {
+					if binlog.IsChecksumError(err) {
+						err = s.onChecksumError(err)
+					}
+					if nil != err {
+						s.pushQueueError(errors.Trace(err))
+						return
+					}
+					continue
+				}
+				skip, err := s.skipResentEvent(event)
 				if nil != err {
 					s.pushQueueError(errors.Trace(err))
 					return
 				}
+				if skip {
+					continue
+				}
 				if !event.Payload.Parsed {
 					//logrus.Debugf("Skip unparsed event, event type = %v", event.Header.EventType)
+					if err = s.skipEvent(event); nil != err {
+						s.pushQueueError(errors.Trace(err))
+						return
+					}
+					s.countGroupEvent(event)
 					continue
 				}
-				if err = s.onBinlogPumped(event); nil != err {
+				stop, err := s.handleEvent(event)
+				if nil != err {
 					s.pushQueueError(errors.Trace(err))
 					return
 				}
-				s.pushQueueEvent(event)
+				s.countGroupEvent(event)
+				if stop {
+					s.pushQueueEOF()
+					return
+				}
 			}
 		default:
 			{
@@ -397,6 +677,89 @@ func (s *Slave) pumpBinlog() {
 	}
 }
 
+// countGroupEvent counts the handled event of the open gtid event group
+func (s *Slave) countGroupEvent(event *binlog.Event) {
+	if binlog.HeartbeatEventType == event.Header.EventType {
+		return
+	}
+	if "" == s.tracker.openGTID() {
+		s.groupEvents = 0
+		return
+	}
+	s.groupEvents++
+}
+
+// skipResentEvent returns true if the event of the open event group is resent after reconnect,
+// the events before the group like the fake rotate event are not skipped
+func (s *Slave) skipResentEvent(event *binlog.Event) (bool, error) {
+	if 0 == s.resentEvents || binlog.HeartbeatEventType == event.Header.EventType {
+		return false, nil
+	}
+	if !s.resending {
+		var gtid string
+		switch event.Header.EventType {
+		case binlog.GTIDEventType:
+			{
+				gtid = event.Payload.GTID.String()
+			}
+		case binlog.MariadbGTIDEventType:
+			{
+				gtid = event.Payload.MariadbGTID.String()
+			}
+		default:
+			{
+				return false, nil
+			}
+		}
+		// The master may not have the transaction after failover
+		if gtid != s.resentGTID {
+			return false, errors.Errorf("The partially received transaction %s is not resent, got %s",
+				s.resentGTID, gtid)
+		}
+		s.resending = true
+	}
+	s.resentEvents--
+	if 0 == s.resentEvents {
+		s.resending = false
+	}
+	return true, nil
+}
+
+// onChecksumError handles the corrupted event by the checksum policy, returns nil
+// if the replication goes on
+func (s *Slave) onChecksumError(err error) error {
+	atomic.AddInt64(&s.checksumErrors, 1)
+	pos := s.tracker.Point()
+	logrus.Errorf("Corrupted event after %v:%v(%v): %v", pos.Filename, pos.Offset, pos.Gtid, err)
+
+	switch s.rc.GetChecksumPolicy() {
+	case mconn.ChecksumPolicySkip:
+		{
+			return nil
+		}
+	case mconn.ChecksumPolicyReconnect:
+		{
+			// No progress since the last reconnect, the binlog of the master is corrupted
+			if nil != s.corruptPoint && *s.corruptPoint == pos {
+				return errors.Annotate(err, "Event is still corrupted after reconnect")
+			}
+			s.corruptPoint = &pos
+			if err = s.onPumpBinlogConnectionError(); nil != err {
+				return errors.Trace(err)
+			}
+			logrus.Infof("Reconnect at point %s:%d(%s) due to corrupted event success",
+				pos.Filename, pos.Offset, pos.Gtid)
+			return nil
+		}
+	}
+	return errors.Trace(err)
+}
+
+// ChecksumErrors returns the number of corrupted events detected
+func (s *Slave) ChecksumErrors() int64 {
+	return atomic.LoadInt64(&s.checksumErrors)
+}
+
 func (s *Slave) onPumpBinlogConnectionError() error {
 	retryTimes := 0
 	// If error occurs, check context has cancelled and retry
@@ -406,31 +769,40 @@ func (s *Slave) onPumpBinlogConnectionError() error {
 			{
 				return ErrUserClosed
 			}
-		case <-time.After(time.Second):
+		case <-time.After(retryInterval):
 			{
 				// Retry sync
+				pos := s.startPoint
+				if nil != s.tracker {
+					pos = s.tracker.Point()
+				}
 				if s.rc.EnableGtid {
 					// If using gtid, empty gtid is allowed
 				} else {
-					if s.currentRplPoint.Filename == "" {
+					if pos.Filename == "" {
 						return errors.Errorf("Can't retry sync with invalid position %v.%v",
-							s.currentRplPoint.Filename, s.currentRplPoint.Offset)
+							pos.Filename, pos.Offset)
 					}
 				}
 				logrus.Infof("Retry sync from position %v:%v(%v)",
-					s.currentRplPoint.Filename, s.currentRplPoint.Offset, s.currentRplPoint.Gtid)
+					pos.Filename, pos.Offset, pos.Gtid)
 				// Do retry
 				retryTimes++
 				s.parser.Reset()
 				if err := s.prepare(); nil != err {
 					logrus.Errorf("Retry sync error %v, retry times %v", err, retryTimes)
 					// Check need switch master
-					if retryTimes%defaultSwitchMasterRetryTimes == 0 {
+					if retryTimes%switchMasterRetryTimes == 0 {
 						logrus.Infof("Select next data source due to master down")
 						s.nextDataSource()
 					}
 					continue
 				}
+				// Events of the open event group are delivered or relayed
+				s.resentGTID, s.resentEvents, s.resending = s.tracker.openGTID(), s.groupEvents, false
+				if 0 != s.resentEvents {
+					logrus.Infof("Skip %d resent events of the transaction %s", s.resentEvents, s.resentGTID)
+				}
 
 				return nil
 			}
@@ -0,0 +1,560 @@
+package slave
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sryanyuan/binp/binlog"
+	"github.com/sryanyuan/binp/fakemaster"
+	"github.com/sryanyuan/binp/mconn"
+)
+
+var testTable = &fakemaster.Table{
+	ID:     100,
+	Schema: "test",
+	Name:   "t",
+	Columns: []fakemaster.Column{
+		{Type: mconn.FieldTypeLong},
+		{Type: mconn.FieldTypeVarChar, Meta: 64},
+	},
+}
+
+func init() {
+	retryInterval = 10 * time.Millisecond
+	switchMasterRetryTimes = 3
+}
+
+func newTestMaster(t *testing.T, checksum bool) *fakemaster.Master {
+	m, err := fakemaster.NewMaster(&fakemaster.Config{Checksum: checksum})
+	if nil != err {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// appendInsert appends a transaction inserts the row
+func appendInsert(t *testing.T, m *fakemaster.Master, id int32, name string) {
+	rows, err := testTable.NewWriteRowsEvent([]interface{}{id, name})
+	if nil != err {
+		t.Fatal(err)
+	}
+	m.AppendEvents(fakemaster.NewQueryEvent("test", "BEGIN"),
+		testTable.NewTableMapEvent(), rows, fakemaster.NewXidEvent(uint64(id)))
+}
+
+// nextRows returns the rows of the next rows event, other events are skipped,
+// all consumed events are tracked by the tracker if it is not nil
+func nextRows(t *testing.T, s *Slave, tracker *PointTracker) *binlog.RowsEvent {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		ev, err := s.Next(ctx)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if nil != tracker {
+			if err = tracker.OnEvent(ev); nil != err {
+				t.Fatal(err)
+			}
+		}
+		if nil != ev.Payload.Rows {
+			return ev.Payload.Rows
+		}
+	}
+}
+
+func checkRow(t *testing.T, rows *binlog.RowsEvent, id int32, name string) {
+	if 1 != len(rows.Rows) {
+		t.Fatalf("unexpected rows count %d", len(rows.Rows))
+	}
+	// Strings are decoded as bytes
+	got := fmt.Sprintf("%v %s", rows.Rows[0].ColumnDatas[0], rows.Rows[0].ColumnDatas[1])
+	want := fmt.Sprintf("%v %s", id, name)
+	if got != want {
+		t.Fatalf("unexpected row %s, want %s", got, want)
+	}
+}
+
+func TestSlaveStreaming(t *testing.T) {
+	m := newTestMaster(t, true)
+	defer m.Close()
+
+	s := NewSlave([]mconn.DataSource{m.DataSource()}, &mconn.ReplicationConfig{SlaveID: 100}, nil)
+	if err := s.Start(mconn.ReplicationPoint{Filename: "mysql-bin.000001"}); nil != err {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	tracker, _ := NewPointTracker(mconn.ReplicationPoint{}, "")
+	appendInsert(t, m, 1, "a")
+	rows := nextRows(t, s, tracker)
+	checkRow(t, rows, 1, "a")
+	if "test" != rows.Table.SchemaName || "t" != rows.Table.TableName {
+		t.Errorf("unexpected table %s.%s", rows.Table.SchemaName, rows.Table.TableName)
+	}
+
+	// Rows of the new binlog file
+	name := m.Rotate()
+	appendInsert(t, m, 2, "b")
+	checkRow(t, nextRows(t, s, tracker), 2, "b")
+	if pos := tracker.Point(); name != pos.Filename {
+		t.Errorf("unexpected binlog file %s, want %s", pos.Filename, name)
+	}
+}
+
+func TestSlaveReconnect(t *testing.T) {
+	m := newTestMaster(t, false)
+	defer m.Close()
+
+	s := NewSlave([]mconn.DataSource{m.DataSource()}, &mconn.ReplicationConfig{SlaveID: 100}, nil)
+	if err := s.Start(mconn.ReplicationPoint{Filename: "mysql-bin.000001"}); nil != err {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	appendInsert(t, m, 1, "a")
+	checkRow(t, nextRows(t, s, nil), 1, "a")
+
+	// The slave resumes from the tracked point, the first row is not streamed again
+	m.KillConnections()
+	appendInsert(t, m, 2, "b")
+	checkRow(t, nextRows(t, s, nil), 2, "b")
+	if dumps := m.Dumps(); 2 != dumps {
+		t.Errorf("unexpected dump count %d", dumps)
+	}
+}
+
+func TestSlaveReconnectInTransaction(t *testing.T) {
+	m := newTestMaster(t, false)
+	defer m.Close()
+
+	s := NewSlave([]mconn.DataSource{m.DataSource()}, &mconn.ReplicationConfig{SlaveID: 100, EnableGtid: true}, nil)
+	if err := s.Start(mconn.ReplicationPoint{}); nil != err {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	gtid, err := fakemaster.NewGTIDEvent(testSID + ":1")
+	if nil != err {
+		t.Fatal(err)
+	}
+	rows, err := testTable.NewWriteRowsEvent([]interface{}{int32(1), "a"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	m.AppendEvents(gtid, fakemaster.NewQueryEvent("test", "BEGIN"), testTable.NewTableMapEvent(), rows)
+	tracker, _ := NewPointTracker(mconn.ReplicationPoint{}, s.GTIDFlavor())
+	checkRow(t, nextRows(t, s, tracker), 1, "a")
+
+	// The master resends the whole transaction, events already delivered are skipped
+	m.KillConnections()
+	m.AppendEvents(fakemaster.NewXidEvent(1))
+	if gtid, err = fakemaster.NewGTIDEvent(testSID + ":2"); nil != err {
+		t.Fatal(err)
+	}
+	m.AppendEvents(gtid)
+	appendInsert(t, m, 2, "b")
+	checkRow(t, nextRows(t, s, tracker), 2, "b")
+	if want := testSID + ":1"; want != tracker.Point().Gtid {
+		t.Errorf("unexpected gtid set %s, want %s", tracker.Point().Gtid, want)
+	}
+}
+
+func TestSlaveFailover(t *testing.T) {
+	m1 := newTestMaster(t, false)
+	defer m1.Close()
+	m2 := newTestMaster(t, false)
+	defer m2.Close()
+
+	dss := []mconn.DataSource{m1.DataSource(), m2.DataSource()}
+	s := NewSlave(dss, &mconn.ReplicationConfig{SlaveID: 100}, nil)
+	if err := s.Start(mconn.ReplicationPoint{Filename: "mysql-bin.000001"}); nil != err {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	// Both masters have the same binlog
+	appendInsert(t, m1, 1, "a")
+	appendInsert(t, m2, 1, "a")
+	checkRow(t, nextRows(t, s, nil), 1, "a")
+
+	m1.Close()
+	appendInsert(t, m2, 2, "b")
+	checkRow(t, nextRows(t, s, nil), 2, "b")
+	if 1 != s.GetDataSourceIndex() {
+		t.Errorf("unexpected data source index %d", s.GetDataSourceIndex())
+	}
+}
+
+func TestSlaveNonBlock(t *testing.T) {
+	m := newTestMaster(t, true)
+	defer m.Close()
+	appendInsert(t, m, 1, "a")
+
+	s := NewSlave([]mconn.DataSource{m.DataSource()},
+		&mconn.ReplicationConfig{SlaveID: 100, NonBlock: true}, nil)
+	if err := s.Start(mconn.ReplicationPoint{Filename: "mysql-bin.000001"}); nil != err {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	tracker, _ := NewPointTracker(mconn.ReplicationPoint{}, "")
+	checkRow(t, nextRows(t, s, tracker), 1, "a")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		ev, err := s.Next(ctx)
+		if io.EOF == err {
+			break
+		}
+		if nil != err {
+			t.Fatal(err)
+		}
+		tracker.OnEvent(ev)
+	}
+	if pos, end := tracker.Point(), m.Point(); pos.Filename != end.Filename || pos.Offset != end.Offset {
+		t.Errorf("unexpected end point %v, want %v", pos, end)
+	}
+}
+
+func TestSlaveRelayLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "relay")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Rotate the relay log for each transaction
+	relayLogSizeUnit = 1
+	defer func() {
+		relayLogSizeUnit = 1 << 20
+	}()
+
+	m := newTestMaster(t, true)
+	defer m.Close()
+	appendInsert(t, m, 1, "a")
+	appendInsert(t, m, 2, "b")
+
+	rc := &mconn.ReplicationConfig{SlaveID: 100, NonBlock: true}
+	rc.RelayLog.Dir = dir
+	rc.RelayLog.MaxFileSize = 256
+	s := NewSlave([]mconn.DataSource{m.DataSource()}, rc, nil)
+	if err = s.Start(mconn.ReplicationPoint{Filename: "mysql-bin.000001"}); nil != err {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	tracker, _ := NewPointTracker(mconn.ReplicationPoint{}, "")
+	checkRow(t, nextRows(t, s, tracker), 1, "a")
+	checkRow(t, nextRows(t, s, tracker), 2, "b")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		ev, err := s.Next(ctx)
+		if io.EOF == err {
+			break
+		}
+		if nil != err {
+			t.Fatal(err)
+		}
+		tracker.OnEvent(ev)
+	}
+	if pos, end := tracker.Point(), m.Point(); pos.Filename != end.Filename || pos.Offset != end.Offset {
+		t.Errorf("unexpected end point %v, want %v", pos, end)
+	}
+
+	// Consumed relay log files are purged
+	index, err := ioutil.ReadFile(filepath.Join(dir, defaultRelayLogBaseName+relayLogIndexSuffix))
+	if nil != err {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, defaultRelayLogBaseName+".0*"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(files) || filepath.Base(files[0])+"\n" != string(index) {
+		t.Errorf("unexpected relay log files %v, index %q", files, index)
+	}
+}
+
+func TestSlaveRelayLogRecovery(t *testing.T) {
+	for _, gtid := range []bool{false, true} {
+		testSlaveRelayLogRecovery(t, gtid)
+	}
+}
+
+// testSlaveRelayLogRecovery restarts the slave with the torn relay log. Relayed events
+// are consumed from the relay log, so the new master only needs the last binlog file
+// with file positions, and transactions relayed are not fetched again with gtids
+func testSlaveRelayLogRecovery(t *testing.T, gtid bool) {
+	dir, err := ioutil.TempDir("", "relay")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := newTestMaster(t, true)
+	insert := func(id int32, name string) {
+		if gtid {
+			ev, err := fakemaster.NewGTIDEvent(fmt.Sprintf("%s:%d", testSID, id))
+			if nil != err {
+				t.Fatal(err)
+			}
+			m.AppendEvents(ev)
+		}
+		appendInsert(t, m, id, name)
+	}
+	insert(1, "a")
+	insert(2, "b")
+	first := m.Point().Filename
+	m.Rotate()
+	insert(3, "c")
+	end := m.Point()
+
+	rc := &mconn.ReplicationConfig{SlaveID: 100, NonBlock: true, EnableGtid: gtid}
+	rc.RelayLog.Dir = dir
+	s := NewSlave([]mconn.DataSource{m.DataSource()}, rc, nil)
+	if err = s.Start(mconn.ReplicationPoint{Filename: first}); nil != err {
+		t.Fatal(err)
+	}
+	tracker, _ := NewPointTracker(mconn.ReplicationPoint{}, s.GTIDFlavor())
+	checkRow(t, nextRows(t, s, tracker), 1, "a")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ev, err := s.Next(ctx)
+	if nil != err || binlog.XidEventType != ev.Header.EventType {
+		t.Fatalf("unexpected event %v, error %v", ev, err)
+	}
+	tracker.OnEvent(ev)
+	// Wait until all events are relayed
+	for {
+		s.relay.mu.Lock()
+		point := s.relay.point
+		s.relay.mu.Unlock()
+		if point.Filename == end.Filename && point.Offset == end.Offset {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			{
+				t.Fatalf("events are not relayed, relay point %v", point)
+			}
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	s.Stop()
+
+	// The last transaction is torn
+	files, err := filepath.Glob(filepath.Join(dir, defaultRelayLogBaseName+".0*"))
+	if nil != err || 0 == len(files) {
+		t.Fatalf("unexpected relay log files %v, error %v", files, err)
+	}
+	last := files[len(files)-1]
+	fi, err := os.Stat(last)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err = os.Truncate(last, fi.Size()-5); nil != err {
+		t.Fatal(err)
+	}
+	if err = m.SaveBinlogFiles(dir); nil != err {
+		t.Fatal(err)
+	}
+	m.Close()
+	m, err = fakemaster.NewMaster(&fakemaster.Config{Checksum: true, BinlogBase: "master-bin"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	names := []string{end.Filename}
+	if gtid {
+		names = []string{first, end.Filename}
+	}
+	for _, name := range names {
+		if err = m.LoadBinlogFile(filepath.Join(dir, name)); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	s = NewSlave([]mconn.DataSource{m.DataSource()}, rc, nil)
+	if err = s.Start(tracker.Point()); nil != err {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	var ids []interface{}
+	for {
+		ev, err := s.Next(ctx)
+		if io.EOF == err {
+			break
+		}
+		if nil != err {
+			t.Fatal(err)
+		}
+		if nil != ev.Payload.Rows {
+			ids = append(ids, ev.Payload.Rows.Rows[0].ColumnDatas[0])
+		}
+	}
+	if "[2 3]" != fmt.Sprint(ids) {
+		t.Errorf("gtid %v: unexpected ids %v", gtid, ids)
+	}
+}
+
+// newCorruptedMaster returns a master serves a binlog file of two inserts, the rows event
+// of the first insert is corrupted
+func newCorruptedMaster(t *testing.T, dir string) *fakemaster.Master {
+	src := newTestMaster(t, true)
+	appendInsert(t, src, 1, "a")
+	appendInsert(t, src, 2, "b")
+	src.Close()
+	if err := src.SaveBinlogFiles(dir); nil != err {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, src.Point().Filename)
+	r, err := binlog.NewFileReader(path, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	for {
+		ev, err := r.Next()
+		if nil != err {
+			t.Fatal(err)
+		}
+		if nil != ev.Payload.Rows {
+			break
+		}
+	}
+	r.Close()
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	// Flip a bit of the row data
+	data[r.NextOffset()-5] ^= 0x01
+	if err = ioutil.WriteFile(path, data, 0644); nil != err {
+		t.Fatal(err)
+	}
+
+	m, err := fakemaster.NewMaster(&fakemaster.Config{Checksum: true, BinlogBase: "master-bin"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err = m.LoadBinlogFile(path); nil != err {
+		m.Close()
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestSlaveChecksumPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlog")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, policy := range []string{mconn.ChecksumPolicyFail, mconn.ChecksumPolicySkip, mconn.ChecksumPolicyReconnect} {
+		m := newCorruptedMaster(t, dir)
+		s := NewSlave([]mconn.DataSource{m.DataSource()},
+			&mconn.ReplicationConfig{SlaveID: 100, NonBlock: true, ChecksumPolicy: policy}, nil)
+		if err = s.Start(mconn.ReplicationPoint{Filename: "mysql-bin.000001"}); nil != err {
+			t.Fatal(err)
+		}
+
+		var ids []interface{}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		for {
+			var ev *binlog.Event
+			if ev, err = s.Next(ctx); nil != err {
+				break
+			}
+			if nil != ev.Payload.Rows {
+				ids = append(ids, ev.Payload.Rows.Rows[0].ColumnDatas[0])
+			}
+		}
+		cancel()
+
+		switch policy {
+		case mconn.ChecksumPolicySkip:
+			{
+				if io.EOF != err || "[2]" != fmt.Sprint(ids) {
+					t.Errorf("policy %s: unexpected rows %v, error %v", policy, ids, err)
+				}
+			}
+		default:
+			{
+				if !binlog.IsChecksumError(err) || 0 != len(ids) {
+					t.Errorf("policy %s: unexpected rows %v, error %v", policy, ids, err)
+				}
+			}
+		}
+		dumps := 1
+		if mconn.ChecksumPolicyReconnect == policy {
+			dumps = 2
+		}
+		if m.Dumps() != dumps || int64(dumps) != s.ChecksumErrors() {
+			t.Errorf("policy %s: unexpected dumps %d, checksum errors %d", policy, m.Dumps(), s.ChecksumErrors())
+		}
+		s.Stop()
+		m.Close()
+	}
+}
+
+func TestSlaveTransactionPayload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "relay")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := newTestMaster(t, true)
+	defer m.Close()
+	rows, err := testTable.NewWriteRowsEvent([]interface{}{int32(1), "a"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	payload, err := fakemaster.NewTransactionPayloadEvent(fakemaster.NewQueryEvent("test", "BEGIN"),
+		testTable.NewTableMapEvent(), rows, fakemaster.NewXidEvent(1))
+	if nil != err {
+		t.Fatal(err)
+	}
+	m.AppendEvents(payload)
+	appendInsert(t, m, 2, "b")
+
+	// Inner events are delivered with and without the relay log
+	for _, relayDir := range []string{"", dir} {
+		rc := &mconn.ReplicationConfig{SlaveID: 100, NonBlock: true}
+		rc.RelayLog.Dir = relayDir
+		s := NewSlave([]mconn.DataSource{m.DataSource()}, rc, nil)
+		if err = s.Start(mconn.ReplicationPoint{Filename: "mysql-bin.000001"}); nil != err {
+			t.Fatal(err)
+		}
+
+		tracker, _ := NewPointTracker(mconn.ReplicationPoint{}, "")
+		checkRow(t, nextRows(t, s, tracker), 1, "a")
+		checkRow(t, nextRows(t, s, tracker), 2, "b")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		for {
+			ev, err := s.Next(ctx)
+			if io.EOF == err {
+				break
+			}
+			if nil != err {
+				t.Fatal(err)
+			}
+			if binlog.TransactionPayloadEventType == ev.Header.EventType {
+				t.Errorf("relay dir %q: unexpected transaction payload event", relayDir)
+			}
+			tracker.OnEvent(ev)
+		}
+		cancel()
+		s.Stop()
+		if pos, end := tracker.Point(), m.Point(); pos.Filename != end.Filename || pos.Offset != end.Offset {
+			t.Errorf("relay dir %q: unexpected end point %v, want %v", relayDir, pos, end)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package slave
+
+import (
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/binlog"
+	"github.com/sryanyuan/binp/mconn"
+)
+
+// stopChecker checks whether the binlog stream reaches the stop condition
+type stopChecker struct {
+	cond mconn.StopCondition
+	gset mconn.GTIDSet
+	// txnBoundary is true if the next event starts a new transaction
+	txnBoundary bool
+	txn         txnTracker
+}
+
+func newStopChecker(cond mconn.StopCondition, flavor string) (*stopChecker, error) {
+	c := &stopChecker{
+		cond:        cond,
+		txnBoundary: true,
+	}
+	if "" != cond.StopGtid {
+		if "" == flavor {
+			return nil, errors.New("stop gtid requires gtid replication")
+		}
+		gset, err := mconn.ParseGTIDSet(flavor, cond.StopGtid)
+		if nil != err {
+			return nil, errors.Annotate(err, "invalid stop gtid")
+		}
+		c.gset = gset
+	}
+	return c, nil
+}
+
+// before returns true if the event must not be delivered
+func (c *stopChecker) before(event *binlog.Event) bool {
+	boundary := c.txnBoundary
+	switch event.Header.EventType {
+	case binlog.XidEventType, binlog.XAPrepareLogEventType, binlog.QueryEventType,
+		binlog.GTIDEventType, binlog.AnonymousGtidEventType, binlog.MariadbGTIDEventType:
+		{
+			c.txnBoundary = c.txn.onEvent(event)
+		}
+	case binlog.RotateEventType, binlog.FormatDescriptionEventType, binlog.HeartbeatEventType,
+		binlog.PreviousGtidsEventType, binlog.MariadbGTIDListEventType, binlog.MariadbBinlogCheckpointEventType:
+		{
+			return false
+		}
+	}
+
+	if 0 == c.cond.StopTimestamp || !boundary {
+		return false
+	}
+	return event.Header.Timestamp > c.cond.StopTimestamp
+}
+
+// after returns true if the stream stops after the event is delivered, binlog
+// files are compared by name as their sequence suffixes have the same width.
+// The stream stops at the position after the transaction is ended
+func (c *stopChecker) after(t *PointTracker) bool {
+	point := t.Point()
+	if "" != c.cond.StopFile && "" != point.Filename && c.txnBoundary {
+		if point.Filename > c.cond.StopFile ||
+			(point.Filename == c.cond.StopFile && point.Offset >= c.cond.StopPos) {
+			return true
+		}
+	}
+	if nil != c.gset && nil != t.gset {
+		return t.gset.Contain(c.gset)
+	}
+	return false
+}
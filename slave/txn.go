@@ -0,0 +1,58 @@
+package slave
+
+import (
+	"strings"
+
+	"github.com/sryanyuan/binp/binlog"
+)
+
+// txnTracker tracks the transaction boundaries of the binlog stream
+type txnTracker struct {
+	// open is true inside BEGIN, XA START or the transactional mariadb gtid
+	open bool
+}
+
+// onEvent returns true if the event ends the event group, statements inside the
+// open transaction don't end it, but a statement outside does, like DDL
+func (t *txnTracker) onEvent(event *binlog.Event) bool {
+	switch event.Header.EventType {
+	case binlog.GTIDEventType, binlog.AnonymousGtidEventType:
+		{
+			t.open = false
+		}
+	case binlog.MariadbGTIDEventType:
+		{
+			// The transactional mariadb event group has no BEGIN
+			t.open = 0 == event.Payload.MariadbGTID.Flags&binlog.MariadbGTIDFlagStandalone
+		}
+	case binlog.XidEventType, binlog.XAPrepareLogEventType:
+		{
+			t.open = false
+			return true
+		}
+	case binlog.QueryEventType:
+		{
+			query := strings.TrimSpace(event.Payload.Query.Query)
+			switch {
+			case strings.EqualFold(query, "BEGIN"), hasPrefixFold(query, "XA START"),
+				hasPrefixFold(query, "XA BEGIN"):
+				{
+					t.open = true
+					return false
+				}
+			case strings.EqualFold(query, "COMMIT"), strings.EqualFold(query, "ROLLBACK"),
+				hasPrefixFold(query, "XA COMMIT"), hasPrefixFold(query, "XA ROLLBACK"):
+				{
+					t.open = false
+					return true
+				}
+			}
+			return !t.open
+		}
+	}
+	return false
+}
+
+func hasPrefixFold(s string, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
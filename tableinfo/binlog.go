@@ -0,0 +1,94 @@
+package tableinfo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/sryanyuan/binp/binlog"
+	"github.com/sryanyuan/binp/mconn"
+)
+
+var (
+	binlogTypeNames = map[uint8]string{
+		mconn.FieldTypeTiny:       "tinyint",
+		mconn.FieldTypeShort:      "smallint",
+		mconn.FieldTypeInt24:      "mediumint",
+		mconn.FieldTypeLong:       "int",
+		mconn.FieldTypeLongLong:   "bigint",
+		mconn.FieldTypeFloat:      "float",
+		mconn.FieldTypeDouble:     "double",
+		mconn.FieldTypeNewDecimal: "decimal",
+		mconn.FieldTypeYear:       "year",
+		mconn.FieldTypeDate:       "date",
+		mconn.FieldTypeTime2:      "time",
+		mconn.FieldTypeDateTime2:  "datetime",
+		mconn.FieldTypeTimestamp2: "timestamp",
+		mconn.FieldTypeBit:        "bit",
+		mconn.FieldTypeString:     "char",
+		mconn.FieldTypeVarChar:    "varchar",
+		mconn.FieldTypeVarString:  "varchar",
+		mconn.FieldTypeBlob:       "blob",
+		mconn.FieldTypeJSON:       "json",
+		mconn.FieldTypeGeometry:   "geometry",
+	}
+)
+
+// NewTableInfoFromTableMap builds the table info from the optional metadata of the table
+// map event, so the table info matches the event even if the table is altered later
+func NewTableInfoFromTableMap(e *binlog.TableMapEvent) (*TableInfo, error) {
+	if !e.HasFullMetadata() {
+		return nil, errors.Errorf("table %s.%s is not logged with full metadata", e.SchemaName, e.TableName)
+	}
+	ti := &TableInfo{
+		Schema:        e.SchemaName,
+		Name:          e.TableName,
+		Columns:       make([]*ColumnInfo, 0, e.ColumnCount),
+		BinlogColumns: int(e.ColumnCount),
+	}
+	for i := 0; i < int(e.ColumnCount); i++ {
+		column := &ColumnInfo{
+			Index:    i,
+			Name:     e.ColumnName[i],
+			Nullable: 0 != e.NullBitmask[i/8]&(1<<uint(i%8)),
+		}
+		if nil != e.ColumnUnsigned {
+			column.Unsigned = e.ColumnUnsigned[i]
+		}
+		if nil != e.EnumSetValues {
+			column.Elems = e.EnumSetValues[i]
+		}
+		if nil != e.ColumnCharset && 0 != e.ColumnCharset[i] {
+			column.Charset = CharsetOfCollationID(e.ColumnCharset[i])
+		}
+		column.Type = binlogColumnType(e.RealType(i), column)
+		ti.Columns = append(ti.Columns, column)
+	}
+	for _, col := range e.PrimaryKey {
+		ti.Columns[col].IsPrimary = true
+	}
+	return ti, nil
+}
+
+// binlogColumnType returns the column type like SHOW COLUMNS without the length
+func binlogColumnType(tp uint8, column *ColumnInfo) string {
+	if mconn.FieldTypeEnum == tp || mconn.FieldTypeSet == tp {
+		elems := make([]string, 0, len(column.Elems))
+		for _, elem := range column.Elems {
+			elems = append(elems, "'"+strings.Replace(elem, "'", "''", -1)+"'")
+		}
+		name := "enum"
+		if mconn.FieldTypeSet == tp {
+			name = "set"
+		}
+		return fmt.Sprintf("%s(%s)", name, strings.Join(elems, ","))
+	}
+	name, ok := binlogTypeNames[tp]
+	if !ok {
+		name = fmt.Sprintf("type%d", tp)
+	}
+	if column.Unsigned {
+		name += " unsigned"
+	}
+	return name
+}
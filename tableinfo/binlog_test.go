@@ -0,0 +1,47 @@
+package tableinfo
+
+import (
+	"testing"
+
+	"github.com/sryanyuan/binp/binlog"
+	"github.com/sryanyuan/binp/mconn"
+)
+
+func TestNewTableInfoFromTableMap(t *testing.T) {
+	e := &binlog.TableMapEvent{
+		SchemaName:     "d",
+		TableName:      "t",
+		ColumnCount:    3,
+		ColumnDefine:   []byte{mconn.FieldTypeLong, mconn.FieldTypeVarChar, mconn.FieldTypeString},
+		ColumnMeta:     []uint16{0, 40, uint16(mconn.FieldTypeEnum)<<8 | 1},
+		NullBitmask:    []byte{0x06},
+		ColumnName:     []string{"id", "name", "status"},
+		ColumnUnsigned: []bool{true, false, false},
+		EnumSetValues:  [][]string{nil, nil, {"active", "it's"}},
+		PrimaryKey:     []int{0},
+	}
+	ti, err := NewTableInfoFromTableMap(e)
+	if nil != err {
+		t.Fatal(err)
+	}
+	for i, want := range []ColumnInfo{
+		{Index: 0, Name: "id", Type: "int unsigned", IsPrimary: true, Unsigned: true},
+		{Index: 1, Name: "name", Type: "varchar", Nullable: true},
+		{Index: 2, Name: "status", Type: "enum('active','it''s')", Nullable: true},
+	} {
+		c := ti.Columns[i]
+		if want.Index != c.Index || want.Name != c.Name || want.Type != c.Type || want.IsPrimary != c.IsPrimary ||
+			want.Unsigned != c.Unsigned || want.Nullable != c.Nullable {
+			t.Errorf("unexpected column %+v, want %+v", c, want)
+		}
+	}
+	cv := &ColumnWithValue{Column: ti.Columns[2], Value: int32(2)}
+	if "it's" != cv.ValueToLabel() {
+		t.Errorf("unexpected label %v", cv.ValueToLabel())
+	}
+
+	e.ColumnName = nil
+	if _, err := NewTableInfoFromTableMap(e); nil == err {
+		t.Error("table info is built without column names")
+	}
+}
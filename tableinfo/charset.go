@@ -0,0 +1,143 @@
+package tableinfo
+
+import (
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+)
+
+// Charset of the binary strings
+const (
+	CharsetBinary = "binary"
+)
+
+var (
+	// charsetEncodings are the encodings of the mysql charsets need to be transcoded,
+	// utf8, utf8mb4 and ascii are not transcoded
+	charsetEncodings = map[string]encoding.Encoding{
+		// latin1 of mysql is cp1252 actually
+		"latin1":  charmap.Windows1252,
+		"latin2":  charmap.ISO8859_2,
+		"latin5":  charmap.ISO8859_9,
+		"latin7":  charmap.ISO8859_13,
+		"greek":   charmap.ISO8859_7,
+		"hebrew":  charmap.ISO8859_8,
+		"koi8r":   charmap.KOI8R,
+		"koi8u":   charmap.KOI8U,
+		"cp1250":  charmap.Windows1250,
+		"cp1251":  charmap.Windows1251,
+		"cp1256":  charmap.Windows1256,
+		"cp1257":  charmap.Windows1257,
+		"cp850":   charmap.CodePage850,
+		"cp866":   charmap.CodePage866,
+		"tis620":  charmap.Windows874,
+		"gb2312":  simplifiedchinese.GBK,
+		"gbk":     simplifiedchinese.GBK,
+		"gb18030": simplifiedchinese.GB18030,
+		"big5":    traditionalchinese.Big5,
+		"sjis":    japanese.ShiftJIS,
+		"cp932":   japanese.ShiftJIS,
+		"ujis":    japanese.EUCJP,
+		"eucjpms": japanese.EUCJP,
+		"euckr":   korean.EUCKR,
+		"ucs2":    unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+		"utf16":   unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+		"utf16le": unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+		"utf32":   utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM),
+	}
+
+	// collationCharsets are the charsets of the collation ids logged in the table map event,
+	// see information_schema.COLLATIONS
+	collationCharsets = map[uint64]string{
+		1: "big5", 84: "big5",
+		2: "latin2", 9: "latin2", 21: "latin2", 27: "latin2", 77: "latin2",
+		4: "cp850", 80: "cp850",
+		5: "latin1", 8: "latin1", 15: "latin1", 31: "latin1", 47: "latin1", 48: "latin1", 49: "latin1", 94: "latin1",
+		7: "koi8r", 74: "koi8r",
+		11: "ascii", 65: "ascii",
+		12: "ujis", 91: "ujis",
+		13: "sjis", 88: "sjis",
+		14: "cp1251", 23: "cp1251", 50: "cp1251", 51: "cp1251", 52: "cp1251",
+		16: "hebrew", 71: "hebrew",
+		18: "tis620", 89: "tis620",
+		19: "euckr", 85: "euckr",
+		20: "latin7", 41: "latin7", 42: "latin7", 79: "latin7",
+		22: "koi8u", 75: "koi8u",
+		24: "gb2312", 86: "gb2312",
+		25: "greek", 70: "greek",
+		26: "cp1250", 34: "cp1250", 44: "cp1250", 66: "cp1250", 99: "cp1250",
+		28: "gbk", 87: "gbk",
+		29: "cp1257", 58: "cp1257", 59: "cp1257",
+		30: "latin5", 78: "latin5",
+		33: "utf8", 76: "utf8", 83: "utf8",
+		35: "ucs2", 90: "ucs2",
+		45: "utf8mb4", 46: "utf8mb4",
+		54: "utf16", 55: "utf16",
+		56: "utf16le", 62: "utf16le",
+		57: "cp1256", 67: "cp1256",
+		60: "utf32", 61: "utf32",
+		63: CharsetBinary,
+		95: "cp932", 96: "cp932",
+		97: "eucjpms", 98: "eucjpms",
+		248: "gb18030", 249: "gb18030", 250: "gb18030",
+	}
+)
+
+// collationRanges are the ranges of the unicode collation ids
+var collationRanges = []struct {
+	from, to uint64
+	charset  string
+}{
+	{101, 124, "utf16"},
+	{128, 151, "ucs2"},
+	{160, 183, "utf32"},
+	{192, 223, "utf8"},
+	{224, 247, "utf8mb4"},
+	{255, 323, "utf8mb4"},
+}
+
+// CharsetOfCollationID returns the charset of the collation id, returns empty if unknown
+func CharsetOfCollationID(id uint64) string {
+	if charset, ok := collationCharsets[id]; ok {
+		return charset
+	}
+	for _, r := range collationRanges {
+		if id >= r.from && id <= r.to {
+			return r.charset
+		}
+	}
+	return ""
+}
+
+// CharsetOfCollation returns the charset of the collation name like utf8mb4_general_ci
+func CharsetOfCollation(name string) string {
+	if i := strings.IndexByte(name, '_'); i >= 0 {
+		return strings.ToLower(name[:i])
+	}
+	return strings.ToLower(name)
+}
+
+// decodeText transcodes the text value of the column to utf-8, binary strings and values
+// failed to transcode are returned as is
+func (c *ColumnInfo) decodeText(v interface{}) interface{} {
+	data, ok := v.([]byte)
+	if !ok || "" == c.Charset {
+		return v
+	}
+	enc, ok := charsetEncodings[c.Charset]
+	if !ok {
+		return v
+	}
+	text, err := enc.NewDecoder().Bytes(data)
+	if nil != err {
+		return v
+	}
+	return text
+}
@@ -0,0 +1,46 @@
+package tableinfo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFillColumnsWithCharset(t *testing.T) {
+	ti := &TableInfo{
+		Columns: []*ColumnInfo{
+			{Name: "l", Charset: CharsetOfCollationID(8)},
+			{Name: "g", Charset: CharsetOfCollation("gbk_chinese_ci")},
+			{Name: "u", Charset: CharsetOfCollationID(255)},
+			{Name: "b", Charset: CharsetOfCollationID(63)},
+			{Name: "n", Charset: CharsetOfCollation("latin1_bin")},
+			{Name: "i"},
+		},
+	}
+	values := []interface{}{
+		[]byte("caf\xe9"),
+		[]byte("\xc4\xe3\xba\xc3"),
+		[]byte("caf\xc3\xa9"),
+		[]byte{0xe9, 0x00, 0xff},
+		nil,
+		int32(1),
+	}
+	want := []interface{}{
+		[]byte("café"),
+		[]byte("你好"),
+		[]byte("café"),
+		[]byte{0xe9, 0x00, 0xff},
+		nil,
+		int32(1),
+	}
+	for i, cv := range FillColumnsWithValue(ti, values, nil) {
+		if !reflect.DeepEqual(want[i], cv.Value) {
+			t.Errorf("unexpected value %q of column %s, want %q", cv.Value, cv.Column.Name, want[i])
+		}
+	}
+	if "utf8mb4" != CharsetOfCollation("utf8mb4_0900_ai_ci") || CharsetBinary != CharsetOfCollation("binary") {
+		t.Error("unexpected charset of collation")
+	}
+	if "" != CharsetOfCollationID(1000) {
+		t.Error("unknown collation id has charset")
+	}
+}
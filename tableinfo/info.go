@@ -3,6 +3,9 @@ package tableinfo
 import (
 	"fmt"
 	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
 )
 
 // ColumnInfo hold column base info
@@ -16,12 +19,18 @@ type ColumnInfo struct {
 	HasDefault    bool
 	Unsigned      bool
 	AutoIncrement bool
+	// Elems are the members of enum and set columns
+	Elems []string
+	// Charset of the text columns, text values are transcoded to utf-8
+	Charset string
 }
 
 // ColumnWithValue holds column value
 type ColumnWithValue struct {
 	Column *ColumnInfo
 	Value  interface{}
+	// Present is false if the column is not logged in the row image, the value is not null
+	Present bool
 }
 
 // ValueToString converts value to string type
@@ -102,6 +111,110 @@ func (c *ColumnWithValue) ValueToString() string {
 	}
 }
 
+// ValueToLabel converts the index of enum and the bitmask of set to the string labels,
+// other values are returned as is
+func (c *ColumnWithValue) ValueToLabel() interface{} {
+	if 0 == len(c.Column.Elems) {
+		return c.Value
+	}
+	var n uint64
+	switch av := c.Value.(type) {
+	case int32:
+		{
+			n = uint64(av)
+		}
+	case uint32:
+		{
+			n = uint64(av)
+		}
+	case int64:
+		{
+			n = uint64(av)
+		}
+	case uint64:
+		{
+			n = av
+		}
+	default:
+		{
+			return c.Value
+		}
+	}
+
+	if isEnumType(c.Column.Type) {
+		// Index 0 is the empty string of the invalid value
+		if 0 == n {
+			return ""
+		}
+		if n > uint64(len(c.Column.Elems)) {
+			return c.Value
+		}
+		return c.Column.Elems[n-1]
+	}
+	if n>>uint(len(c.Column.Elems)) != 0 {
+		return c.Value
+	}
+	labels := make([]string, 0, len(c.Column.Elems))
+	for i, elem := range c.Column.Elems {
+		if 0 != n&(1<<uint(i)) {
+			labels = append(labels, elem)
+		}
+	}
+	return strings.Join(labels, ",")
+}
+
+func isEnumType(tp string) bool {
+	return strings.HasPrefix(strings.ToLower(tp), "enum(")
+}
+
+func isSetType(tp string) bool {
+	return strings.HasPrefix(strings.ToLower(tp), "set(")
+}
+
+// parseElems parses the members of the enum or set column type like enum('a','b'), quotes are escaped by doubling
+func parseElems(tp string) ([]string, error) {
+	if !isEnumType(tp) && !isSetType(tp) {
+		return nil, nil
+	}
+	s := tp[strings.IndexByte(tp, '(')+1:]
+	var elems []string
+	for {
+		if !strings.HasPrefix(s, "'") {
+			return nil, errors.Errorf("invalid members of column type %s", tp)
+		}
+		var elem strings.Builder
+		i := 1
+		for ; i < len(s); i++ {
+			if '\\' == s[i] && i+1 < len(s) {
+				i++
+				elem.WriteByte(s[i])
+				continue
+			}
+			if '\'' == s[i] {
+				if i+1 < len(s) && '\'' == s[i+1] {
+					i++
+					elem.WriteByte('\'')
+					continue
+				}
+				break
+			}
+			elem.WriteByte(s[i])
+		}
+		if i >= len(s) {
+			return nil, errors.Errorf("unterminated member of column type %s", tp)
+		}
+		elems = append(elems, elem.String())
+		s = s[i+1:]
+		if strings.HasPrefix(s, ")") {
+			return elems, nil
+		}
+		if !strings.HasPrefix(s, ",") {
+			return nil, errors.Errorf("invalid members of column type %s", tp)
+		}
+		s = s[1:]
+	}
+}
+
 // TableInfo hold column info
 type TableInfo struct {
 	Schema       string
@@ -114,16 +227,18 @@ type TableInfo struct {
 
 // FillColumnsWithValue fills columns value with binlog value
 // final columns count is determined by binlog columns, so make sure
-// binlog columns count is not greater than table info columns (panic)
-func FillColumnsWithValue(ti *TableInfo, values []interface{}) []*ColumnWithValue {
+// binlog columns count is not greater than table info columns (panic).
+// present marks the columns logged in the row image, all columns are present if it is nil
+func FillColumnsWithValue(ti *TableInfo, values []interface{}, present []bool) []*ColumnWithValue {
 	if len(ti.Columns) < len(values) {
 		panic("Table columns count not equal to values count")
 	}
 	cwvs := make([]*ColumnWithValue, 0, len(values))
 	for i := range values {
 		cw := &ColumnWithValue{
-			Column: ti.Columns[i],
-			Value:  convertUnsigned(values[i], ti.Columns[i].Unsigned),
+			Column:  ti.Columns[i],
+			Value:   ti.Columns[i].decodeText(convertUnsigned(values[i], ti.Columns[i].Unsigned)),
+			Present: nil == present || present[i],
 		}
 		cwvs = append(cwvs, cw)
 	}
@@ -0,0 +1,42 @@
+package tableinfo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValueToLabel(t *testing.T) {
+	elems, err := parseElems(`enum('active','it''s','a\\b','x,y')`)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if want := []string{"active", "it's", `a\b`, "x,y"}; !reflect.DeepEqual(want, elems) {
+		t.Fatalf("unexpected elems %q", elems)
+	}
+	enum := &ColumnInfo{Type: "enum('active','deleted')", Elems: []string{"active", "deleted"}}
+	set := &ColumnInfo{Type: "set('a','b','c')", Elems: []string{"a", "b", "c"}}
+	cases := []struct {
+		column *ColumnInfo
+		value  interface{}
+		want   interface{}
+	}{
+		{enum, int32(2), "deleted"},
+		{enum, int32(0), ""},
+		{enum, int32(3), int32(3)},
+		{enum, nil, nil},
+		{set, uint64(5), "a,c"},
+		{set, uint64(0), ""},
+		{set, uint64(8), uint64(8)},
+		{&ColumnInfo{Type: "int(11)"}, int32(1), int32(1)},
+	}
+	for _, c := range cases {
+		cv := &ColumnWithValue{Column: c.column, Value: c.value}
+		if v := cv.ValueToLabel(); !reflect.DeepEqual(c.want, v) {
+			t.Errorf("unexpected label %v of %v in %s", v, c.value, c.column.Type)
+		}
+	}
+
+	if _, err := parseElems("set('a',b)"); nil == err {
+		t.Error("invalid set type is parsed")
+	}
+}
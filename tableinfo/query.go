@@ -22,7 +22,8 @@ func GetTableInfo(db *sql.DB, schema string, table string) (*TableInfo, error) {
 
 // GetTableColumnInfo get columns info from database
 func (ti *TableInfo) GetTableColumnInfo(db *sql.DB, schema string, table string) error {
-	rs, err := retryQuery(db, fmt.Sprintf("SHOW COLUMNS FROM %s.%s", schema, table))
+	// Field, Type, Collation, Null, Key, Default, Extra, Privileges, Comment
+	rs, err := retryQuery(db, fmt.Sprintf("SHOW FULL COLUMNS FROM %s.%s", schema, table))
 	if nil != err {
 		return errors.Trace(err)
 	}
@@ -53,17 +54,23 @@ func (ti *TableInfo) GetTableColumnInfo(db *sql.DB, schema string, table string)
 		column.Index = columnIndex
 		column.Name = string(datas[0])
 		column.Type = string(datas[1])
-		if strings.EqualFold(string(datas[2]), "NO") {
+		if nil != datas[2] {
+			column.Charset = CharsetOfCollation(string(datas[2]))
+		}
+		if strings.EqualFold(string(datas[3]), "NO") {
 			column.Nullable = false
 		}
-		if nil != datas[4] {
+		if nil != datas[5] {
 			column.HasDefault = true
-			column.Default = string(datas[4])
+			column.Default = string(datas[5])
 		}
 
 		if strings.Contains(column.Type, "unsigned") {
 			column.Unsigned = true
 		}
+		if column.Elems, err = parseElems(column.Type); nil != err {
+			return errors.Trace(err)
+		}
 		ti.Columns = append(ti.Columns, &column)
 		columnIndex++
 	}
@@ -3,8 +3,11 @@ package utils
 import (
 	"database/sql"
 	"fmt"
+	"net"
+	"net/url"
 	"strings"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/juju/errors"
 	"github.com/sryanyuan/binp/mconn"
 )
@@ -18,6 +21,7 @@ type CreateDBOp struct {
 	charset           *string
 	interpolateParams *bool
 	timeout           *int
+	tls               *string
 }
 
 func (op *CreateDBOp) applyOpts(ops ...CreateDBOpFn) {
@@ -54,6 +58,13 @@ func (op *CreateDBOp) format() string {
 		options += fmt.Sprintf("timeout=%ds", *op.timeout)
 		prevs++
 	}
+	if nil != op.tls {
+		if prevs != 0 {
+			options += "&"
+		}
+		options += "tls=" + url.QueryEscape(*op.tls)
+		prevs++
+	}
 	return options
 }
 
@@ -90,16 +101,79 @@ func WithInterpolateParams(enable bool) CreateDBOpFn {
 	}
 }
 
+// WithTLS set the tls config name registered by mysql.RegisterTLSConfig to the connection
+func WithTLS(name string) CreateDBOpFn {
+	return func(op *CreateDBOp) {
+		if "" == name {
+			return
+		}
+		op.tls = &name
+		op.set = true
+	}
+}
+
+// registerTLSConfig registers the tls config of the db config to the mysql driver,
+// returns the registered name or empty string if tls is disabled
+func registerTLSConfig(dc *mconn.DBConfig) (string, error) {
+	cfg, err := dc.TLSConfig(dc.Host)
+	if nil != err {
+		return "", errors.Trace(err)
+	}
+	if nil == cfg {
+		return "", nil
+	}
+	// The driver can't fallback to plaintext, so preferred mode requires tls here
+	name := fmt.Sprintf("binp-%s-%d-%s", dc.Host, dc.Port, dc.Username)
+	if err = mysql.RegisterTLSConfig(name, cfg); nil != err {
+		return "", errors.Trace(err)
+	}
+	return name, nil
+}
+
+// registerDial registers the dialer of the db config to the mysql driver,
+// returns the network name and address used in dsn
+func registerDial(dc *mconn.DBConfig) (string, string, error) {
+	network := dc.Network()
+	addr := dc.Socket
+	if "" == addr {
+		addr = fmt.Sprintf("%s:%d", dc.Host, dc.Port)
+	}
+	if "" == dc.Dialer {
+		return network, addr, nil
+	}
+
+	fn := mconn.GetDialer(dc.Dialer)
+	if nil == fn {
+		return "", "", errors.Errorf("dialer %s not registered", dc.Dialer)
+	}
+	timeout := dc.Timeout()
+	name := fmt.Sprintf("binp-%s-%s-%d", dc.Dialer, network, int(timeout.Seconds()))
+	mysql.RegisterDial(name, func(addr string) (net.Conn, error) {
+		return fn(network, addr, timeout)
+	})
+	return name, addr, nil
+}
+
 // CreateDBWithArgs create a database connection with args
 func CreateDBWithArgs(dc *mconn.DBConfig, ops ...CreateDBOpFn) (*sql.DB, error) {
+	tlsName, err := registerTLSConfig(dc)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
+	network, addr, err := registerDial(dc)
+	if nil != err {
+		return nil, errors.Trace(err)
+	}
 	var op CreateDBOp
-	op.applyOpts(ops...)
+	// The connect timeout of the config is the default, callers may override it
+	op.applyOpts(WithTimeout(int(dc.Timeout().Seconds())))
+	op.applyOpts(append(ops, WithTLS(tlsName))...)
 
 	dtype := strings.ToLower(dc.Type)
 	switch dtype {
 	case "mysql":
 		{
-			dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/", dc.Username, dc.Password, dc.Host, dc.Port)
+			dsn := fmt.Sprintf("%s:%s@%s(%s)/", dc.Username, dc.Password, network, addr)
 			dsn += op.format()
 			db, err := sql.Open(dtype, dsn)
 			if nil != err {
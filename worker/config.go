@@ -18,4 +18,6 @@ type DestinationConfig struct {
 	// Backup database connection
 	DBs  []*mconn.DBConfig `json:"dbs" toml:"dbs"`
 	Text bool              `json:"text" toml:"text"`
+	// Write the labels of enum and set columns instead of the indexes
+	EnumLabels bool `json:"enum-labels" toml:"enum-labels"`
 }
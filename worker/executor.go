@@ -24,6 +24,9 @@ type WorkerEvent struct {
 	Columns    []*tableinfo.ColumnWithValue
 	NewColumns []*tableinfo.ColumnWithValue
 	SDesc      *rule.SyncDesc
+	// Logical clock of the transaction, zero if the master doesn't log it
+	LastCommitted  int64
+	SequenceNumber int64
 }
 
 // IJobExecutor define the interface of output destination
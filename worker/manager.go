@@ -35,6 +35,12 @@ type WorkerManager struct {
 	wg               sync.WaitGroup
 	jobWg            sync.WaitGroup
 	lastRplPointTime int64
+	// Sequence number of the last dispatched transaction and the lowest sequence number
+	// of the transactions dispatched since the last wait, zero if all are committed
+	clockSeq int64
+	clockLow int64
+	// Jobs are dispatched by table name since the last wait
+	clockFallback bool
 }
 
 // NewWorkerManager creates a new WorkerManager
@@ -131,6 +137,17 @@ func (w *WorkerManager) workerReportLoop() {
 	}
 }
 
+// Flush commits all dispatched jobs immediately and waits until they are committed
+func (w *WorkerManager) Flush() {
+	for _, wr := range w.workers {
+		wr.signalFlush()
+	}
+	w.jobWg.Wait()
+	w.lastRplPointTime = time.Now().Unix()
+	w.clockLow = 0
+	w.clockFallback = false
+}
+
 // DispatchWorkerEvent dispatchs WorkerEvent to worker, return true if replication point is checked
 func (w *WorkerManager) DispatchWorkerEvent(job *WorkerEvent, dispPolicy int) (bool, error) {
 	index := -1
@@ -146,24 +163,59 @@ func (w *WorkerManager) DispatchWorkerEvent(job *WorkerEvent, dispPolicy int) (b
 		}
 	} else if DispatchPolicyTableName == dispPolicy {
 		key = utils.GetTableKey(job.SDesc.RewriteSchema, job.SDesc.RewriteTable)
+	} else if DispatchPolicyLogicalClock == dispPolicy {
+		if index = w.logicalClockIndex(job); index < 0 {
+			// Dispatch by table name if the master doesn't log the logical clock
+			key = utils.GetTableKey(job.SDesc.RewriteSchema, job.SDesc.RewriteTable)
+		}
 	}
-	if "" == key {
-		return false, errors.Errorf("Can't get job dispatch key, dispatch policy = %d, job = %v", dispPolicy, job)
+	if index < 0 {
+		if "" == key {
+			return false, errors.Errorf("Can't get job dispatch key, dispatch policy = %d, job = %v", dispPolicy, job)
+		}
+		index = int(crc32.ChecksumIEEE([]byte(key))) % len(w.workers)
 	}
-	index = int(crc32.ChecksumIEEE([]byte(key))) % len(w.workers)
-	w.workers[index].push(job)
+	// Add before push, the job may be done before push returns
 	w.jobWg.Add(1)
+	w.workers[index].push(job)
 
 	// Need wait and write the lastest replication point
 	rplPointChecked := false
 	if rplPointChecked = w.needSaveRplPoint(); rplPointChecked {
-		w.jobWg.Wait()
-		w.lastRplPointTime = time.Now().Unix()
+		w.Flush()
 	}
 
 	return rplPointChecked, nil
 }
 
+// logicalClockIndex returns the worker index of the job by the logical clock, all jobs of a
+// transaction are dispatched to the same worker. A transaction waits until the transactions
+// dispatched before are committed if it depends on any of them, returns -1 without the logical clock
+func (w *WorkerManager) logicalClockIndex(job *WorkerEvent) int {
+	if job.SequenceNumber <= 0 {
+		// Transactions dispatched by the logical clock must be committed before
+		if 0 != w.clockLow {
+			w.Flush()
+		}
+		w.clockSeq = 0
+		w.clockFallback = true
+		return -1
+	}
+	if job.SequenceNumber != w.clockSeq {
+		// The sequence number restarts in the new binlog file, and jobs dispatched by
+		// table name are unordered with the logical clock
+		if job.SequenceNumber < w.clockSeq || w.clockFallback ||
+			(0 != w.clockLow && job.LastCommitted >= w.clockLow) {
+			w.Flush()
+		}
+		if 0 == w.clockLow {
+			w.clockLow = job.SequenceNumber
+		}
+		w.clockSeq = job.SequenceNumber
+	}
+	return int(job.SequenceNumber % int64(len(w.workers)))
+}
+
 func (w *WorkerManager) needSaveRplPoint() bool {
 	tn := time.Now().Unix()
 	if tn-w.lastRplPointTime > rplPointSaveInterval {
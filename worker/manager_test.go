@@ -0,0 +1,120 @@
+package worker
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogicalClockIndex(t *testing.T) {
+	w := &WorkerManager{workers: []*worker{{}, {}, {}, {}}}
+	cases := []struct {
+		lastCommitted  int64
+		sequenceNumber int64
+		index          int
+		// clockLow is the lowest sequence number in flight after dispatching
+		clockLow int64
+	}{
+		{0, 1, 1, 1},
+		// Rows of the same transaction
+		{0, 1, 1, 1},
+		{0, 2, 2, 1},
+		{0, 3, 3, 1},
+		// Depends on the transactions in flight, waits for them
+		{3, 4, 0, 4},
+		{3, 5, 1, 4},
+		{3, 6, 2, 4},
+		// Depends on a committed transaction only
+		{3, 7, 3, 4},
+		{6, 8, 0, 8},
+		// New binlog file
+		{0, 1, 1, 1},
+		// No logical clock
+		{0, 0, -1, 0},
+		{0, 1, 1, 1},
+	}
+	for i, c := range cases {
+		job := &WorkerEvent{LastCommitted: c.lastCommitted, SequenceNumber: c.sequenceNumber}
+		if index := w.logicalClockIndex(job); c.index != index || c.clockLow != w.clockLow {
+			t.Errorf("case %d: unexpected index %d, clock low %d", i, index, w.clockLow)
+		}
+	}
+}
+
+func TestLogicalClockAfterFallback(t *testing.T) {
+	w := &WorkerManager{workers: []*worker{{}, {}}}
+	if index := w.logicalClockIndex(&WorkerEvent{}); -1 != index {
+		t.Fatalf("unexpected index %d", index)
+	}
+	// The job dispatched by table name is in flight
+	w.jobWg.Add(1)
+	done := make(chan int, 1)
+	go func() {
+		done <- w.logicalClockIndex(&WorkerEvent{SequenceNumber: 1})
+	}()
+	select {
+	case index := <-done:
+		{
+			t.Fatalf("dispatched to %d before the jobs in flight are committed", index)
+		}
+	case <-time.After(50 * time.Millisecond):
+		{
+			// Waiting
+		}
+	}
+	w.jobWg.Done()
+	if index := <-done; 1 != index || 1 != w.clockLow {
+		t.Errorf("unexpected index %d, clock low %d", index, w.clockLow)
+	}
+}
+
+type countExecutor struct {
+	mu   sync.Mutex
+	jobs int
+}
+
+func (e *countExecutor) Attach(interface{}) error { return nil }
+func (e *countExecutor) Begin() error             { return nil }
+func (e *countExecutor) Rollback() error          { return nil }
+func (e *countExecutor) Commit() error            { return nil }
+
+func (e *countExecutor) Exec(*WorkerEvent) error {
+	e.mu.Lock()
+	e.jobs++
+	e.mu.Unlock()
+	return nil
+}
+
+func TestFlushCommitsImmediately(t *testing.T) {
+	exec := &countExecutor{}
+	w := &WorkerManager{}
+	w.workers = []*worker{{executors: []IJobExecutor{exec}, jobWg: &w.jobWg}}
+	// The commit interval never expires in the test
+	if err := w.workers[0].start(&w.wg, 0, 3600*1000); nil != err {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		w.jobWg.Add(1)
+		w.workers[0].push(&WorkerEvent{})
+	}
+	done := make(chan struct{})
+	go func() {
+		w.Flush()
+		close(done)
+	}()
+	select {
+	case <-done:
+		{
+			// Committed
+		}
+	case <-time.After(5 * time.Second):
+		{
+			t.Fatal("flush waits for the commit interval")
+		}
+	}
+	if 3 != exec.jobs {
+		t.Errorf("unexpected committed jobs %d", exec.jobs)
+	}
+	w.workers[0].stop()
+	w.wg.Wait()
+}
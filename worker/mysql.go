@@ -11,6 +11,7 @@ import (
 	"github.com/ngaut/log"
 	"github.com/sirupsen/logrus"
 	"github.com/sryanyuan/binp/dbg"
+	"github.com/sryanyuan/binp/tableinfo"
 	"github.com/sryanyuan/binp/utils"
 	// Import mysql driver
 	_ "github.com/go-sql-driver/mysql"
@@ -29,6 +30,7 @@ type mysqlExecutor struct {
 	txn         *sql.Tx
 	valuesCache []interface{}
 	statement   bytes.Buffer
+	enumLabels  bool
 }
 
 func init() {
@@ -38,6 +40,7 @@ func init() {
 		}
 
 		var executor mysqlExecutor
+		executor.enumLabels = dest.EnumLabels
 
 		dbs := make([]*sql.DB, 0, len(dest.DBs))
 		for _, v := range dest.DBs {
@@ -173,19 +176,29 @@ func (e *mysqlExecutor) insertStatementGen(job *WorkerEvent) (string, []interfac
 	e.statement.WriteString("`.`")
 	e.statement.WriteString(job.SDesc.RewriteTable)
 	e.statement.WriteString("` (")
-	for i, c := range job.Columns {
-		if i != 0 {
+	cnt := 0
+	for _, c := range job.Columns {
+		// Columns not logged take the default value
+		if !c.Present {
+			continue
+		}
+		if 0 != cnt {
 			e.statement.WriteString(", ")
 		}
 		e.statement.WriteString(c.Column.Name)
+		e.valuesCache = append(e.valuesCache, e.columnValue(c))
+		cnt++
+	}
+	if 0 == cnt {
+		return "", nil, errors.Errorf("Table %s.%s missing insert columns",
+			job.Ti.Schema, job.Ti.Name)
 	}
 	e.statement.WriteString(") VALUES (")
-	for i, c := range job.Columns {
+	for i := 0; i < cnt; i++ {
 		if i != 0 {
 			e.statement.WriteString(", ")
 		}
 		e.statement.WriteString("?")
-		e.valuesCache = append(e.valuesCache, c.Value)
 	}
 	e.statement.WriteString(")")
 	return e.statement.String(), e.valuesCache, nil
@@ -198,8 +211,13 @@ func (e *mysqlExecutor) updateStatementGen(job *WorkerEvent) (string, []interfac
 	e.statement.WriteString(job.SDesc.RewriteTable)
 	e.statement.WriteString("` SET ")
 	cnt := 0
-	for i := range job.Columns {
-		if reflect.DeepEqual(job.Columns[i].Value, job.NewColumns[i].Value) {
+	for i := range job.NewColumns {
+		// Only the columns logged in the after image are updated
+		if !job.NewColumns[i].Present {
+			continue
+		}
+		if job.Columns[i].Present &&
+			reflect.DeepEqual(job.Columns[i].Value, job.NewColumns[i].Value) {
 			continue
 		}
 		if 0 != cnt {
@@ -209,31 +227,16 @@ func (e *mysqlExecutor) updateStatementGen(job *WorkerEvent) (string, []interfac
 		e.statement.WriteString(job.NewColumns[i].Column.Name)
 		e.statement.WriteString("`")
 		e.statement.WriteString(" = ?")
-		e.valuesCache = append(e.valuesCache, job.NewColumns[i].Value)
+		e.valuesCache = append(e.valuesCache, e.columnValue(job.NewColumns[i]))
 		cnt++
 	}
 	if 0 == cnt {
 		return "", nil, errors.Errorf("Table %s.%s missing update columns",
 			job.Ti.Schema, job.Ti.Name)
 	}
-	cnt = 0
 	e.statement.WriteString(" WHERE ")
-	for _, v := range job.Columns {
-		if !v.Column.IsPrimary {
-			continue
-		}
-		if 0 != cnt {
-			e.statement.WriteString(" AND ")
-		}
-		e.statement.WriteString("`")
-		e.statement.WriteString(v.Column.Name)
-		e.statement.WriteString("` = ?")
-		e.valuesCache = append(e.valuesCache, v.Value)
-		cnt++
-	}
-	if 0 == cnt {
-		return "", nil, errors.Errorf("Table %s.%s missing index columns",
-			job.Ti.Schema, job.Ti.Name)
+	if err := e.whereStatementGen(job); nil != err {
+		return "", nil, errors.Trace(err)
 	}
 	return e.statement.String(), e.valuesCache, nil
 }
@@ -244,25 +247,54 @@ func (e *mysqlExecutor) deleteStatementGen(job *WorkerEvent) (string, []interfac
 	e.statement.WriteString("`.`")
 	e.statement.WriteString(job.SDesc.RewriteTable)
 	e.statement.WriteString("` WHERE ")
-	cnt := 0
+	if err := e.whereStatementGen(job); nil != err {
+		return "", nil, errors.Trace(err)
+	}
+	return e.statement.String(), e.valuesCache, nil
+}
+
+// whereStatementGen locates the row by the primary columns of the before image, all
+// logged columns are used if the primary columns are not logged
+func (e *mysqlExecutor) whereStatementGen(job *WorkerEvent) error {
+	keys := make([]*tableinfo.ColumnWithValue, 0, len(job.Columns))
 	for _, v := range job.Columns {
-		if !v.Column.IsPrimary {
-			continue
+		if v.Present && v.Column.IsPrimary {
+			keys = append(keys, v)
 		}
-		if 0 != cnt {
+	}
+	if 0 == len(keys) {
+		for _, v := range job.Columns {
+			if v.Present {
+				keys = append(keys, v)
+			}
+		}
+	}
+	if 0 == len(keys) {
+		return errors.Errorf("Table %s.%s missing index columns",
+			job.Ti.Schema, job.Ti.Name)
+	}
+	for i, v := range keys {
+		if 0 != i {
 			e.statement.WriteString(" AND ")
 		}
 		e.statement.WriteString("`")
 		e.statement.WriteString(v.Column.Name)
+		if nil == v.Value {
+			e.statement.WriteString("` IS NULL")
+			continue
+		}
 		e.statement.WriteString("` = ?")
-		e.valuesCache = append(e.valuesCache, v.Value)
-		cnt++
+		e.valuesCache = append(e.valuesCache, e.columnValue(v))
 	}
-	if 0 == cnt {
-		return "", nil, errors.Errorf("Table %s.%s missing index columns",
-			job.Ti.Schema, job.Ti.Name)
+	return nil
+}
+
+// columnValue returns the statement argument of the column
+func (e *mysqlExecutor) columnValue(c *tableinfo.ColumnWithValue) interface{} {
+	if e.enumLabels {
+		return c.ValueToLabel()
 	}
-	return e.statement.String(), e.valuesCache, nil
+	return c.Value
 }
 
 func (e *mysqlExecutor) exec(job *WorkerEvent) error {
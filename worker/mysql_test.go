@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sryanyuan/binp/rule"
+	"github.com/sryanyuan/binp/tableinfo"
+)
+
+func TestMinimalRowImageStatement(t *testing.T) {
+	ti := &tableinfo.TableInfo{
+		Schema: "d",
+		Name:   "t",
+		Columns: []*tableinfo.ColumnInfo{
+			{Index: 0, Name: "id", IsPrimary: true},
+			{Index: 1, Name: "name"},
+			{Index: 2, Name: "body"},
+		},
+	}
+	job := func(etype int, before []interface{}, beforePresent []bool,
+		after []interface{}, afterPresent []bool) *WorkerEvent {
+		evt := &WorkerEvent{
+			Etype:   etype,
+			Ti:      ti,
+			SDesc:   &rule.SyncDesc{RewriteSchema: "d", RewriteTable: "t"},
+			Columns: tableinfo.FillColumnsWithValue(ti, before, beforePresent),
+		}
+		if nil != after {
+			evt.NewColumns = tableinfo.FillColumnsWithValue(ti, after, afterPresent)
+		}
+		return evt
+	}
+	cases := []struct {
+		job  *WorkerEvent
+		stmt string
+		args []interface{}
+	}{
+		// Full row image
+		{
+			job(WorkerEventRowUpdate, []interface{}{int32(1), "a", "x"}, nil, []interface{}{int32(1), "b", "x"}, nil),
+			"UPDATE `d`.`t` SET `name` = ? WHERE `id` = ?",
+			[]interface{}{"b", int32(1)},
+		},
+		// Minimal image only logs the primary key and the changed columns
+		{
+			job(WorkerEventRowUpdate, []interface{}{int32(1), nil, nil}, []bool{true, false, false},
+				[]interface{}{nil, nil, nil}, []bool{false, true, false}),
+			"UPDATE `d`.`t` SET `name` = ? WHERE `id` = ?",
+			[]interface{}{nil, int32(1)},
+		},
+		// Noblob image doesn't log the unchanged blob
+		{
+			job(WorkerEventRowInsert, []interface{}{int32(2), "c", nil}, []bool{true, true, false}, nil, nil),
+			"REPLACE INTO `d`.`t` (id, name) VALUES (?, ?)",
+			[]interface{}{int32(2), "c"},
+		},
+		{
+			job(WorkerEventRowDelete, []interface{}{int32(3), nil, nil}, []bool{true, false, false}, nil, nil),
+			"DELETE FROM `d`.`t` WHERE `id` = ?",
+			[]interface{}{int32(3)},
+		},
+		// All logged columns locate the row without the primary key
+		{
+			job(WorkerEventRowDelete, []interface{}{nil, "a", nil}, []bool{false, true, true}, nil, nil),
+			"DELETE FROM `d`.`t` WHERE `name` = ? AND `body` IS NULL",
+			[]interface{}{"a"},
+		},
+	}
+	var e mysqlExecutor
+	for _, c := range cases {
+		stmt, args, err := e.statementGen(c.job)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if c.stmt != stmt || !reflect.DeepEqual(c.args, args) {
+			t.Errorf("unexpected statement %s %v, want %s %v", stmt, args, c.stmt, c.args)
+		}
+	}
+
+	evt := job(WorkerEventRowDelete, []interface{}{nil, nil, nil}, []bool{false, false, false}, nil, nil)
+	if _, _, err := e.statementGen(evt); nil == err {
+		t.Error("statement is generated without any logged column")
+	}
+}
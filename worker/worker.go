@@ -13,11 +13,14 @@ import (
 const (
 	DispatchPolicyTableName = iota
 	DispatchPolicyPrimaryKey
+	// Transactions are applied in parallel by the commit groups of the master
+	DispatchPolicyLogicalClock
 )
 
 const (
 	defaultWorkerQueueSize           = 20
 	defaultWorkerQueueCommitInterval = 200
+	workerTickInterval               = 20 * time.Millisecond
 )
 
 // Worker status
@@ -35,6 +38,7 @@ type worker struct {
 	wg             *sync.WaitGroup
 	jobWg          *sync.WaitGroup
 	jobCh          chan *WorkerEvent
+	flushCh        chan struct{}
 	lastCommitTm   int64
 	commitInterval int64
 	status         int64
@@ -56,6 +60,7 @@ func (w *worker) start(wg *sync.WaitGroup, wqsz, wqintv int) error {
 
 	w.wg = wg
 	w.jobCh = make(chan *WorkerEvent, workerJobChanSize)
+	w.flushCh = make(chan struct{}, 1)
 	w.wq = newWorkerQueue(wqsz)
 	w.lastCommitTm = time.Now().UnixNano() / 1e6
 	w.commitInterval = int64(wqintv)
@@ -74,6 +79,21 @@ func (w *worker) push(job *WorkerEvent) {
 	w.jobCh <- job
 }
 
+// signalFlush asks the worker to commit the jobs pushed before without waiting for
+// the commit interval, a pending signal covers the jobs pushed until it is received
+func (w *worker) signalFlush() {
+	select {
+	case w.flushCh <- struct{}{}:
+		{
+			// Nothing
+		}
+	default:
+		{
+			// Already signaled
+		}
+	}
+}
+
 func (w *worker) loop() {
 	var err error
 
@@ -84,24 +104,29 @@ func (w *worker) loop() {
 
 	atomic.StoreInt64(&w.status, WorkerStatusRunning)
 
+	ticker := time.NewTicker(workerTickInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case job, ok := <-w.jobCh:
 			{
 				if !ok {
-					logrus.Infof("Worker %s stop", w.wid)
+					logrus.Infof("Worker %d stop", w.wid)
 					return
 				}
 				// Push into queue and check if full
-				w.wq.push(job)
-				if w.wq.full() {
-					// Do commit job
-					if err = w.commitQueue(); nil != err {
-						return
-					}
+				if err = w.pushQueue(job); nil != err {
+					return
 				}
 			}
-		default:
+		case <-w.flushCh:
+			{
+				if err = w.flush(); nil != err {
+					return
+				}
+			}
+		case <-ticker.C:
 			{
 				tms := time.Now().UnixNano() / 1e6
 				if w.lastCommitTm > tms {
@@ -115,12 +140,47 @@ func (w *worker) loop() {
 						return
 					}
 				}
-				time.Sleep(time.Millisecond * 20)
 			}
 		}
 	}
 }
 
+func (w *worker) pushQueue(job *WorkerEvent) error {
+	w.wq.push(job)
+	if w.wq.full() {
+		// Do commit job
+		return errors.Trace(w.commitQueue())
+	}
+	return nil
+}
+
+// flush commits the queued jobs with the jobs pending in the channel
+func (w *worker) flush() error {
+drain:
+	for {
+		select {
+		case job, ok := <-w.jobCh:
+			{
+				if !ok {
+					// The loop quits on the next receive
+					break drain
+				}
+				if err := w.pushQueue(job); nil != err {
+					return errors.Trace(err)
+				}
+			}
+		default:
+			{
+				break drain
+			}
+		}
+	}
+	if 0 == w.wq.size() {
+		return nil
+	}
+	return errors.Trace(w.commitQueue())
+}
+
 func (w *worker) commitToExecutor(executor IJobExecutor, jobs []*WorkerEvent) error {
 	retryTimes := 0
 	maxRetryTimes := 0xfffffff
@@ -190,6 +250,9 @@ func (w *worker) commitQueue() error {
 	if nil != err {
 		return errors.Trace(err)
 	}
+	for range jobs {
+		w.jobWg.Done()
+	}
 	// Reset jobs
 	w.wq.reset()
 	w.lastCommitTm = time.Now().UnixNano() / 1e6